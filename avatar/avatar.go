@@ -0,0 +1,161 @@
+// Package avatar turns uploaded pictures into square PNG thumbnails. Only
+// the pixels survive: the picture is decoded and re-encoded, so EXIF and any
+// other metadata are dropped, after applying the EXIF orientation so photos
+// stay upright.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// ContentType is the type of every thumbnail
+const ContentType = "image/png"
+
+// MaxPixels bounds the size of a picture once decoded, so a small file
+// cannot expand into gigabytes of memory
+const MaxPixels = 40_000_000
+
+// Sizes are the edge lengths, in pixels, of the thumbnails generated for
+// each avatar
+var Sizes = []int{64, 128, 256}
+
+var (
+	ErrUnsupportedType = errors.New("avatar must be a JPEG, PNG or GIF image")
+	ErrTooManyPixels   = errors.New("avatar dimensions are too large")
+)
+
+// formats maps the sniffed content types accepted to the decoder that must
+// handle them, so a file cannot claim to be one format and be another
+var formats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Thumbnails decodes a JPEG, PNG or GIF picture, crops the centred square
+// and returns a PNG thumbnail for each size
+func Thumbnails(data []byte, sizes []int) (map[int][]byte, error) {
+	format, ok := formats[http.DetectContentType(data)]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+	config, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return nil, ErrUnsupportedType
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+	square := crop(img)
+
+	thumbnails := make(map[int][]byte, len(sizes))
+	for _, size := range sizes {
+		// Cropping and scaling a square commute with rotating and flipping
+		// it, so orienting the small thumbnail is enough
+		thumbnail := orient(scale(square, size), orientation)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, thumbnail); err != nil {
+			return nil, err
+		}
+		thumbnails[size] = buf.Bytes()
+	}
+	return thumbnails, nil
+}
+
+// crop copies the largest centred square of img
+func crop(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, origin, draw.Src)
+	return square
+}
+
+// scale resizes a square to size×size, averaging the source pixels each
+// target pixel covers. The pixels are premultiplied, so transparent edges
+// blend correctly.
+func scale(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := span(y, side, size)
+		for x := 0; x < size; x++ {
+			x0, x1 := span(x, side, size)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8((sum[c] + count/2) / count)
+			}
+		}
+	}
+	return dst
+}
+
+// span returns the source pixels target pixel i of size covers, at least
+// one so that upscaling works too
+func span(i, side, size int) (int, int) {
+	start := i * side / size
+	end := (i + 1) * side / size
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// orient rotates and flips a square as EXIF orientation 1 to 8 asks
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	n := src.Bounds().Dx()
+	dst := image.NewRGBA(src.Bounds())
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			sx, sy := x, y
+			switch orientation {
+			case 2: // mirrored
+				sx = n - 1 - x
+			case 3: // upside down
+				sx, sy = n-1-x, n-1-y
+			case 4: // mirrored upside down
+				sy = n - 1 - y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // turned left, so rotate clockwise
+				sx, sy = y, n-1-x
+			case 7: // transversed
+				sx, sy = n-1-y, n-1-x
+			case 8: // turned right, so rotate anticlockwise
+				sx, sy = n-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
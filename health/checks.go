@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/models"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DatabaseCheck round-trips a trivial query to db within timeout
+func DatabaseCheck(db *gorm.DB, timeout time.Duration) Check {
+	return Check{
+		Name:     "database",
+		Critical: true,
+		Timeout:  timeout,
+		Run: func(ctx context.Context) error {
+			return db.WithContext(ctx).Exec("SELECT 1").Error
+		},
+	}
+}
+
+// MigrationCheck fails when the database schema is older than the version
+// this build was compiled against
+func MigrationCheck(db *gorm.DB) Check {
+	return Check{
+		Name:     "migrations",
+		Critical: true,
+		Run: func(ctx context.Context) error {
+			var version int
+			err := db.WithContext(ctx).Model(&models.SchemaMigration{}).
+				Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+			if err != nil {
+				return err
+			}
+			if version < initializers.SchemaVersion {
+				return fmt.Errorf("schema is at version %d, want %d", version, initializers.SchemaVersion)
+			}
+			return nil
+		},
+	}
+}
+
+// Heartbeat is beaten periodically by a background worker to show it is
+// still making progress
+type Heartbeat struct {
+	last atomic.Int64
+}
+
+// Beat records that the worker is alive now
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// LastBeat returns when Beat was last called, or the zero time if never
+func (h *Heartbeat) LastBeat() time.Time {
+	last := h.last.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+// HeartbeatCheck fails when the worker behind hb has not beaten within maxAge
+func HeartbeatCheck(name string, hb *Heartbeat, maxAge time.Duration, critical bool) Check {
+	return Check{
+		Name:     name,
+		Critical: critical,
+		Run: func(ctx context.Context) error {
+			last := hb.LastBeat()
+			if last.IsZero() {
+				return fmt.Errorf("worker has not started")
+			}
+			if age := time.Since(last); age > maxAge {
+				return fmt.Errorf("last heartbeat %s ago", age.Round(time.Second))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,154 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Status values reported for individual checks and the overall report
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+)
+
+// Check is a single named dependency check. A failing critical check makes
+// the service unready; a failing non-critical one only degrades it.
+type Check struct {
+	Name     string
+	Critical bool
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of one check within a Report
+type CheckResult struct {
+	Status     string `json:"status" example:"ok"`
+	Critical   bool   `json:"critical" example:"true"`
+	Error      string `json:"error,omitempty" example:"context deadline exceeded"`
+	DurationMs int64  `json:"duration_ms" example:"3"`
+}
+
+// Report is the aggregated outcome of every registered check
+type Report struct {
+	Status    string                 `json:"status" example:"ok"`
+	Service   string                 `json:"service" example:"go-crud-api"`
+	CheckedAt time.Time              `json:"checked_at" example:"2023-01-01T00:00:00Z"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+// Healthy reports whether every critical check passed
+func (r Report) Healthy() bool {
+	return r.Status != StatusUnavailable
+}
+
+const defaultCheckTimeout = 2 * time.Second
+
+// Registry runs the registered checks and caches the report for cacheTTL so
+// frequent probes do not hammer the dependencies.
+type Registry struct {
+	service  string
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	checks   []Check
+	cached   *Report
+	cachedAt time.Time
+}
+
+// NewRegistry creates an empty Registry reporting under the given service name
+func NewRegistry(service string, cacheTTL time.Duration) *Registry {
+	return &Registry{
+		service:  service,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Register adds a check to the registry
+func (r *Registry) Register(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if check.Timeout <= 0 {
+		check.Timeout = defaultCheckTimeout
+	}
+	r.checks = append(r.checks, check)
+	r.cached = nil
+}
+
+// Report returns the cached report if it is still fresh, otherwise runs every
+// check concurrently and caches the new result.
+func (r *Registry) Report(ctx context.Context) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cached != nil && time.Since(r.cachedAt) < r.cacheTTL {
+		return *r.cached
+	}
+
+	report := Report{
+		Status:    StatusOK,
+		Service:   r.service,
+		CheckedAt: time.Now().UTC(),
+		Checks:    make(map[string]CheckResult, len(r.checks)),
+	}
+
+	results := make([]CheckResult, len(r.checks))
+	var wg sync.WaitGroup
+	for i, check := range r.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for i, check := range r.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		if result.Status == StatusOK {
+			continue
+		}
+		if check.Critical {
+			report.Status = StatusUnavailable
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+
+	r.cached = &report
+	r.cachedAt = time.Now()
+	return report
+}
+
+func runCheck(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	// Don't let a check that ignores its context hold up the whole report
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{
+		Status:     StatusOK,
+		Critical:   check.Critical,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
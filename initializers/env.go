@@ -0,0 +1,59 @@
+package initializers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetEnv returns the value of key, or fallback when it is unset or empty
+func GetEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetEnvInt parses key as an integer, falling back on missing or bad values
+func GetEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("Invalid integer for %s: %q, using %d\n", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvDuration parses key as a time.Duration (e.g. "15s"), falling back on
+// missing or bad values
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Invalid duration for %s: %q, using %s\n", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// GetEnvBool parses key as a boolean, falling back on missing or bad values
+func GetEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Printf("Invalid boolean for %s: %q, using %t\n", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -2,20 +2,68 @@ package initializers
 
 import (
 	"fmt"
+	"go-crud/metrics"
+	"go-crud/tracing"
 	"os"
+	"strings"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
+// ConnectToDB opens the database described by DB_DSN. A DSN starting with
+// "sqlite://" (or "file:") selects the pure-Go SQLite driver, anything else
+// is handed to Postgres.
 func ConnectToDB() {
 	connection := os.Getenv("DB_DSN")
-	db, err := gorm.Open(postgres.Open(connection), &gorm.Config{})
+	// TranslateError maps unique violations to gorm.ErrDuplicatedKey on
+	// every dialect
+	db, err := gorm.Open(dialectorFor(connection), &gorm.Config{TranslateError: true})
 	if err != nil {
 		fmt.Println("Failed to connect to database: ", err)
 		return
 	}
+	if err := db.Use(metrics.NewGormPlugin()); err != nil {
+		fmt.Println("Failed to register database metrics: ", err)
+	}
+	if err := db.Use(tracing.NewGormPlugin()); err != nil {
+		fmt.Println("Failed to register database tracing: ", err)
+	}
 	DB = db
 }
+
+func dialectorFor(dsn string) gorm.Dialector {
+	switch {
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return sqlite.Open(withSQLitePragmas(strings.TrimPrefix(dsn, "sqlite://")))
+	case strings.HasPrefix(dsn, "file:"):
+		return sqlite.Open(withSQLitePragmas(dsn))
+	default:
+		return postgres.Open(dsn)
+	}
+}
+
+// withSQLitePragmas appends the per-connection pragmas every pooled SQLite
+// connection needs, since SQLite ships with foreign keys disabled.
+func withSQLitePragmas(dsn string) string {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
+
+// CloseDB closes the underlying connection pool, if one was opened
+func CloseDB() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,49 @@
+package initializers
+
+import (
+	"go-crud/models"
+)
+
+// SchemaVersion is the schema version this build expects. Bump it whenever a
+// model is added or changed so readiness checks can spot a stale database.
+const SchemaVersion = 17
+
+// MigrateDB creates or updates the schema for every model on the current DB,
+// applying any settings the active dialect needs first.
+func MigrateDB() error {
+	if DB.Dialector.Name() == "sqlite" {
+		// WAL is stored in the database file, so it only needs setting once;
+		// without it readers are serialised behind writers.
+		if err := DB.Exec("PRAGMA journal_mode = WAL").Error; err != nil {
+			return err
+		}
+	}
+
+	err := DB.AutoMigrate(
+		&models.SchemaMigration{},
+		&models.Post{},
+		&models.User{},
+		&models.LoginAttempt{},
+		&models.AccountLockout{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.EmailChange{},
+		&models.RecoveryCode{},
+		&models.APIKey{},
+		&models.Session{},
+		&models.OAuthClient{},
+		&models.OAuthAuthorizationCode{},
+		&models.OAuthConsent{},
+		&models.OAuthToken{},
+		&models.ExternalIdentity{},
+		&models.ExternalLogin{},
+		&models.AuditLog{},
+		&models.DataExport{},
+		&models.Avatar{},
+	)
+	if err != nil {
+		return err
+	}
+
+	return DB.FirstOrCreate(&models.SchemaMigration{}, models.SchemaMigration{Version: SchemaVersion}).Error
+}
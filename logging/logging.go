@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"context"
+	"go-crud/initializers"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Redacted replaces the value of any attribute whose key looks like a secret
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched case-insensitively against attribute keys
+var sensitiveKeys = []string{"password", "token", "secret", "authorization"}
+
+// Setup builds the process-wide logger from LOG_LEVEL (debug, info, warn,
+// error) and LOG_FORMAT (json or text) and installs it as slog's default.
+func Setup() *slog.Logger {
+	logger := New(os.Stdout, initializers.GetEnv("LOG_LEVEL", "info"), initializers.GetEnv("LOG_FORMAT", "json"))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New creates a logger writing to w at the given level and format
+func New(w io.Writer, level, format string) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       parseLevel(level),
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "text") {
+		handler = slog.NewTextHandler(w, options)
+	} else {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	return slog.New(handler)
+}
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the request-scoped logger stored in ctx, or the default
+// logger when there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// IsSensitive reports whether a field name should never be logged verbatim
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if IsSensitive(attr.Key) && attr.Value.Kind() != slog.KindGroup {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+func parseLevel(level string) slog.Level {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return parsed
+}
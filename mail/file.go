@@ -0,0 +1,70 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"go-crud/logging"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileMailer appends each message as a JSON line to a file instead of
+// sending it, for local development and tests
+type FileMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileMailer creates a FileMailer writing to path
+func NewFileMailer(path string) *FileMailer {
+	return &FileMailer{path: path}
+}
+
+type fileRecord struct {
+	Message
+	SentAt time.Time `json:"sent_at"`
+}
+
+// Send implements Mailer
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	if err := validateHeaders(message.To, message.Subject); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(fileRecord{Message: message, SentAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// LogMailer writes messages, body included, to the request logger. Bodies
+// can carry one-time links, so never use it in production.
+type LogMailer struct{}
+
+// NewLogMailer creates a LogMailer
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send implements Mailer
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	if err := validateHeaders(message.To, message.Subject); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("email not sent, logged instead",
+		"to", message.To, "subject", message.Subject, "body", message.Body)
+	return nil
+}
@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"log/slog"
+	"strings"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer delivers email
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var ErrInvalidHeader = errors.New("mail header contains a line break")
+
+// FromEnv builds the mailer selected by MAIL_DRIVER: smtp, file or log.
+// Without MAIL_DRIVER emails are logged, with a warning since the links in
+// them are live; an unknown driver is an error.
+func FromEnv() (Mailer, error) {
+	from := initializers.GetEnv("MAIL_FROM", "no-reply@localhost")
+
+	switch driver := initializers.GetEnv("MAIL_DRIVER", ""); driver {
+	case "":
+		slog.Warn("MAIL_DRIVER is not set, emails and the links in them are written to the logs")
+		return NewLogMailer(), nil
+	case "smtp":
+		return NewSMTPMailer(SMTPConfig{
+			Host:     initializers.GetEnv("SMTP_HOST", "localhost"),
+			Port:     initializers.GetEnvInt("SMTP_PORT", 587),
+			Username: initializers.GetEnv("SMTP_USERNAME", ""),
+			Password: initializers.GetEnv("SMTP_PASSWORD", ""),
+			From:     from,
+		}), nil
+	case "file":
+		return NewFileMailer(initializers.GetEnv("MAIL_FILE", "mail.jsonl")), nil
+	case "log":
+		return NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q, expected smtp, file or log", driver)
+	}
+}
+
+// validateHeaders rejects values that could inject extra headers
+func validateHeaders(values ...string) error {
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return ErrInvalidHeader
+		}
+	}
+	return nil
+}
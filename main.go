@@ -3,7 +3,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"go-crud/initializers"
 	"go-crud/router"
+	"go-crud/server"
+	"go-crud/tracing"
+	"os"
+	"os/signal"
+	"syscall"
+
 	_ "go-crud/docs" // This will be generated
 )
 
@@ -23,7 +32,51 @@ import (
 // @BasePath /
 // @schemes http https
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Type "Bearer" followed by a space and the access token.
+
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description A personal API key from POST /users/me/api-keys.
+
 func main() {
-	r := router.SetupRouter()
-	r.Run() // listen and serve on 0.0.0.0:8080
+	r, workers, err := router.SetupRouter()
+	if err != nil {
+		fmt.Println("Failed to start: ", err)
+		os.Exit(1)
+	}
+
+	// Cancelled on SIGINT/SIGTERM; background workers should stop with it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:    initializers.GetEnv("OTEL_TRACES_EXPORTER", "none"),
+		ServiceName: initializers.GetEnv("OTEL_SERVICE_NAME", "go-crud-api"),
+		File:        initializers.GetEnv("TRACES_FILE", "traces.jsonl"),
+	})
+	if err != nil {
+		fmt.Println("Failed to set up tracing: ", err)
+	}
+
+	// Erase accounts whose deletion grace period has ended
+	if initializers.DB != nil {
+		workers.Start(ctx)
+	}
+
+	srv := server.New(r, server.LoadConfig())
+	// Background jobs still trace and use the database until they finish
+	srv.OnShutdown(workers.Wait)
+	srv.OnShutdown(shutdownTracing)
+	srv.OnShutdown(func(context.Context) error {
+		return initializers.CloseDB()
+	})
+
+	if err := srv.Run(ctx); err != nil {
+		fmt.Println("Server stopped with error: ", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"go-crud/models"
+	"go-crud/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit stores the caller, the request's IP and ID and any impersonator in
+// the request context for the audit log, and records every request made while impersonating a
+// user once it has been handled, refused ones included.
+func Audit(audit *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		details := services.AuditContext{
+			IP:        c.ClientIP(),
+			RequestID: GetRequestID(c),
+		}
+		if userID, ok := CurrentUserID(c); ok {
+			details.ActorID = &userID
+		}
+		impersonatorID, impersonating := CurrentImpersonatorID(c)
+		if impersonating {
+			details.ImpersonatorID = &impersonatorID
+		}
+		c.Request = c.Request.WithContext(services.WithAuditContext(c.Request.Context(), details))
+
+		c.Next()
+
+		if !impersonating {
+			return
+		}
+		audit.Record(c.Request.Context(), models.AuditLog{
+			Action: models.AuditImpersonationRequest,
+			Details: map[string]interface{}{
+				"method": c.Request.Method,
+				"route":  c.FullPath(),
+				"path":   c.Request.URL.Path,
+				"status": c.Writer.Status(),
+			},
+		})
+	}
+}
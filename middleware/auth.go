@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleKey holds the authenticated user's role in the gin context
+const RoleKey = "user_role"
+
+// Authenticators are the services that check each kind of credential
+type Authenticators struct {
+	Tokens   *services.AuthService
+	APIKeys  *services.APIKeyService
+	Sessions *services.SessionService
+	OAuth    *services.OAuthService
+}
+
+// Authenticate identifies the caller from an "Authorization: Bearer" access
+// token (a first-party JWT or an OAuth access token), an X-API-Key personal
+// API key or, failing both, a session cookie. Requests without credentials
+// pass through anonymously; requests with bad or revoked credentials are
+// rejected. A stale session cookie is ignored so the browser can still log in
+// again. HTTP Basic credentials identify OAuth clients, not users, and are
+// left to the OAuth endpoints.
+func Authenticate(auth Authenticators) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if strings.HasPrefix(header, "Basic ") {
+			header = ""
+		}
+		apiKey := c.GetHeader(APIKeyHeader)
+		if header != "" && apiKey != "" {
+			abortUnauthorized(c, "Send either a bearer token or an API key, not both")
+			return
+		}
+
+		var user, impersonator *models.User
+		switch {
+		case apiKey != "":
+			var key *models.APIKey
+			var err error
+			user, key, err = auth.APIKeys.Authenticate(c.Request.Context(), apiKey)
+			if err != nil {
+				if !errors.Is(err, services.ErrInvalidAPIKey) {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), "Failed to authenticate request"))
+					return
+				}
+				abortUnauthorized(c, "Invalid or expired API key")
+				return
+			}
+			c.Set(ScopesKey, key.Scopes)
+		case header != "":
+			tokenString, found := strings.CutPrefix(header, "Bearer ")
+			if !found {
+				abortUnauthorized(c, "Authorization header must use the Bearer scheme")
+				return
+			}
+
+			var err error
+			if services.IsOAuthAccessToken(tokenString) {
+				var token *models.OAuthToken
+				user, token, err = auth.OAuth.Authenticate(c.Request.Context(), tokenString)
+				if err == nil {
+					c.Set(ScopesKey, token.Scopes)
+				}
+			} else {
+				user, impersonator, err = auth.Tokens.Authenticate(c.Request.Context(), tokenString)
+			}
+			if err != nil {
+				if !errors.Is(err, services.ErrInvalidToken) {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), "Failed to authenticate request"))
+					return
+				}
+				abortUnauthorized(c, "Invalid or expired access token")
+				return
+			}
+		default:
+			token, err := c.Cookie(SessionCookie)
+			if err != nil || token == "" {
+				c.Next()
+				return
+			}
+
+			var current *models.Session
+			user, current, err = auth.Sessions.Authenticate(c.Request.Context(), token)
+			if err != nil {
+				if !errors.Is(err, services.ErrInvalidSession) {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), "Failed to authenticate request"))
+					return
+				}
+				c.Next()
+				return
+			}
+			c.Set(SessionIDKey, current.ID)
+			c.Set(CSRFTokenKey, current.CSRFToken)
+		}
+
+		c.Set(UserIDKey, user.ID)
+		c.Set(RoleKey, user.Role)
+		c.Set(EmailVerifiedKey, user.IsEmailVerified())
+		c.Set(AccountStatusKey, user.StatusAt(time.Now()))
+		logger := logging.FromContext(c.Request.Context()).With("user_id", user.ID)
+		if impersonator != nil {
+			c.Set(ImpersonatorIDKey, impersonator.ID)
+			logger = logger.With("impersonator_id", impersonator.ID)
+		}
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), logger))
+
+		c.Next()
+	}
+}
+
+// RequireAuth rejects anonymous requests
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentUserID(c); !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole rejects requests from callers without the given role
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentUserID(c); !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+		if c.GetString(RoleKey) != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "Insufficient permissions"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail guards the given actions, each "METHOD /route/:template"
+// as in the rate limit policies, so only callers with a verified email can
+// perform them. Other routes pass through untouched.
+func RequireVerifiedEmail(actions []string) gin.HandlerFunc {
+	guarded := make(map[string]struct{}, len(actions))
+	for _, action := range actions {
+		guarded[action] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		if _, ok := guarded[c.Request.Method+" "+c.FullPath()]; !ok {
+			c.Next()
+			return
+		}
+		if _, ok := CurrentUserID(c); !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+		if !c.GetBool(EmailVerifiedKey) {
+			response := schemas.NewErrorResponse(c.Request.Context(), "Verify your email address to perform this action")
+			response.Code = "email_not_verified"
+			c.AbortWithStatusJSON(http.StatusForbidden, response)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireActiveAccount stops deactivated and suspended users from using
+// credentials issued before the account was blocked: every request, reads
+// included, is refused unless listed in allowed, each "METHOD
+// /route/:template" as in the rate limit policies.
+func RequireActiveAccount(allowed []string) gin.HandlerFunc {
+	exempt := make(map[string]struct{}, len(allowed))
+	for _, action := range allowed {
+		exempt[action] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		status := c.GetString(AccountStatusKey)
+		if status == "" || status == models.UserStatusActive {
+			c.Next()
+			return
+		}
+		if _, ok := exempt[c.Request.Method+" "+c.FullPath()]; ok {
+			c.Next()
+			return
+		}
+		response := schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Your account is %s", status))
+		response.Code = "account_" + status
+		c.AbortWithStatusJSON(http.StatusForbidden, response)
+	}
+}
+
+// VerifyCSRF protects cookie-authenticated requests from cross-site request
+// forgery: unsafe methods must echo the session's CSRF token in the
+// X-CSRF-Token header, or as a csrf_token field when submitting an HTML form.
+// Bearer token and API key callers are not checked, as browsers never attach
+// those on their own.
+func VerifyCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			c.Next()
+			return
+		}
+
+		expected := c.GetString(CSRFTokenKey)
+		if expected == "" {
+			c.Next()
+			return
+		}
+		token := c.GetHeader(CSRFHeader)
+		if token == "" && c.ContentType() == "application/x-www-form-urlencoded" {
+			token = c.PostForm("csrf_token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			response := schemas.NewErrorResponse(c.Request.Context(), "Missing or invalid CSRF token")
+			response.Code = "csrf_token_invalid"
+			c.AbortWithStatusJSON(http.StatusForbidden, response)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScopes limits what callers with delegated credentials, API keys and
+// OAuth access tokens, can do. scopes maps each action, "METHOD
+// /route/:template" as in the rate limit policies, to the scope needed for
+// it; delegated credentials cannot perform unlisted actions at all. Users
+// acting for themselves with a session or first-party token are not
+// restricted.
+func RequireScopes(scopes map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get(ScopesKey)
+		if !exists {
+			c.Next()
+			return
+		}
+		granted, _ := value.([]string)
+
+		scope, ok := scopes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			response := schemas.NewErrorResponse(c.Request.Context(), "This action is not available to API keys or OAuth clients")
+			response.Code = "scope_not_allowed"
+			c.AbortWithStatusJSON(http.StatusForbidden, response)
+			return
+		}
+		if !slices.Contains(granted, scope) {
+			response := schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Credential lacks the %s scope", scope))
+			response.Code = "insufficient_scope"
+			c.AbortWithStatusJSON(http.StatusForbidden, response)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RestrictImpersonation stops admins impersonating a user from performing
+// the given actions, each "METHOD /route/:template" as in the rate limit
+// policies: taking over the account or acting beyond a support session.
+func RestrictImpersonation(actions []string) gin.HandlerFunc {
+	blocked := make(map[string]struct{}, len(actions))
+	for _, action := range actions {
+		blocked[action] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		if _, impersonating := CurrentImpersonatorID(c); !impersonating {
+			c.Next()
+			return
+		}
+		if _, ok := blocked[c.Request.Method+" "+c.FullPath()]; ok {
+			response := schemas.NewErrorResponse(c.Request.Context(), "This action is not available while impersonating a user")
+			response.Code = "impersonation_forbidden"
+			c.AbortWithStatusJSON(http.StatusForbidden, response)
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentImpersonatorID returns the ID of the admin impersonating the
+// authenticated user, if any
+func CurrentImpersonatorID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get(ImpersonatorIDKey)
+	if !exists {
+		return 0, false
+	}
+	id, ok := value.(uint)
+	return id, ok
+}
+
+// CurrentUserID returns the authenticated user's ID, if any
+func CurrentUserID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get(UserIDKey)
+	if !exists {
+		return 0, false
+	}
+	id, ok := value.(uint)
+	return id, ok
+}
+
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="go-crud"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), message))
+}
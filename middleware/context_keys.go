@@ -0,0 +1,39 @@
+package middleware
+
+// UserIDKey holds the authenticated user's ID in the gin context once an
+// authentication middleware has identified the caller
+const UserIDKey = "user_id"
+
+// EmailVerifiedKey holds whether the authenticated user's email address is
+// verified
+const EmailVerifiedKey = "email_verified"
+
+// APIKeyHeader carries a personal API key on machine-client requests
+const APIKeyHeader = "X-API-Key"
+
+// ScopesKey holds the scopes granted to the API key or OAuth access token
+// that authenticated the request; it is unset when users act for themselves
+const ScopesKey = "scopes"
+
+// SessionCookie names the cookie carrying a server-side session token
+const SessionCookie = "go_crud_session"
+
+// CSRFHeader carries the session's CSRF token on unsafe cookie-authenticated
+// requests
+const CSRFHeader = "X-CSRF-Token"
+
+// SessionIDKey holds the ID of the session that authenticated the request;
+// it is unset for bearer token and API key callers
+const SessionIDKey = "session_id"
+
+// CSRFTokenKey holds the CSRF token of the session that authenticated the
+// request
+const CSRFTokenKey = "csrf_token"
+
+// ImpersonatorIDKey holds the ID of the admin acting as the authenticated
+// user; it is unset unless the request carries an impersonation token
+const ImpersonatorIDKey = "impersonator_id"
+
+// AccountStatusKey holds the authenticated user's account status, one of
+// the models.UserStatus constants
+const AccountStatusKey = "account_status"
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"go-crud/logging"
+	"go-crud/schemas"
+	"io"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery turns a panic into a 500 response and logs it with the request's
+// structured logger instead of gin's plain-text writer.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logging.FromContext(c.Request.Context()).Error("panic recovered",
+			"panic", recovered,
+			"stack", string(debug.Stack()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), "Internal server error"))
+	})
+}
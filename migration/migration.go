@@ -1,8 +1,8 @@
 package main
 
 import (
+	"fmt"
 	"go-crud/initializers"
-	"go-crud/models"
 )
 
 
@@ -13,7 +13,8 @@ func init() {
 
 
 func main() {
-	initializers.DB.AutoMigrate(&models.Post{})
-	initializers.DB.AutoMigrate(&models.User{})
+	if err := initializers.MigrateDB(); err != nil {
+		fmt.Println("Failed to migrate database: ", err)
+	}
 }
 
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Scopes an API key can be granted
+const (
+	ScopePostsRead  = "posts:read"
+	ScopePostsWrite = "posts:write"
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// APIKeyScopes lists every scope an API key can be granted
+var APIKeyScopes = []string{ScopePostsRead, ScopePostsWrite, ScopeUsersRead, ScopeUsersWrite}
+
+// APIKey is a personal API key for non-interactive clients. The key is shown
+// once as "<prefix>.<secret>"; only the prefix, which identifies the key, and
+// a SHA-256 hash of the secret are stored.
+type APIKey struct {
+	ID         uint     `gorm:"primaryKey" json:"id" example:"1"`
+	UserID     uint     `gorm:"index;not null" json:"user_id" example:"1"`
+	Name       string   `gorm:"not null" json:"name" example:"CI deploy"`
+	Prefix     string   `gorm:"uniqueIndex;not null" json:"prefix" example:"gck_1a2b3c4d"`
+	SecretHash string   `gorm:"not null" json:"-"`
+	Scopes     []string `gorm:"type:text;serializer:json;not null" json:"scopes" example:"posts:write"`
+	// TokenVersion is the user's token version when the key was created; the
+	// key stops working once the user revokes their tokens
+	TokenVersion int        `gorm:"not null;default:0" json:"-"`
+	ExpiresAt    *time.Time `json:"expires_at" example:"2024-01-01T00:00:00Z"`
+	LastUsedAt   *time.Time `json:"last_used_at" example:"2023-01-02T00:00:00Z"`
+	CreatedAt    time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// IsExpired reports whether the key has expired at the given time
+func (k APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit actions
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditPostCreate           = "post.create"
+	AuditPostUpdate           = "post.update"
+	AuditPostDelete           = "post.delete"
+	AuditUserCreate           = "user.create"
+	AuditUserUpdate           = "user.update"
+	AuditUserDelete           = "user.delete"
+	AuditUserDeletionSchedule = "user.deletion_schedule"
+	AuditUserDeletionCancel   = "user.deletion_cancel"
+	AuditUserExport           = "user.export"
+	AuditUserDeactivate       = "user.deactivate"
+	AuditUserReactivate       = "user.reactivate"
+	AuditUserSuspend          = "user.suspend"
+	AuditUserReinstate        = "user.reinstate"
+)
+
+// ErrAuditLogAppendOnly is returned when something tries to change or remove
+// an audit log entry
+var ErrAuditLogAppendOnly = errors.New("audit log entries cannot be changed or deleted")
+
+// AuditLog records who did what, for compliance and incident review. ActorID
+// is the user the action was performed as; when an admin was impersonating
+// that user, ImpersonatorID is the admin. For changes to a resource, Before
+// and After hold the fields that changed, with secrets masked.
+type AuditLog struct {
+	ID             uint                   `gorm:"primaryKey" json:"id" example:"1"`
+	Action         string                 `gorm:"index;not null" json:"action" example:"post.update"`
+	ActorID        *uint                  `gorm:"index" json:"actor_id" example:"7"`
+	ImpersonatorID *uint                  `gorm:"index" json:"impersonator_id,omitempty" example:"1"`
+	ResourceType   string                 `gorm:"index:idx_audit_log_resource" json:"resource_type,omitempty" example:"post"`
+	ResourceID     string                 `gorm:"index:idx_audit_log_resource" json:"resource_id,omitempty" example:"42"`
+	Before         map[string]interface{} `gorm:"type:text;serializer:json" json:"before,omitempty"`
+	After          map[string]interface{} `gorm:"type:text;serializer:json" json:"after,omitempty"`
+	Details        map[string]interface{} `gorm:"type:text;serializer:json" json:"details,omitempty"`
+	IP             string                 `json:"ip,omitempty" example:"203.0.113.7"`
+	RequestID      string                 `gorm:"index" json:"request_id,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+	CreatedAt      time.Time              `gorm:"index" json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// BeforeUpdate keeps the audit log append-only
+func (AuditLog) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+// BeforeDelete keeps the audit log append-only
+func (AuditLog) BeforeDelete(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Avatar is one square thumbnail of a user's profile picture. Each upload
+// replaces the user's thumbnails in every size.
+type Avatar struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"uniqueIndex:idx_avatar_user_size;not null"`
+	Size        int    `gorm:"uniqueIndex:idx_avatar_user_size;not null"`
+	ContentType string `gorm:"not null"`
+	Data        []byte `gorm:"not null"`
+	CreatedAt   time.Time
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Data export states
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a ZIP of everything stored about a user, built in the
+// background on request and kept until ExpiresAt
+type DataExport struct {
+	ID          uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID      uint       `gorm:"index;not null" json:"-"`
+	Status      string     `gorm:"not null" json:"status" example:"ready"`
+	Archive     []byte     `json:"-"`
+	Size        int        `json:"size" example:"2048"`
+	ExpiresAt   time.Time  `gorm:"index;not null" json:"expires_at" example:"2023-01-08T00:00:00Z"`
+	CompletedAt *time.Time `json:"completed_at" example:"2023-01-01T00:00:05Z"`
+	CreatedAt   time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
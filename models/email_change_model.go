@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// EmailChange is a request to move a user to a new email address. It stays
+// pending until confirmed from the new address; once applied, the old
+// address can revert it until RevertExpiresAt. Only token hashes are stored.
+type EmailChange struct {
+	ID               uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID           uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	OldEmail         string     `gorm:"not null" json:"old_email" example:"connor@example.com"`
+	NewEmail         string     `gorm:"index;not null" json:"new_email" example:"connor.tran@example.com"`
+	ConfirmTokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"expires_at" example:"2023-01-02T00:00:00Z"`
+	ConfirmedAt      *time.Time `json:"confirmed_at,omitempty" example:"2023-01-01T00:10:00Z"`
+	CancelledAt      *time.Time `json:"cancelled_at,omitempty" example:"2023-01-01T00:10:00Z"`
+	RevertTokenHash  *string    `gorm:"uniqueIndex" json:"-"`
+	RevertExpiresAt  *time.Time `json:"revert_expires_at,omitempty" example:"2023-01-08T00:10:00Z"`
+	RevertedAt       *time.Time `json:"reverted_at,omitempty" example:"2023-01-02T00:00:00Z"`
+	CreatedAt        time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
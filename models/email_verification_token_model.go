@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// EmailVerificationToken proves ownership of a user's email address. Only a
+// SHA-256 hash of the token is stored.
+type EmailVerificationToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID    uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at" example:"2023-01-02T00:00:00Z"`
+	UsedAt    *time.Time `json:"used_at,omitempty" example:"2023-01-01T00:10:00Z"`
+	CreatedAt time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
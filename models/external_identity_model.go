@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ExternalIdentity links a user to an account at an external OpenID Connect
+// provider. The provider's issuer and subject identify the account; the email
+// is only a record of what the provider reported when the link was made.
+type ExternalIdentity struct {
+	ID          uint      `gorm:"primaryKey" json:"id" example:"1"`
+	UserID      uint      `gorm:"index;not null" json:"-"`
+	Issuer      string    `gorm:"uniqueIndex:idx_external_identity_issuer_subject;not null" json:"issuer" example:"https://accounts.example.com"`
+	Subject     string    `gorm:"uniqueIndex:idx_external_identity_issuer_subject;not null" json:"subject" example:"248289761001"`
+	Email       string    `gorm:"not null" json:"email" example:"connortran@gmail.com"`
+	CreatedAt   time.Time `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	LastLoginAt time.Time `json:"last_login_at" example:"2023-01-01T00:00:00Z"`
+}
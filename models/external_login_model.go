@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ExternalLogin is an external provider login in progress, kept between the
+// redirect to the provider and the callback. It is looked up by a hash of the
+// state parameter and can be completed once.
+type ExternalLogin struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"uniqueIndex;not null"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"index;not null"`
+	UsedAt       *time.Time
+	CreatedAt    time.Time
+}
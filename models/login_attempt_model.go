@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// LoginAttempt records every login attempt so failures can be counted per
+// account and per client IP
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id" example:"1"`
+	Email     string    `gorm:"index;not null" json:"email" example:"connor@example.com"`
+	IP        string    `gorm:"index;not null" json:"ip" example:"203.0.113.7"`
+	Success   bool      `gorm:"not null" json:"success" example:"false"`
+	CreatedAt time.Time `gorm:"index" json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// AccountLockout records an account being locked after repeated failures,
+// and who unlocked it if an admin did so early
+type AccountLockout struct {
+	ID           uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID       uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	IP           string     `gorm:"not null" json:"ip" example:"203.0.113.7"`
+	LockedUntil  time.Time  `gorm:"not null" json:"locked_until" example:"2023-01-01T00:30:00Z"`
+	UnlockedAt   *time.Time `json:"unlocked_at,omitempty" example:"2023-01-01T00:10:00Z"`
+	UnlockedByID *uint      `json:"unlocked_by_id,omitempty" example:"2"`
+	CreatedAt    time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
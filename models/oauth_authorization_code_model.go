@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// OAuthAuthorizationCode is a single-use code handed to a client through the
+// user's browser, redeemed at the token endpoint together with the PKCE code
+// verifier. Only a SHA-256 hash of the code is stored.
+type OAuthAuthorizationCode struct {
+	ID            uint     `gorm:"primaryKey"`
+	CodeHash      string   `gorm:"uniqueIndex;not null"`
+	GrantID       string   `gorm:"index;not null"`
+	ClientID      string   `gorm:"index;not null"`
+	UserID        uint     `gorm:"index;not null"`
+	RedirectURI   string   `gorm:"not null"`
+	Scopes        []string `gorm:"type:text;serializer:json;not null"`
+	CodeChallenge string   `gorm:"not null"`
+	Nonce         string
+	AuthTime      time.Time `gorm:"not null"`
+	ExpiresAt     time.Time `gorm:"not null"`
+	UsedAt        *time.Time
+	CreatedAt     time.Time
+}
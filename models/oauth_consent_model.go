@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// OAuthConsent remembers the scopes a user has agreed to share with a client,
+// so the consent screen is only shown again for new scopes
+type OAuthConsent struct {
+	ID        uint     `gorm:"primaryKey"`
+	UserID    uint     `gorm:"uniqueIndex:idx_oauth_consent_user_client;not null"`
+	ClientID  string   `gorm:"uniqueIndex:idx_oauth_consent_user_client;not null"`
+	Scopes    []string `gorm:"type:text;serializer:json;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Kinds of OAuthToken
+const (
+	OAuthAccessToken  = "access_token"
+	OAuthRefreshToken = "refresh_token"
+)
+
+// OAuthToken is an opaque access or refresh token issued to an OAuth client.
+// Only a SHA-256 hash is stored. Every token from one authorization shares a
+// GrantID, so the whole grant can be revoked when a code or refresh token is
+// replayed.
+type OAuthToken struct {
+	ID        uint     `gorm:"primaryKey"`
+	TokenHash string   `gorm:"uniqueIndex;not null"`
+	Kind      string   `gorm:"not null"`
+	GrantID   string   `gorm:"index;not null"`
+	ClientID  string   `gorm:"index;not null"`
+	UserID    uint     `gorm:"index;not null"`
+	Scopes    []string `gorm:"type:text;serializer:json;not null"`
+	// TokenVersion is the user's TokenVersion at issue, so anything that
+	// revokes the user's tokens also revokes these
+	TokenVersion int       `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	RevokedAt    *time.Time
+	CreatedAt    time.Time
+}
+
+// IsActive reports whether the token can still be used at the given time
+func (t OAuthToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
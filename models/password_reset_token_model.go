@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a single-use password reset token. Only a SHA-256
+// hash of the token is stored, so a database leak cannot be used to reset
+// passwords.
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID    uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at" example:"2023-01-01T01:00:00Z"`
+	UsedAt    *time.Time `json:"used_at,omitempty" example:"2023-01-01T00:10:00Z"`
+	CreatedAt time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// SchemaMigration records each schema version applied by the migrator
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
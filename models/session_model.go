@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Session is a server-side login session for cookie-authenticated browsers.
+// The cookie holds a random token of which only a SHA-256 hash is stored; ID
+// is a separate public identifier for listing and revoking sessions.
+type Session struct {
+	ID        string `gorm:"primaryKey;size:32" json:"id" example:"9f86d081884c7d65"`
+	UserID    uint   `gorm:"index;not null" json:"user_id" example:"1"`
+	TokenHash string `gorm:"uniqueIndex;not null" json:"-"`
+	CSRFToken string `gorm:"not null" json:"-"`
+	// TokenVersion is the user's TokenVersion at login, so anything that
+	// revokes the user's tokens also ends their sessions
+	TokenVersion int       `gorm:"not null" json:"-"`
+	UserAgent    string    `json:"user_agent" example:"Mozilla/5.0"`
+	IP           string    `json:"ip" example:"203.0.113.7"`
+	CreatedAt    time.Time `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	LastSeenAt   time.Time `gorm:"not null" json:"last_seen_at" example:"2023-01-01T00:10:00Z"`
+	ExpiresAt    time.Time `gorm:"not null" json:"expires_at" example:"2023-01-01T12:00:00Z"`
+	// Current marks the session the request was made with
+	Current bool `gorm:"-" json:"current" example:"true"`
+}
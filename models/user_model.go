@@ -2,11 +2,58 @@ package models
 
 import "time"
 
+// Roles a user can hold
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account statuses. Deactivated accounts were closed by their owner,
+// suspended ones by an admin; neither can log in or make changes.
+const (
+	UserStatusActive      = "active"
+	UserStatusDeactivated = "deactivated"
+	UserStatusSuspended   = "suspended"
+)
+
 type User struct {
 	ID           uint      `gorm:"primaryKey" json:"id" example:"1"`
-	Name         string    `gorm:"not null" json:"name" example:"Connor Tran"`
-	Email        string    `gorm:"unique;not null" json:"email" example:"connortran@gmail.com"`
-	HashedPassword string    `gorm:"not null" json:"-"`
+	Name         string    `gorm:"not null" json:"name" example:"Connor Tran" audit:"personal"`
+	Email        string    `gorm:"unique;not null" json:"email" example:"connortran@gmail.com" audit:"personal"`
+	HashedPassword string    `gorm:"not null" json:"-" audit:"secret"`
+	Role         string    `gorm:"not null;default:user" json:"role" example:"user"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at" example:"2023-01-01T00:10:00Z"`
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil         *time.Time `json:"-"`
+	// TOTPSecret is set during enrollment and only enforced once
+	// TwoFactorEnabledAt is set by confirming a first code
+	TOTPSecret         string     `json:"-" audit:"secret"`
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at" example:"2023-01-01T00:10:00Z"`
+	// TOTPLastStep is the time step of the last accepted code, so a code
+	// cannot be replayed
+	TOTPLastStep int64 `gorm:"not null;default:0" json:"-"`
+	// TokenVersion is embedded in issued tokens; bumping it revokes them all
+	TokenVersion int `gorm:"not null;default:0" json:"-"`
+	// Public profile, shown to anyone by GET /users/:id/profile
+	DisplayName string `gorm:"size:50" json:"display_name,omitempty" example:"Connor" audit:"personal"`
+	Bio         string `gorm:"size:500" json:"bio,omitempty" example:"Backend developer, coffee enthusiast" audit:"personal"`
+	Website     string `gorm:"size:200" json:"website,omitempty" example:"https://connortran.dev" audit:"personal"`
+	Location    string `gorm:"size:100" json:"location,omitempty" example:"Ho Chi Minh City" audit:"personal"`
+	// AvatarUpdatedAt is when the current avatar was uploaded, unset without
+	// one; its thumbnails are stored as Avatar rows
+	AvatarUpdatedAt *time.Time `json:"avatar_updated_at,omitempty" example:"2023-01-01T00:10:00Z"`
+	// Status is one of the UserStatus constants. StatusReason says why the
+	// account is not active; a suspension ends on its own at StatusUntil,
+	// when set.
+	Status       string     `gorm:"not null;default:active;index" json:"status" example:"active"`
+	StatusReason string     `json:"status_reason,omitempty" example:"Posting spam" audit:"personal"`
+	StatusUntil  *time.Time `json:"status_until,omitempty" example:"2023-01-08T00:00:00Z"`
+	// DeletionScheduledAt is when the account will be erased, unless the
+	// user cancels before then
+	DeletionScheduledAt *time.Time `gorm:"index" json:"deletion_scheduled_at,omitempty" example:"2023-01-31T00:00:00Z"`
+	// ErasedAt is set once the account has been anonymized; the row stays so
+	// the user's posts and audit entries keep pointing somewhere
+	ErasedAt *time.Time `gorm:"index" json:"-"`
 	CreatedAt    time.Time `json:"created_at" example:"2023-01-01T00:00:00Z"`
 	UpdatedAt    time.Time `json:"updated_at" example:"2023-01-01T00:00:00Z"`
 }
@@ -15,3 +62,41 @@ type User struct {
 func (u User) GetID() uint {
 	return u.ID
 }
+
+// IsAdmin reports whether the user holds the admin role
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address
+func (u User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// HasTwoFactor reports whether login requires a second factor
+func (u User) HasTwoFactor() bool {
+	return u.TwoFactorEnabledAt != nil
+}
+
+// IsLocked reports whether the account is locked out at the given time
+func (u User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// StatusAt returns the account's status at the given time, treating a
+// suspension that has run out as active
+func (u User) StatusAt(now time.Time) string {
+	if u.Status == "" {
+		return UserStatusActive
+	}
+	if u.Status == UserStatusSuspended && u.StatusUntil != nil && !now.Before(*u.StatusUntil) {
+		return UserStatusActive
+	}
+	return u.Status
+}
+
+// IsActive reports whether the account can log in and make changes at the
+// given time
+func (u User) IsActive(now time.Time) bool {
+	return u.StatusAt(now) == UserStatusActive
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go-crud/logging"
+	"go-crud/middleware"
+	"go-crud/schemas"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc identifies the client a request counts against
+type KeyFunc func(c *gin.Context) string
+
+// Policy allows Limit requests per Period per client, refilling steadily, so
+// a client may burst up to Limit requests at once. A zero Limit disables
+// limiting.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Key    KeyFunc
+}
+
+// Unlimited reports whether the policy never rejects requests
+func (p Policy) Unlimited() bool {
+	return p.Limit <= 0 || p.Period <= 0
+}
+
+// KeyByIP counts every request from one client IP together
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByClient counts requests against the most specific identity available:
+// the API key, then the authenticated user, then the client IP
+func KeyByClient(c *gin.Context) string {
+	if apiKey := c.GetHeader(middleware.APIKeyHeader); apiKey != "" {
+		// Keep raw secrets out of the store
+		sum := sha256.Sum256([]byte(apiKey))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	if userID, exists := c.Get(middleware.UserIDKey); exists {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return KeyByIP(c)
+}
+
+// Limiter applies per-route policies to incoming requests
+type Limiter struct {
+	store         Store
+	policies      map[string]Policy
+	defaultPolicy Policy
+	now           func() time.Time
+}
+
+// NewLimiter creates a Limiter. policies are keyed by "METHOD /route/:template";
+// routes without an entry use defaultPolicy.
+func NewLimiter(store Store, policies map[string]Policy, defaultPolicy Policy) *Limiter {
+	return &Limiter{
+		store:         store,
+		policies:      policies,
+		defaultPolicy: defaultPolicy,
+		now:           time.Now,
+	}
+}
+
+// PolicyFor returns the policy governing method and route
+func (l *Limiter) PolicyFor(method, route string) Policy {
+	if policy, exists := l.policies[method+" "+route]; exists {
+		return policy
+	}
+	return l.defaultPolicy
+}
+
+// Middleware rejects requests over their route's limit with 429 and reports
+// the client's quota in RateLimit-* headers. If the store fails the request
+// is let through rather than taking the API down with it.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := l.PolicyFor(c.Request.Method, c.FullPath())
+		if policy.Unlimited() {
+			c.Next()
+			return
+		}
+
+		keyFunc := policy.Key
+		if keyFunc == nil {
+			keyFunc = KeyByClient
+		}
+		key := policy.Name + ":" + keyFunc(c)
+
+		result, err := l.store.Take(c.Request.Context(), key, policy, l.now())
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("rate limit store failed", "policy", policy.Name, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, schemas.NewErrorResponse(c.Request.Context(), "Rate limit exceeded, please retry later"))
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"go-crud/initializers"
+	"time"
+)
+
+// IPPolicies is the table of per-route limits keyed by client IP, keyed by
+// "METHOD /route/:template". They are enforced before authentication, so
+// floods of guesses are turned away before any credential is checked.
+// Routes not listed are left to Policies.
+func IPPolicies() map[string]Policy {
+	return map[string]Policy{
+		"POST /users": {Name: "signup", Limit: 5, Period: time.Hour, Key: KeyByIP},
+		// Both login steps, with tokens or a session, draw from one bucket
+		"POST /auth/login":        {Name: "login", Limit: 20, Period: time.Minute, Key: KeyByIP},
+		"POST /auth/2fa/verify":   {Name: "login", Limit: 20, Period: time.Minute, Key: KeyByIP},
+		"POST /auth/session":      {Name: "login", Limit: 20, Period: time.Minute, Key: KeyByIP},
+		"POST /auth/session/2fa":  {Name: "login", Limit: 20, Period: time.Minute, Key: KeyByIP},
+		"GET /auth/oidc/login":    {Name: "login", Limit: 20, Period: time.Minute, Key: KeyByIP},
+		"GET /auth/oidc/callback": {Name: "login", Limit: 20, Period: time.Minute, Key: KeyByIP},
+		// Each forgot request sends an email, so keep it from being used to spam
+		"POST /auth/password/forgot": {Name: "forgot-password", Limit: 5, Period: time.Hour, Key: KeyByIP},
+		"POST /auth/password/reset":  {Name: "reset-password", Limit: 10, Period: time.Hour, Key: KeyByIP},
+		// Guessing codes, refresh tokens or client secrets is throttled per IP
+		"POST /oauth/token": {Name: "oauth-token", Limit: 60, Period: time.Minute, Key: KeyByIP},
+	}
+}
+
+// Policies is the central table of per-route limits for each client,
+// keyed by "METHOD /route/:template". They are enforced after
+// authentication, so they can count per user or API key. Routes not listed
+// here or in IPPolicies fall back to DefaultPolicy.
+func Policies() map[string]Policy {
+	return map[string]Policy{
+		"POST /posts": {Name: "create-post", Limit: 30, Period: time.Minute},
+		// Guessing the current password with a stolen token is throttled per user
+		"POST /users/me/password":  {Name: "change-password", Limit: 5, Period: 15 * time.Minute},
+		"POST /auth/verify/resend": {Name: "resend-verification", Limit: 5, Period: time.Hour},
+		"POST /users/me/email":     {Name: "change-email", Limit: 5, Period: time.Hour},
+		"POST /users/me/api-keys":  {Name: "create-api-key", Limit: 10, Period: time.Hour},
+		// Building an export reads everything the user has
+		"POST /users/me/export": {Name: "data-export", Limit: 3, Period: time.Hour},
+		// Guessing the password with a stolen token is throttled like a change
+		"DELETE /users/me":          {Name: "change-password", Limit: 5, Period: 15 * time.Minute},
+		"POST /users/me/deactivate": {Name: "change-password", Limit: 5, Period: 15 * time.Minute},
+		// Every upload decodes and resizes a picture
+		"PUT /users/me/avatar": {Name: "avatar-upload", Limit: 10, Period: time.Hour},
+
+		// Probes and scrapes must never be throttled
+		"GET /livez":   {Name: "probe"},
+		"GET /readyz":  {Name: "probe"},
+		"GET /health":  {Name: "probe"},
+		"GET /metrics": {Name: "probe"},
+	}
+}
+
+// DefaultPolicy applies to every route without its own entry
+func DefaultPolicy() Policy {
+	return Policy{Name: "default", Limit: 300, Period: time.Minute}
+}
+
+// NewDefaultLimiters builds the application's limiters from the central
+// policies: byIP for IPPolicies, to mount before authentication, and
+// byClient for everything else, to mount after it. Both are nil when
+// RATE_LIMIT_ENABLED is false.
+func NewDefaultLimiters(store Store) (byIP, byClient *Limiter) {
+	if !initializers.GetEnvBool("RATE_LIMIT_ENABLED", true) {
+		return nil, nil
+	}
+
+	ipPolicies := IPPolicies()
+	policies := Policies()
+	// Routes limited by IP are not counted again per client
+	for route, policy := range ipPolicies {
+		policies[route] = Policy{Name: policy.Name}
+	}
+	return NewLimiter(store, ipPolicies, Policy{Name: "none"}), NewLimiter(store, policies, DefaultPolicy())
+}
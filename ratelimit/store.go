@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result describes the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token is available, when denied
+}
+
+// Store holds token buckets. MemoryStore is local to one process; replicas
+// that must share limits should use a Store backed by shared storage (e.g.
+// Redis or Postgres) that performs Take atomically.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// sweepEvery is how many Take calls pass between sweeps of idle buckets
+const sweepEvery = 1024
+
+// MemoryStore is an in-process Store
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, key string, policy Policy, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(policy.Limit), updated: now, period: policy.Period}
+		s.buckets[key] = b
+	}
+	return takeToken(b, policy, now), nil
+}
+
+// sweep drops buckets that have refilled completely, since a fresh bucket is
+// equivalent to them
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) >= b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// takeToken refills b for the time elapsed since its last update and then
+// tries to take one token from it
+func takeToken(b *bucket, policy Policy, now time.Time) Result {
+	limit := float64(policy.Limit)
+	perToken := policy.Period / time.Duration(policy.Limit)
+
+	elapsed := now.Sub(b.updated)
+	if elapsed > 0 {
+		b.tokens = math.Min(limit, b.tokens+float64(elapsed)/float64(perToken))
+	}
+	b.updated = now
+
+	result := Result{Limit: policy.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.ResetAfter = time.Duration((limit - b.tokens) * float64(perToken))
+	return result
+}
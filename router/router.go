@@ -1,37 +1,226 @@
 package router
 
 import (
+	"go-crud/health"
 	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/mail"
+	"go-crud/metrics"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/ratelimit"
+	"go-crud/services"
+	"go-crud/session"
 	"go-crud/views"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	swaggerFiles "github.com/swaggo/files"
+	"gorm.io/gorm"
 )
 
-// SetupRouter creates and configures the Gin router
-func SetupRouter() *gin.Engine {
+// SetupRouter creates and configures the Gin router, along with the
+// background workers behind it; the caller starts them
+func SetupRouter() (*gin.Engine, *Workers, error) {
 	// Initialize dependencies
 	initializers.LoadEnvVariables()
+	logging.Setup()
 	initializers.ConnectToDB()
+	if initializers.DB != nil {
+		if err := metrics.RegisterDBStats(initializers.DB); err != nil {
+			slog.Error("failed to register DB pool metrics", "error", err)
+		}
+	}
 
-	router := gin.Default()
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	workers := NewWorkers(initializers.DB)
+	return NewRouter(initializers.DB, mailer, workers), workers, nil
+}
 
-	postViews := views.NewPostViews()
+// NewRouter builds the Gin router with every view backed by db, sending
+// email through mailer. Work that requests leave running is tracked by
+// workers, which readiness reports on once they are started.
+func NewRouter(db *gorm.DB, mailer mail.Mailer, workers *Workers) *gin.Engine {
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", "error", err)
+	}
+
+	tokens := services.NewTokenService()
+	authService := services.NewAuthService(db, tokens, services.LoadLoginPolicy())
+	apiKeys := services.NewAPIKeyService(db)
+	sessions := services.NewSessionService(db, session.StoreFromEnv(db))
+	oauth := services.NewOAuthService(db, services.LoadOAuthSigner())
+	audit := services.NewAuditService(db)
+
+	router.Use(middleware.RequestID(), middleware.Tracing(), middleware.RequestLogger(), middleware.Recovery(), metrics.Middleware())
+	byIP, byClient := ratelimit.NewDefaultLimiters(ratelimit.NewMemoryStore())
+	if byIP != nil {
+		router.Use(byIP.Middleware())
+	}
+	router.Use(middleware.Authenticate(middleware.Authenticators{
+		Tokens:   authService,
+		APIKeys:  apiKeys,
+		Sessions: sessions,
+		OAuth:    oauth,
+	}))
+	router.Use(middleware.Audit(audit))
+	router.Use(middleware.VerifyCSRF())
+	router.Use(middleware.RequireScopes(scopedActions()))
+	router.Use(middleware.RestrictImpersonation(impersonationBlockedActions()))
+	router.Use(middleware.RequireActiveAccount(inactiveAccountActions()))
+	router.Use(middleware.RequireVerifiedEmail(verifiedEmailActions()))
+	if byClient != nil {
+		router.Use(byClient.Middleware())
+	}
+
+	postViews := views.NewPostViews(db)
 	postViews.RegisterRoutes(router)
 
-	userViews := views.NewUserViews()
+	userViews := views.NewUserViews(db, mailer)
 	userViews.RegisterRoutes(router)
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "healthy",
-			"service": "go-crud-api",
-		})
-	})
+	authViews := views.NewAuthViews(authService, services.NewPasswordResetService(db, mailer, workers.background), services.NewEmailVerificationService(db, mailer), services.NewEmailChangeService(db, mailer))
+	authViews.RegisterRoutes(router)
+
+	twoFactor := services.NewTwoFactorService(db)
+	twoFactorViews := views.NewTwoFactorViews(twoFactor)
+	twoFactorViews.RegisterRoutes(router)
+
+	sessionViews := views.NewSessionViews(authService, sessions)
+	sessionViews.RegisterRoutes(router)
+
+	apiKeyViews := views.NewAPIKeyViews(apiKeys)
+	apiKeyViews.RegisterRoutes(router)
+
+	oauthViews := views.NewOAuthViews(oauth)
+	oauthViews.RegisterRoutes(router)
+
+	externalLoginViews := views.NewExternalLoginViews(services.NewExternalLoginService(db, authService))
+	externalLoginViews.RegisterRoutes(router)
+
+	oauthClientViews := views.NewOAuthClientViews(oauth)
+	oauthClientViews.RegisterRoutes(router)
+
+	accountStatus := services.NewAccountStatusService(db)
+	accountViews := views.NewAccountViews(services.NewAccountDeletionService(db), services.NewDataExportService(db, workers.background), accountStatus)
+	accountViews.RegisterRoutes(router)
+
+	profileViews := views.NewProfileViews(services.NewProfileService(db))
+	profileViews.RegisterRoutes(router)
+
+	adminViews := views.NewAdminViews(authService, twoFactor, services.NewImpersonationService(db, tokens, audit), audit, accountStatus)
+	adminViews.RegisterRoutes(router)
+
+	registry := health.NewRegistry("go-crud-api", initializers.GetEnvDuration("HEALTH_CACHE_TTL", 2*time.Second))
+	registry.Register(health.DatabaseCheck(db, initializers.GetEnvDuration("HEALTH_DB_TIMEOUT", time.Second)))
+	registry.Register(health.MigrationCheck(db))
+	workers.readiness = registry
+
+	healthViews := views.NewHealthViews(registry)
+	healthViews.RegisterRoutes(router)
+
+	router.GET("/metrics", metrics.Handler())
 
 	// Swagger endpoint
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	return router
-}
\ No newline at end of file
+}
+
+// verifiedEmailActions lists the actions, as "METHOD /route" separated by
+// commas in EMAIL_VERIFICATION_REQUIRED, that need a verified email. None do
+// by default; e.g. "POST /posts" stops unverified users from posting.
+func verifiedEmailActions() []string {
+	actions := []string{}
+	for _, action := range strings.Split(initializers.GetEnv("EMAIL_VERIFICATION_REQUIRED", ""), ",") {
+		if action = strings.Join(strings.Fields(action), " "); action != "" {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// scopedActions maps each action an API key or OAuth client may perform to
+// the scope it needs. Everything else, including managing keys, clients and
+// account settings, needs the user's own login.
+func scopedActions() map[string]string {
+	return map[string]string{
+		"GET /posts":             models.ScopePostsRead,
+		"GET /posts/:id":         models.ScopePostsRead,
+		"POST /posts":            models.ScopePostsWrite,
+		"PUT /posts/:id":         models.ScopePostsWrite,
+		"PATCH /posts/:id":       models.ScopePostsWrite,
+		"DELETE /posts/:id":      models.ScopePostsWrite,
+		"GET /users/:id":         models.ScopeUsersRead,
+		"GET /users/:id/profile": models.ScopeUsersRead,
+		"GET /users/:id/avatar":  models.ScopeUsersRead,
+		"PATCH /users/:id":       models.ScopeUsersWrite,
+		"DELETE /users/:id":      models.ScopeUsersWrite,
+		"GET /oauth/userinfo":    models.ScopeOpenID,
+	}
+}
+
+// impersonationBlockedActions lists what an admin impersonating a user may
+// not do: change how the account is logged into, or hand out credentials
+// that would outlive the impersonation token.
+func impersonationBlockedActions() []string {
+	return []string{
+		"POST /users/me/password",
+		"POST /users/me/email",
+		"DELETE /users/:id",
+		"DELETE /users/me",
+		"POST /users/me/restore",
+		"POST /users/me/deactivate",
+		"POST /users/me/export",
+		"GET /users/me/export/:id/download",
+		"POST /users/me/2fa/enroll",
+		"GET /users/me/2fa/qr.png",
+		"POST /users/me/2fa/confirm",
+		"POST /users/me/api-keys",
+		"DELETE /users/me/api-keys/:id",
+		"DELETE /users/me/sessions",
+		"DELETE /users/me/sessions/:id",
+		"POST /oauth/clients",
+		"DELETE /oauth/clients/:client_id",
+		"GET /oauth/authorize",
+		"POST /oauth/authorize",
+	}
+}
+
+// inactiveAccountActions lists what suspended users can still do with
+// credentials issued before the suspension: log out, and take their data
+// with them or have it erased. Deactivated users hold no credentials; they
+// get their account back by logging in again.
+func inactiveAccountActions() []string {
+	return []string{
+		"DELETE /auth/session",
+		"POST /users/me/export",
+		"GET /users/me/export/:id",
+		"GET /users/me/export/:id/download",
+		"DELETE /users/me",
+	}
+}
+
+// trustedProxies lists the proxies allowed to set X-Forwarded-For, from the
+// comma-separated TRUSTED_PROXIES. By default no proxy is trusted, so the
+// client IP used for rate limiting and login protection cannot be spoofed.
+func trustedProxies() []string {
+	value := initializers.GetEnv("TRUSTED_PROXIES", "")
+	if value == "" {
+		return nil
+	}
+	proxies := []string{}
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"context"
+	"go-crud/health"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/services"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Workers are the jobs the API runs besides serving requests: the account
+// eraser, and work requests start without waiting for it, such as data
+// export builds
+type Workers struct {
+	db         *gorm.DB
+	background *services.Background
+	interval   time.Duration
+	eraser     health.Heartbeat
+	// readiness is the registry of the router the workers serve
+	readiness *health.Registry
+}
+
+// NewWorkers creates the workers for db, erasing accounts due for deletion
+// every ACCOUNT_DELETION_INTERVAL
+func NewWorkers(db *gorm.DB) *Workers {
+	return &Workers{
+		db:         db,
+		background: services.NewBackground(),
+		interval:   initializers.GetEnvDuration("ACCOUNT_DELETION_INTERVAL", time.Hour),
+	}
+}
+
+// Start fails data exports a previous process was building when it stopped
+// and starts the account eraser, which runs until ctx is cancelled.
+// Readiness reports the eraser as degraded once it has missed two passes in
+// a row.
+func (w *Workers) Start(ctx context.Context) {
+	if w.readiness != nil {
+		w.readiness.Register(health.HeartbeatCheck("account_eraser", &w.eraser, 2*w.interval+time.Minute, false))
+	}
+
+	exports := services.NewDataExportService(w.db, w.background)
+	if _, err := exports.FailInterrupted(ctx, time.Now()); err != nil {
+		logging.FromContext(ctx).Error("failed to recover interrupted data exports", "error", err)
+	}
+
+	deletion := services.NewAccountDeletionService(w.db)
+	w.background.Go(func() { deletion.Run(ctx, w.interval, &w.eraser) })
+}
+
+// Wait blocks until every background job has finished, or ctx is done. The
+// server runs it on shutdown, before the database is closed.
+func (w *Workers) Wait(ctx context.Context) error {
+	return w.background.Wait(ctx)
+}
@@ -0,0 +1,63 @@
+package schemas
+
+import (
+	"go-crud/models"
+	"time"
+)
+
+type ImpersonateInput struct {
+	Reason string `json:"reason" validate:"required,max=500" example:"Ticket #4521: user cannot see their drafts"`
+}
+
+// Method for ImpersonateInput struct
+func (i ImpersonateInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// ImpersonationResponse carries a short-lived access token acting as User.
+// There is no refresh token; start again once it expires.
+type ImpersonationResponse struct {
+	AccessToken string      `json:"access_token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	TokenType   string      `json:"token_type" example:"Bearer"`
+	ExpiresIn   int         `json:"expires_in" example:"900"`
+	User        models.User `json:"user"`
+	Message     string      `json:"message" example:"Impersonation started"`
+}
+
+// SuspendUserInput suspends a user; without Until the suspension lasts until
+// an admin reinstates them
+type SuspendUserInput struct {
+	Reason string     `json:"reason" validate:"required,max=500" example:"Posting spam"`
+	Until  *time.Time `json:"until" example:"2023-01-08T00:00:00Z"`
+}
+
+// Method for SuspendUserInput struct
+func (i SuspendUserInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// ListAuditLogsQueryParams filters the audit log; every filter is optional
+type ListAuditLogsQueryParams struct {
+	Page           int       `form:"page" validate:"omitempty,min=1" default:"1"`
+	Limit          int       `form:"limit" validate:"omitempty,min=1,max=100" default:"50"`
+	Action         string    `form:"action" example:"post.delete"`
+	ActorID        uint      `form:"actor_id" example:"7"`
+	ImpersonatorID uint      `form:"impersonator_id" example:"1"`
+	ResourceType   string    `form:"resource_type" example:"post"`
+	ResourceID     string    `form:"resource_id" example:"42"`
+	RequestID      string    `form:"request_id" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+	Since          time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00" example:"2023-01-01T00:00:00Z"`
+	Until          time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00" example:"2023-02-01T00:00:00Z"`
+}
+
+// Method for ListAuditLogsQueryParams struct
+func (q ListAuditLogsQueryParams) Validate() error {
+	return validate.Struct(q)
+}
+
+type ListAuditLogsResponse struct {
+	Data  []models.AuditLog `json:"data"`
+	Limit int               `json:"limit"`
+	Page  int               `json:"page"`
+	Total int               `json:"total"`
+}
@@ -0,0 +1,29 @@
+package schemas
+
+import (
+	"go-crud/models"
+	"time"
+)
+
+type CreateAPIKeyInput struct {
+	Name   string   `json:"name" validate:"required,max=100" example:"CI deploy"`
+	Scopes []string `json:"scopes" validate:"required,min=1" example:"posts:write"`
+	// ExpiresAt is optional; keys without it never expire
+	ExpiresAt *time.Time `json:"expires_at" example:"2024-01-01T00:00:00Z"`
+}
+
+// Method for CreateAPIKeyInput struct
+func (i CreateAPIKeyInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type CreateAPIKeyResponse struct {
+	Data models.APIKey `json:"data"`
+	// Key is the full API key. It is shown only once.
+	Key     string `json:"key" example:"gck_1a2b3c4d5e6f.9c8b7a..."`
+	Message string `json:"message" example:"API key created, store it now as it will not be shown again"`
+}
+
+type ListAPIKeysResponse struct {
+	Data []models.APIKey `json:"data"`
+}
@@ -0,0 +1,113 @@
+package schemas
+
+import (
+	"go-crud/logging"
+	"log/slog"
+)
+
+type LoginInput struct {
+	Email    string `json:"email" validate:"required,email" example:"connor@example.com"`
+	Password string `json:"password" validate:"required" example:"abcxyz123"`
+}
+
+// Method for LoginInput struct
+func (i LoginInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// LogValue keeps the password out of logs
+func (i LoginInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("email", i.Email),
+		slog.String("password", logging.Redacted),
+	)
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" validate:"required" example:"eyJhbGciOiJIUzI1NiIs..."`
+}
+
+// Method for RefreshTokenInput struct
+func (i RefreshTokenInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	RefreshToken string `json:"refresh_token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int    `json:"expires_in" example:"900"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email" example:"connor@example.com"`
+}
+
+// Method for ForgotPasswordInput struct
+func (i ForgotPasswordInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" validate:"required" example:"3f9a1c..."`
+	NewPassword string `json:"new_password" validate:"required" example:"Corr3ct-Horse-Battery"`
+}
+
+// Method for ResetPasswordInput struct
+func (i ResetPasswordInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// LogValue keeps the token and password out of logs
+func (i ResetPasswordInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("token", logging.Redacted),
+		slog.String("new_password", logging.Redacted),
+	)
+}
+
+type TwoFactorChallengeResponse struct {
+	ChallengeToken string `json:"challenge_token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	ExpiresIn      int    `json:"expires_in" example:"300"`
+	Message        string `json:"message" example:"Two-factor authentication required"`
+}
+
+type VerifyTwoFactorInput struct {
+	ChallengeToken string `json:"challenge_token" validate:"required" example:"eyJhbGciOiJIUzI1NiIs..."`
+	// Code is a 6-digit TOTP code or an unused recovery code
+	Code string `json:"code" validate:"required" example:"123456"`
+}
+
+// Method for VerifyTwoFactorInput struct
+func (i VerifyTwoFactorInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// LogValue keeps the challenge and code out of logs
+func (i VerifyTwoFactorInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("challenge_token", logging.Redacted),
+		slog.String("code", logging.Redacted),
+	)
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/go-crud:connor%40example.com?secret=JBSWY3DPEHPK3PXP&issuer=go-crud"`
+	// QRCodePNG is the otpauth URI as a base64 encoded PNG QR code
+	QRCodePNG []byte `json:"qr_code_png" swaggertype:"string" format:"base64"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" validate:"required,len=6,numeric" example:"123456"`
+}
+
+// Method for TwoFactorCodeInput struct
+func (i TwoFactorCodeInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"3f9a-1c2b-77d0-e4a5-90b1"`
+	Message       string   `json:"message" example:"Two-factor authentication enabled"`
+}
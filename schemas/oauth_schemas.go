@@ -0,0 +1,126 @@
+package schemas
+
+import (
+	"go-crud/logging"
+	"go-crud/models"
+	"log/slog"
+)
+
+type RegisterOAuthClientInput struct {
+	Name         string   `json:"name" validate:"required,max=100" example:"Partner Dashboard"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1,dive,required" example:"https://partner.example.com/callback"`
+	Scopes       []string `json:"scopes" validate:"required,min=1" example:"openid"`
+	// Public clients, such as mobile or single-page apps, cannot keep a
+	// secret and authenticate with PKCE alone
+	Public bool `json:"public" example:"false"`
+}
+
+// Method for RegisterOAuthClientInput struct
+func (i RegisterOAuthClientInput) Validate() error {
+	return validate.Struct(i)
+}
+
+type OAuthClientResponse struct {
+	Data models.OAuthClient `json:"data"`
+	// ClientSecret is only returned on registration, and only for
+	// confidential clients
+	ClientSecret string `json:"client_secret,omitempty" example:"4f1d..."`
+	Message      string `json:"message" example:"Client registered, store the secret now as it will not be shown again"`
+}
+
+type ListOAuthClientsResponse struct {
+	Data []models.OAuthClient `json:"data"`
+}
+
+// AuthorizeInput is an authorization request, sent as query parameters to
+// GET /oauth/authorize and as a form to POST /oauth/authorize
+type AuthorizeInput struct {
+	ResponseType        string `form:"response_type" example:"code"`
+	ClientID            string `form:"client_id" example:"gcc_8c6976e5b5410415"`
+	RedirectURI         string `form:"redirect_uri" example:"https://partner.example.com/callback"`
+	Scope               string `form:"scope" example:"openid email posts:read"`
+	State               string `form:"state" example:"af0ifjsldkj"`
+	CodeChallenge       string `form:"code_challenge" example:"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"`
+	CodeChallengeMethod string `form:"code_challenge_method" example:"S256"`
+	Nonce               string `form:"nonce" example:"n-0S6_WzA2Mj"`
+	// Prompt set to "consent" shows the consent screen even when the user
+	// already agreed
+	Prompt string `form:"prompt" example:"consent"`
+}
+
+// TokenInput is a token endpoint request, sent as a form
+type TokenInput struct {
+	GrantType    string `form:"grant_type" example:"authorization_code"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// LogValue keeps the code, verifier and secrets out of logs
+func (i TokenInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("grant_type", i.GrantType),
+		slog.String("client_id", i.ClientID),
+		slog.String("code", logging.Redacted),
+		slog.String("code_verifier", logging.Redacted),
+		slog.String("refresh_token", logging.Redacted),
+		slog.String("client_secret", logging.Redacted),
+	)
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token" example:"gcoa_3f9a1c..."`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int    `json:"expires_in" example:"3600"`
+	RefreshToken string `json:"refresh_token" example:"gcor_77d0e4..."`
+	Scope        string `json:"scope" example:"openid email posts:read"`
+	IDToken      string `json:"id_token,omitempty" example:"eyJhbGciOiJFUzI1NiIs..."`
+}
+
+// OAuthErrorResponse is the error format of RFC 6749 5.2
+type OAuthErrorResponse struct {
+	Error            string `json:"error" example:"invalid_grant"`
+	ErrorDescription string `json:"error_description,omitempty" example:"authorization code has expired"`
+}
+
+// IntrospectionResponse is the RFC 7662 token introspection response
+type IntrospectionResponse struct {
+	Active    bool   `json:"active" example:"true"`
+	Scope     string `json:"scope,omitempty" example:"posts:read"`
+	ClientID  string `json:"client_id,omitempty" example:"gcc_8c6976e5b5410415"`
+	Subject   string `json:"sub,omitempty" example:"1"`
+	TokenType string `json:"token_type,omitempty" example:"access_token"`
+	ExpiresAt int64  `json:"exp,omitempty" example:"1700000000"`
+	IssuedAt  int64  `json:"iat,omitempty" example:"1699996400"`
+}
+
+// UserInfoResponse is the OpenID Connect UserInfo response
+type UserInfoResponse struct {
+	Subject       string `json:"sub" example:"1"`
+	Name          string `json:"name,omitempty" example:"Connor Tran"`
+	Email         string `json:"email,omitempty" example:"connor@example.com"`
+	EmailVerified *bool  `json:"email_verified,omitempty" example:"true"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer" example:"http://localhost:8080"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
@@ -1,7 +1,9 @@
 package schemas
 
 import (
+	"context"
 	"go-crud/models"
+	"go-crud/tracing"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -89,7 +91,25 @@ type ListPostsResponse struct {
 }
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error   string        `json:"error"`
+	Code    string        `json:"code,omitempty" example:"password_policy"`
+	Details []ErrorDetail `json:"details,omitempty"`
+	TraceID string        `json:"trace_id,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+}
+
+// ErrorDetail is one machine-readable reason behind an ErrorResponse
+type ErrorDetail struct {
+	Code    string `json:"code" example:"password_too_short"`
+	Message string `json:"message" example:"password must be at least 10 characters"`
+}
+
+// NewErrorResponse builds an ErrorResponse tagged with the trace ID in ctx so
+// clients can quote it when reporting problems
+func NewErrorResponse(ctx context.Context, message string) ErrorResponse {
+	return ErrorResponse{
+		Error:   message,
+		TraceID: tracing.TraceID(ctx),
+	}
 }
 
 type MessageResponse struct {
@@ -0,0 +1,15 @@
+package schemas
+
+import "go-crud/models"
+
+type SessionResponse struct {
+	Data models.Session `json:"data"`
+	// CSRFToken must be sent as X-CSRF-Token on unsafe requests made with
+	// the session cookie
+	CSRFToken string `json:"csrf_token" example:"5d41402abc4b2a76b9719d911017c592"`
+	Message   string `json:"message" example:"Logged in"`
+}
+
+type ListSessionsResponse struct {
+	Data []models.Session `json:"data"`
+}
@@ -1,6 +1,14 @@
 package schemas
 
-import "go-crud/models"
+import (
+	"fmt"
+	"go-crud/avatar"
+	"go-crud/logging"
+	"go-crud/models"
+	"log/slog"
+	"strconv"
+	"time"
+)
 
 type CreateUserInput struct {
 	Name         string `json:"name" validate:"required" example:"Connor Tran"`
@@ -10,11 +18,141 @@ type CreateUserInput struct {
 
 type PartialUpdateUserInput struct {
 	Name  *string `json:"name" validate:"omitempty,min=3" example:"Connor Tran"`
-	Email *string `json:"email" validate:"omitempty,email" example:"connor@example.com"`
-	Password *string `json:"password" example:"abcxyz123"`
+	// Profile fields; an empty string clears one
+	DisplayName *string `json:"display_name" validate:"omitempty,max=50" example:"Connor"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500" example:"Backend developer, coffee enthusiast"`
+	Website     *string `json:"website" validate:"omitempty,max=200,http_url" example:"https://connortran.dev"`
+	Location    *string `json:"location" validate:"omitempty,max=100" example:"Ho Chi Minh City"`
+}
+
+// LogValue keeps the password out of logs
+func (i CreateUserInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", i.Name),
+		slog.String("email", i.Email),
+		slog.String("password", logging.Redacted),
+	)
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" validate:"required" example:"abcxyz123"`
+	NewPassword     string `json:"new_password" validate:"required" example:"Corr3ct-Horse-Battery"`
+}
+
+// Method for ChangePasswordInput struct
+func (i ChangePasswordInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// LogValue keeps both passwords out of logs
+func (i ChangePasswordInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("current_password", logging.Redacted),
+		slog.String("new_password", logging.Redacted),
+	)
+}
+
+type ChangeEmailInput struct {
+	NewEmail string `json:"new_email" validate:"required,email" example:"connor.tran@example.com"`
+	Password string `json:"password" validate:"required" example:"abcxyz123"`
+}
+
+// Method for ChangeEmailInput struct
+func (i ChangeEmailInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// LogValue keeps the password out of logs
+func (i ChangeEmailInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("new_email", i.NewEmail),
+		slog.String("password", logging.Redacted),
+	)
 }
 
 type UserResponse struct {
 	Data    models.User `json:"data"`
 	Message string      `json:"message" example:"User created successfully"`
 }
+
+type DeleteAccountInput struct {
+	Password string `json:"password" validate:"required" example:"abcxyz123"`
+}
+
+// Method for DeleteAccountInput struct
+func (i DeleteAccountInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// LogValue keeps the password out of logs
+func (i DeleteAccountInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("password", logging.Redacted),
+	)
+}
+
+type DeactivateAccountInput struct {
+	Password string `json:"password" validate:"required" example:"abcxyz123"`
+}
+
+// Method for DeactivateAccountInput struct
+func (i DeactivateAccountInput) Validate() error {
+	return validate.Struct(i)
+}
+
+// LogValue keeps the password out of logs
+func (i DeactivateAccountInput) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("password", logging.Redacted),
+	)
+}
+
+type DataExportResponse struct {
+	Data    models.DataExport `json:"data"`
+	Message string            `json:"message,omitempty" example:"Data export started"`
+}
+
+// Profile is the public view of a user. Email is only included for the user
+// themselves and admins.
+type Profile struct {
+	ID          uint   `json:"id" example:"1"`
+	Name        string `json:"name" example:"Connor Tran"`
+	DisplayName string `json:"display_name,omitempty" example:"Connor"`
+	Bio         string `json:"bio,omitempty" example:"Backend developer, coffee enthusiast"`
+	Website     string `json:"website,omitempty" example:"https://connortran.dev"`
+	Location    string `json:"location,omitempty" example:"Ho Chi Minh City"`
+	Email       string `json:"email,omitempty" example:"connortran@gmail.com"`
+	// Avatars maps each thumbnail size in pixels to its URL
+	Avatars   map[string]string `json:"avatars,omitempty"`
+	CreatedAt time.Time         `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// NewProfile builds the public profile of user, with their email if
+// showEmail is set
+func NewProfile(user models.User, showEmail bool) Profile {
+	profile := Profile{
+		ID:          user.ID,
+		Name:        user.Name,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Website:     user.Website,
+		Location:    user.Location,
+		CreatedAt:   user.CreatedAt,
+	}
+	if showEmail {
+		profile.Email = user.Email
+	}
+	if user.AvatarUpdatedAt != nil {
+		// The upload time busts caches when the avatar is replaced
+		profile.Avatars = make(map[string]string, len(avatar.Sizes))
+		for _, size := range avatar.Sizes {
+			profile.Avatars[strconv.Itoa(size)] = fmt.Sprintf("/users/%d/avatar?size=%d&v=%d", user.ID, size, user.AvatarUpdatedAt.Unix())
+		}
+	}
+	return profile
+}
+
+type ProfileResponse struct {
+	Data    Profile `json:"data"`
+	Message string  `json:"message,omitempty" example:"Avatar updated"`
+}
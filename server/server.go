@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Config holds the HTTP server settings, read from the environment
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	ShutdownTimeout   time.Duration
+}
+
+// LoadConfig reads the server settings from the environment, using defaults
+// for anything unset
+func LoadConfig() Config {
+	return Config{
+		Addr:              ":" + initializers.GetEnv("PORT", "8080"),
+		ReadTimeout:       initializers.GetEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: initializers.GetEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      initializers.GetEnvDuration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       initializers.GetEnvDuration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		MaxHeaderBytes:    initializers.GetEnvInt("HTTP_MAX_HEADER_BYTES", 1<<20),
+		ShutdownTimeout:   initializers.GetEnvDuration("HTTP_SHUTDOWN_TIMEOUT", 20*time.Second),
+	}
+}
+
+// Server wraps http.Server with graceful shutdown and cleanup hooks
+type Server struct {
+	config     Config
+	httpServer *http.Server
+	onShutdown []func(context.Context) error
+}
+
+// New creates a Server serving handler with the given config
+func New(handler http.Handler, config Config) *Server {
+	return &Server{
+		config: config,
+		httpServer: &http.Server{
+			Addr:              config.Addr,
+			Handler:           handler,
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+			MaxHeaderBytes:    config.MaxHeaderBytes,
+		},
+	}
+}
+
+// OnShutdown registers a hook that runs after in-flight requests have
+// drained, in registration order. Hooks share the shutdown deadline.
+func (s *Server) OnShutdown(hook func(context.Context) error) {
+	s.onShutdown = append(s.onShutdown, hook)
+}
+
+// Run listens on the configured address and serves until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve accepts connections on listener until ctx is cancelled, then stops
+// accepting new requests, waits up to ShutdownTimeout for in-flight ones and
+// runs the shutdown hooks.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("Listening on %s\n", listener.Addr())
+		serveErr <- s.httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down, draining in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	errs := []error{}
+	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain connections: %w", err))
+	}
+	for _, hook := range s.onShutdown {
+		if err := hook(shutdownCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-crud/health"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/tracing"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErasedUserName replaces the name of erased users
+const ErasedUserName = "Deleted user"
+
+var ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+
+// AccountDeletionService erases accounts on request. The user asks for
+// deletion and has a grace period to change their mind; after that the
+// account is anonymized rather than removed, so posts and audit entries
+// that reference it stay intact.
+type AccountDeletionService struct {
+	db    *gorm.DB
+	audit *AuditService
+	grace time.Duration
+	now   func() time.Time
+}
+
+// NewAccountDeletionService creates an AccountDeletionService with the grace
+// period from ACCOUNT_DELETION_GRACE_PERIOD
+func NewAccountDeletionService(db *gorm.DB) *AccountDeletionService {
+	return &AccountDeletionService{
+		db:    db,
+		audit: NewAuditService(db),
+		grace: initializers.GetEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+		now:   time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *AccountDeletionService) SetClock(now func() time.Time) {
+	s.now = now
+	s.audit.SetClock(now)
+}
+
+// Schedule checks the user's password and schedules the account for erasure
+// once the grace period ends. Every token and session is revoked; logging in
+// again and cancelling keeps the account.
+func (s *AccountDeletionService) Schedule(ctx context.Context, userID uint, password string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AccountDeletionService.Schedule")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("erased_at IS NULL").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	if !CheckHashedPassword(password, user.HashedPassword) {
+		logging.FromContext(ctx).Warn("account deletion rejected: wrong password", "user_id", user.ID)
+		return nil, ErrIncorrectPassword
+	}
+
+	due := s.now().Add(s.grace)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"deletion_scheduled_at": due,
+			"token_version":         gorm.Expr("token_version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return s.audit.RecordTx(ctx, tx, models.AuditLog{
+			Action:       models.AuditUserDeletionSchedule,
+			ResourceType: "user",
+			ResourceID:   strconv.FormatUint(uint64(user.ID), 10),
+			Details:      map[string]interface{}{"erase_at": due},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.DeletionScheduledAt = &due
+	logging.FromContext(ctx).Info("account deletion scheduled", "user_id", user.ID, "erase_at", due)
+	return &user, nil
+}
+
+// Cancel keeps an account that is scheduled for deletion
+func (s *AccountDeletionService) Cancel(ctx context.Context, userID uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AccountDeletionService.Cancel")
+	defer span.End()
+
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND deletion_scheduled_at IS NOT NULL AND erased_at IS NULL", userID).
+			Update("deletion_scheduled_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDeletionNotScheduled
+		}
+		if err := s.audit.RecordTx(ctx, tx, models.AuditLog{
+			Action:       models.AuditUserDeletionCancel,
+			ResourceType: "user",
+			ResourceID:   strconv.FormatUint(uint64(userID), 10),
+		}); err != nil {
+			return err
+		}
+		return tx.First(&user, userID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("account deletion cancelled", "user_id", user.ID)
+	return &user, nil
+}
+
+// EraseDue erases every account whose grace period has ended and returns how
+// many were erased
+func (s *AccountDeletionService) EraseDue(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "AccountDeletionService.EraseDue")
+	defer span.End()
+
+	var ids []uint
+	err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("deletion_scheduled_at <= ? AND erased_at IS NULL", s.now()).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if err := s.Erase(ctx, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// Run erases due accounts every interval until ctx is cancelled, beating
+// heartbeat after every pass that succeeds
+func (s *AccountDeletionService) Run(ctx context.Context, interval time.Duration, heartbeat *health.Heartbeat) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if count, err := s.EraseDue(ctx); err != nil {
+			logging.FromContext(ctx).Error("failed to erase accounts due for deletion", "error", err)
+		} else {
+			heartbeat.Beat()
+			if count > 0 {
+				logging.FromContext(ctx).Info("erased accounts due for deletion", "count", count)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Erase anonymizes the account right away: credentials, sessions, keys,
+// grants, pending tokens and the avatar are deleted and the profile is
+// blanked. Posts
+// stay, attributed to the anonymized account. The audit log is kept as the
+// record of what happened, but personal data in its earlier entries is
+// masked and the erasure entry itself holds none.
+func (s *AccountDeletionService) Erase(ctx context.Context, userID uint) error {
+	ctx, span := tracing.Start(ctx, "AccountDeletionService.Erase")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("erased_at IS NULL").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("user not found")
+		}
+		return err
+	}
+	hashed, err := HashPassword(randomToken(32))
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	now := s.now()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var clientIDs []string
+		if err := tx.Model(&models.OAuthClient{}).Where("owner_id = ?", user.ID).Pluck("client_id", &clientIDs).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.OAuthToken{}, &models.OAuthAuthorizationCode{}, &models.OAuthConsent{}} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+			// Grants other users gave to the user's clients go with them
+			if len(clientIDs) > 0 {
+				if err := tx.Where("client_id IN ?", clientIDs).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for _, model := range []interface{}{
+			&models.Session{},
+			&models.APIKey{},
+			&models.RecoveryCode{},
+			&models.PasswordResetToken{},
+			&models.EmailVerificationToken{},
+			&models.EmailChange{},
+			&models.ExternalIdentity{},
+			&models.AccountLockout{},
+			&models.DataExport{},
+			&models.Avatar{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("owner_id = ?", user.ID).Delete(&models.OAuthClient{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email = ?", user.Email).Delete(&models.LoginAttempt{}).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"name":                  ErasedUserName,
+			"email":                 fmt.Sprintf("erased-%d@erased.invalid", user.ID),
+			"hashed_password":       hashed,
+			"role":                  models.RoleUser,
+			"display_name":          "",
+			"bio":                   "",
+			"website":               "",
+			"location":              "",
+			"status":                models.UserStatusActive,
+			"status_reason":         "",
+			"status_until":          nil,
+			"avatar_updated_at":     nil,
+			"email_verified_at":     nil,
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+			"totp_secret":           "",
+			"two_factor_enabled_at": nil,
+			"token_version":         gorm.Expr("token_version + 1"),
+			"deletion_scheduled_at": nil,
+			"erased_at":             now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := s.audit.ErasePersonalData(ctx, tx, "user", user.ID, models.User{}); err != nil {
+			return err
+		}
+		return s.audit.RecordTx(ctx, tx, models.AuditLog{
+			Action:       models.AuditUserDelete,
+			ResourceType: "user",
+			ResourceID:   strconv.FormatUint(uint64(user.ID), 10),
+		})
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to erase user", "user_id", user.ID, "error", err)
+		return err
+	}
+
+	logging.FromContext(ctx).Info("user erased", "user_id", user.ID)
+	return nil
+}
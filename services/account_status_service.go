@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/tracing"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSuspendSelf = errors.New("admins cannot suspend themselves")
+	// ErrSuspensionEnded is returned for a suspension whose end is not in
+	// the future
+	ErrSuspensionEnded   = errors.New("suspension must end in the future")
+	ErrAccountNotBlocked = errors.New("account is already active")
+)
+
+// AccountInactiveError is returned when a deactivated or suspended account
+// tries to log in or get new tokens
+type AccountInactiveError struct {
+	Status string
+	Reason string
+	// Until is when a suspension ends, if it does
+	Until *time.Time
+}
+
+func (e *AccountInactiveError) Error() string {
+	return "account is " + e.Status
+}
+
+// checkActive returns an AccountInactiveError unless the user's account is
+// active at now
+func checkActive(user *models.User, now time.Time) error {
+	if user.IsActive(now) {
+		return nil
+	}
+	return &AccountInactiveError{
+		Status: user.StatusAt(now),
+		Reason: user.StatusReason,
+		Until:  user.StatusUntil,
+	}
+}
+
+// AccountStatusService moves accounts between the active, deactivated and
+// suspended states. Users deactivate their own account and reopen it by
+// logging in again; admins suspend accounts and reinstate both kinds.
+type AccountStatusService struct {
+	db    *gorm.DB
+	audit *AuditService
+	now   func() time.Time
+}
+
+func NewAccountStatusService(db *gorm.DB) *AccountStatusService {
+	return &AccountStatusService{
+		db:    db,
+		audit: NewAuditService(db),
+		now:   time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *AccountStatusService) SetClock(now func() time.Time) {
+	s.now = now
+	s.audit.SetClock(now)
+}
+
+// Deactivate checks the user's password and closes their account until they
+// log in again or an admin reinstates it. Every token and session is revoked.
+func (s *AccountStatusService) Deactivate(ctx context.Context, userID uint, password string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AccountStatusService.Deactivate")
+	defer span.End()
+
+	user, err := s.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !CheckHashedPassword(password, user.HashedPassword) {
+		logging.FromContext(ctx).Warn("account deactivation rejected: wrong password", "user_id", user.ID)
+		return nil, ErrIncorrectPassword
+	}
+
+	updates := map[string]interface{}{
+		"status":        models.UserStatusDeactivated,
+		"status_reason": "",
+		"status_until":  nil,
+		"token_version": gorm.Expr("token_version + 1"),
+	}
+	if err := s.change(ctx, user, models.AuditUserDeactivate, updates, nil); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("account deactivated", "user_id", user.ID)
+	return user, nil
+}
+
+// Reactivate reopens an account its owner deactivated, once they have
+// logged in again. The audit entry names the user as the actor, since
+// logging in happens before there is an authenticated request.
+func (s *AccountStatusService) Reactivate(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "AccountStatusService.Reactivate")
+	defer span.End()
+
+	if user.StatusAt(s.now()) != models.UserStatusDeactivated {
+		return ErrAccountNotBlocked
+	}
+
+	audit := AuditContextFrom(ctx)
+	audit.ActorID = &user.ID
+	ctx = WithAuditContext(ctx, audit)
+
+	updates := map[string]interface{}{
+		"status":        models.UserStatusActive,
+		"status_reason": "",
+		"status_until":  nil,
+	}
+	if err := s.change(ctx, user, models.AuditUserReactivate, updates, nil); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("account reactivated", "user_id", user.ID)
+	return nil
+}
+
+// Suspend stops the user logging in or making changes, until the given time
+// or, when until is nil, until an admin reinstates them. The reason is shown
+// to the user when they try to log in.
+func (s *AccountStatusService) Suspend(ctx context.Context, userID, adminID uint, reason string, until *time.Time) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AccountStatusService.Suspend")
+	defer span.End()
+
+	if userID == adminID {
+		return nil, ErrSuspendSelf
+	}
+	if until != nil && !until.After(s.now()) {
+		return nil, ErrSuspensionEnded
+	}
+	user, err := s.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"status":        models.UserStatusSuspended,
+		"status_reason": reason,
+		"status_until":  until,
+	}
+	details := map[string]interface{}{"reason": reason}
+	if until != nil {
+		details["until"] = until
+	}
+	if err := s.change(ctx, user, models.AuditUserSuspend, updates, details); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("account suspended", "user_id", user.ID, "admin_id", adminID, "until", until)
+	return user, nil
+}
+
+// Reinstate makes a deactivated or suspended account active again
+func (s *AccountStatusService) Reinstate(ctx context.Context, userID, adminID uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AccountStatusService.Reinstate")
+	defer span.End()
+
+	user, err := s.find(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	previous := user.StatusAt(s.now())
+	if previous == models.UserStatusActive {
+		return nil, ErrAccountNotBlocked
+	}
+
+	updates := map[string]interface{}{
+		"status":        models.UserStatusActive,
+		"status_reason": "",
+		"status_until":  nil,
+	}
+	details := map[string]interface{}{"previous_status": previous}
+	if err := s.change(ctx, user, models.AuditUserReinstate, updates, details); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("account reinstated", "user_id", user.ID, "admin_id", adminID, "previous_status", previous)
+	return user, nil
+}
+
+func (s *AccountStatusService) find(ctx context.Context, userID uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("erased_at IS NULL").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// change applies updates to the user and records action in the audit log,
+// in one transaction, then reloads the user
+func (s *AccountStatusService) change(ctx context.Context, user *models.User, action string, updates, details map[string]interface{}) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		err := s.audit.RecordTx(ctx, tx, models.AuditLog{
+			Action:       action,
+			ResourceType: "user",
+			ResourceID:   strconv.FormatUint(uint64(user.ID), 10),
+			Details:      details,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.First(user, user.ID).Error
+	})
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/tracing"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAPIKey    = errors.New("invalid or expired API key")
+	ErrAPIKeyNotFound   = errors.New("API key not found")
+	ErrInvalidAPIExpiry = errors.New("API key expiry must be in the future")
+)
+
+// apiKeyPrefix marks personal API keys so they are easy to recognise, e.g.
+// by secret scanners
+const apiKeyPrefix = "gck_"
+
+// lastUsedResolution limits how often a busy key's LastUsedAt is written
+const lastUsedResolution = time.Minute
+
+// UnknownScopeError is returned when an API key is requested with a scope
+// that does not exist
+type UnknownScopeError struct {
+	Scope string
+}
+
+func (e *UnknownScopeError) Error() string {
+	return fmt.Sprintf("unknown scope %q, expected one of %s", e.Scope, strings.Join(models.APIKeyScopes, ", "))
+}
+
+// APIKeyLimitError is returned when a user already holds the maximum number
+// of API keys
+type APIKeyLimitError struct {
+	Limit int
+}
+
+func (e *APIKeyLimitError) Error() string {
+	return fmt.Sprintf("at most %d API keys are allowed, revoke one first", e.Limit)
+}
+
+// APIKeyService issues, lists, revokes and authenticates personal API keys
+type APIKeyService struct {
+	db      *gorm.DB
+	maxKeys int
+	now     func() time.Time
+}
+
+// NewAPIKeyService creates an APIKeyService; API_KEY_LIMIT caps how many keys
+// one user can hold
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{
+		db:      db,
+		maxKeys: initializers.GetEnvInt("API_KEY_LIMIT", 20),
+		now:     time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *APIKeyService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Create issues a new key for the user and returns it along with the full
+// key, which is never available again
+func (s *APIKeyService) Create(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Create")
+	defer span.End()
+
+	for _, scope := range scopes {
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			return nil, "", &UnknownScopeError{Scope: scope}
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(s.now()) {
+		return nil, "", ErrInvalidAPIExpiry
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, "", err
+	}
+	if err := s.pruneRevoked(ctx, user); err != nil {
+		return nil, "", err
+	}
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.APIKey{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if s.maxKeys > 0 && int(count) >= s.maxKeys {
+		return nil, "", &APIKeyLimitError{Limit: s.maxKeys}
+	}
+
+	secret := randomToken(32)
+	key := models.APIKey{
+		UserID:       userID,
+		Name:         name,
+		Prefix:       apiKeyPrefix + randomToken(6),
+		SecretHash:   hashToken(secret),
+		Scopes:       slices.Compact(slices.Sorted(slices.Values(scopes))),
+		ExpiresAt:    expiresAt,
+		TokenVersion: user.TokenVersion,
+	}
+	if err := s.db.WithContext(ctx).Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+
+	logging.FromContext(ctx).Info("API key created", "user_id", userID, "api_key_id", key.ID, "scopes", key.Scopes)
+	return &key, key.Prefix + "." + secret, nil
+}
+
+// List returns the user's keys, newest first
+func (s *APIKeyService) List(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.List")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.pruneRevoked(ctx, user); err != nil {
+		return nil, err
+	}
+	var keys []models.APIKey
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// pruneRevoked deletes the user's keys issued before they last revoked
+// their tokens, which no longer work
+func (s *APIKeyService) pruneRevoked(ctx context.Context, user models.User) error {
+	return s.db.WithContext(ctx).
+		Where("user_id = ? AND token_version <> ?", user.ID, user.TokenVersion).
+		Delete(&models.APIKey{}).Error
+}
+
+// Revoke deletes one of the user's keys; it stops working immediately
+func (s *APIKeyService) Revoke(ctx context.Context, userID, keyID uint) error {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Revoke")
+	defer span.End()
+
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", keyID, userID).Delete(&models.APIKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	logging.FromContext(ctx).Info("API key revoked", "user_id", userID, "api_key_id", keyID)
+	return nil
+}
+
+// Authenticate checks a full "<prefix>.<secret>" key and returns the key and
+// the user it belongs to. Keys issued before the user last revoked their
+// tokens, e.g. by changing their password, are deleted.
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey string) (*models.User, *models.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Authenticate")
+	defer span.End()
+
+	prefix, secret, found := strings.Cut(rawKey, ".")
+	if !found || !strings.HasPrefix(prefix, apiKeyPrefix) || secret == "" {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := s.db.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+	now := s.now()
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(key.SecretHash)) != 1 || key.IsExpired(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, key.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+	if user.TokenVersion != key.TokenVersion {
+		if err := s.db.WithContext(ctx).Delete(&key).Error; err != nil {
+			logging.FromContext(ctx).Warn("failed to delete revoked API key", "api_key_id", key.ID, "error", err)
+		}
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		// Usage tracking must not fail the request
+		if err := s.db.WithContext(ctx).Model(&key).Update("last_used_at", now).Error; err != nil {
+			logging.FromContext(ctx).Warn("failed to record API key use", "api_key_id", key.ID, "error", err)
+		}
+	}
+	return &user, &key, nil
+}
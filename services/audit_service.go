@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/tracing"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// auditExportBatchSize is how many entries an export loads at a time
+const auditExportBatchSize = 500
+
+// personalDetails lists the Details keys that hold free text about the
+// resource, such as the reason given for a suspension
+var personalDetails = []string{"reason"}
+
+// AuditContext describes the request an audited action was made in
+type AuditContext struct {
+	// ActorID is the authenticated user, unset for anonymous requests
+	ActorID   *uint
+	IP        string
+	RequestID string
+	// ImpersonatorID is the admin behind the request when impersonating
+	ImpersonatorID *uint
+}
+
+type auditContextKey struct{}
+
+// WithAuditContext returns a copy of ctx carrying the request's audit details
+func WithAuditContext(ctx context.Context, audit AuditContext) context.Context {
+	return context.WithValue(ctx, auditContextKey{}, audit)
+}
+
+// AuditContextFrom returns the audit details stored in ctx, if any
+func AuditContextFrom(ctx context.Context) AuditContext {
+	audit, _ := ctx.Value(auditContextKey{}).(AuditContext)
+	return audit
+}
+
+// AuditService appends entries to the audit log and reads them back
+type AuditService struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *AuditService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Record appends entry to the audit log, filling in the request details from
+// ctx where the entry leaves them empty
+func (s *AuditService) Record(ctx context.Context, entry models.AuditLog) error {
+	return s.RecordTx(ctx, s.db.WithContext(ctx), entry)
+}
+
+// RecordTx appends entry to the audit log within tx, so the entry is only
+// kept if the change it describes is committed
+func (s *AuditService) RecordTx(ctx context.Context, tx *gorm.DB, entry models.AuditLog) error {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer span.End()
+
+	audit := AuditContextFrom(ctx)
+	if entry.ActorID == nil {
+		entry.ActorID = audit.ActorID
+	}
+	if entry.IP == "" {
+		entry.IP = audit.IP
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = audit.RequestID
+	}
+	if entry.ImpersonatorID == nil {
+		entry.ImpersonatorID = audit.ImpersonatorID
+	}
+	entry.CreatedAt = s.now()
+	if err := tx.Create(&entry).Error; err != nil {
+		logging.FromContext(ctx).Error("failed to write audit log", "action", entry.Action, "error", err)
+		return err
+	}
+	return nil
+}
+
+// RecordChange appends an entry for a change to a model within tx. before is
+// nil for creations and after is nil for deletions; for updates only the
+// fields that differ are kept. Fields tagged `audit:"secret"` are masked.
+func (s *AuditService) RecordChange(ctx context.Context, tx *gorm.DB, action, resourceType string, id uint, before, after interface{}) error {
+	entry := models.AuditLog{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   strconv.FormatUint(uint64(id), 10),
+	}
+	beforeFields, secrets := auditSnapshot(before)
+	afterFields, afterSecrets := auditSnapshot(after)
+	secrets = append(secrets, afterSecrets...)
+	if beforeFields != nil && afterFields != nil {
+		for column, value := range beforeFields {
+			if reflect.DeepEqual(value, afterFields[column]) {
+				delete(beforeFields, column)
+				delete(afterFields, column)
+			}
+		}
+	}
+	// Masked after diffing, so a changed secret still shows as changed
+	for _, fields := range []map[string]interface{}{beforeFields, afterFields} {
+		for _, column := range secrets {
+			if value, ok := fields[column]; ok && value != "" {
+				fields[column] = logging.Redacted
+			}
+		}
+	}
+	entry.Before, entry.After = beforeFields, afterFields
+	return s.RecordTx(ctx, tx, entry)
+}
+
+// ErasePersonalData masks the fields of model tagged `audit:"personal"` in
+// the snapshots of every entry about the resource, along with free-text
+// details, and clears the IP of every entry about it or made by it, within
+// tx. It is the one exception to
+// the audit log being append-only, so it bypasses the entries' hooks.
+func (s *AuditService) ErasePersonalData(ctx context.Context, tx *gorm.DB, resourceType string, id uint, model interface{}) error {
+	ctx, span := tracing.Start(ctx, "AuditService.ErasePersonalData")
+	defer span.End()
+
+	resourceID := strconv.FormatUint(uint64(id), 10)
+	personal := auditColumns(model, "personal")
+	var entries []models.AuditLog
+	err := tx.Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).
+		Or("actor_id = ?", id).
+		Find(&entries).Error
+	if err != nil {
+		return err
+	}
+
+	unhooked := tx.Session(&gorm.Session{SkipHooks: true})
+	for _, entry := range entries {
+		if entry.ResourceType == resourceType && entry.ResourceID == resourceID {
+			for _, fields := range []map[string]interface{}{entry.Before, entry.After} {
+				for _, column := range personal {
+					if value, ok := fields[column]; ok && value != "" {
+						fields[column] = logging.Redacted
+					}
+				}
+			}
+			for _, key := range personalDetails {
+				if value, ok := entry.Details[key]; ok && value != "" {
+					entry.Details[key] = logging.Redacted
+				}
+			}
+		}
+		entry.IP = ""
+		if err := unhooked.Model(&entry).Select("before", "after", "details", "ip").Updates(&entry).Error; err != nil {
+			logging.FromContext(ctx).Error("failed to erase audit log entry", "audit_log_id", entry.ID, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns a page of audit log entries matching query, newest first,
+// and the number of matching entries
+func (s *AuditService) List(ctx context.Context, query schemas.ListAuditLogsQueryParams) ([]models.AuditLog, int64, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.List")
+	defer span.End()
+
+	var total int64
+	if err := s.filter(ctx, query).Model(&models.AuditLog{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	entries := []models.AuditLog{}
+	offset := (query.Page - 1) * query.Limit
+	err := s.filter(ctx, query).Order("id DESC").Limit(query.Limit).Offset(offset).Find(&entries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// Export passes every entry matching query to fn, oldest first, loading them
+// in batches so exports of any size use bounded memory. Paging is ignored.
+func (s *AuditService) Export(ctx context.Context, query schemas.ListAuditLogsQueryParams, fn func(models.AuditLog) error) error {
+	ctx, span := tracing.Start(ctx, "AuditService.Export")
+	defer span.End()
+
+	var batch []models.AuditLog
+	return s.filter(ctx, query).Order("id").FindInBatches(&batch, auditExportBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func (s *AuditService) filter(ctx context.Context, query schemas.ListAuditLogsQueryParams) *gorm.DB {
+	db := s.db.WithContext(ctx)
+	if query.Action != "" {
+		db = db.Where("action = ?", query.Action)
+	}
+	if query.ActorID != 0 {
+		db = db.Where("actor_id = ?", query.ActorID)
+	}
+	if query.ImpersonatorID != 0 {
+		db = db.Where("impersonator_id = ?", query.ImpersonatorID)
+	}
+	if query.ResourceType != "" {
+		db = db.Where("resource_type = ?", query.ResourceType)
+	}
+	if query.ResourceID != "" {
+		db = db.Where("resource_id = ?", query.ResourceID)
+	}
+	if query.RequestID != "" {
+		db = db.Where("request_id = ?", query.RequestID)
+	}
+	if !query.Since.IsZero() {
+		db = db.Where("created_at >= ?", query.Since)
+	}
+	if !query.Until.IsZero() {
+		db = db.Where("created_at < ?", query.Until)
+	}
+	return db
+}
+
+// auditSnapshot maps a model's column names to its field values and lists
+// the columns holding secrets. It returns nil for a nil model.
+func auditSnapshot(model interface{}) (map[string]interface{}, []string) {
+	value := reflect.ValueOf(model)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil, nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	naming := schema.NamingStrategy{}
+	snapshot := map[string]interface{}{}
+	var secrets []string
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		column := naming.ColumnName("", field.Name)
+		if field.Tag.Get("audit") == "secret" {
+			secrets = append(secrets, column)
+		}
+		switch {
+		case field.Type.Kind() != reflect.Pointer:
+			snapshot[column] = value.Field(i).Interface()
+		case value.Field(i).IsNil():
+			snapshot[column] = nil
+		default:
+			snapshot[column] = value.Field(i).Elem().Interface()
+		}
+	}
+	return snapshot, secrets
+}
+
+// auditColumns lists the columns of model whose fields carry the given
+// audit tag
+func auditColumns(model interface{}, tag string) []string {
+	kind := reflect.TypeOf(model)
+	for kind.Kind() == reflect.Pointer {
+		kind = kind.Elem()
+	}
+	if kind.Kind() != reflect.Struct {
+		return nil
+	}
+
+	naming := schema.NamingStrategy{}
+	var columns []string
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		if field.IsExported() && field.Tag.Get("audit") == tag {
+			columns = append(columns, naming.ColumnName("", field.Name))
+		}
+	}
+	return columns
+}
@@ -1,17 +1,564 @@
 package services
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/tracing"
+	"sync"
+	"time"
 
+	"gorm.io/gorm"
+)
 
+// HashPassword hashes password with the default hasher's preferred algorithm
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return DefaultPasswordHasher().Hash(password)
+}
+
+// CheckHashedPassword reports whether password matches hash, whichever
+// supported algorithm produced it
+func CheckHashedPassword(password, hash string) bool {
+	ok, err := DefaultPasswordHasher().Verify(password, hash)
+	return ok && err == nil
+}
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrAccountLocked      = errors.New("account is temporarily locked")
+	ErrIncorrectPassword  = errors.New("current password is incorrect")
+)
+
+// TooManyAttemptsError is returned when a login is refused because of recent
+// failures; the caller may retry after RetryAfter
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// TwoFactorRequiredError is returned by Login when the password was right but
+// the account has two-factor enabled. ChallengeToken completes the login
+// through VerifyTwoFactor within ExpiresIn.
+type TwoFactorRequiredError struct {
+	ChallengeToken string
+	ExpiresIn      time.Duration
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "two-factor authentication required"
+}
+
+// LoginPolicy configures brute-force protection on login
+type LoginPolicy struct {
+	// MaxFailures consecutive wrong passwords lock the account for LockoutDuration
+	MaxFailures     int
+	LockoutDuration time.Duration
+	// Window is how far back failures are counted for delays and IP limits
+	Window time.Duration
+	// IPMaxFailures failures from one IP within Window block that IP
+	IPMaxFailures int
+	// After DelayAfter failures within Window, each further attempt on the
+	// account must wait DelayBase, doubling per failure up to DelayMax
+	DelayAfter int
+	DelayBase  time.Duration
+	DelayMax   time.Duration
+}
+
+// LoadLoginPolicy reads the login policy from the environment
+func LoadLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		MaxFailures:     initializers.GetEnvInt("LOGIN_MAX_FAILURES", 10),
+		LockoutDuration: initializers.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 30*time.Minute),
+		Window:          initializers.GetEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		IPMaxFailures:   initializers.GetEnvInt("LOGIN_IP_MAX_FAILURES", 50),
+		DelayAfter:      initializers.GetEnvInt("LOGIN_DELAY_AFTER", 3),
+		DelayBase:       initializers.GetEnvDuration("LOGIN_DELAY_BASE", time.Second),
+		DelayMax:        initializers.GetEnvDuration("LOGIN_DELAY_MAX", 30*time.Second),
+	}
+}
+
+// AuthService handles login, token refresh, password changes and account
+// lockout
+type AuthService struct {
+	db             *gorm.DB
+	tokens         *TokenService
+	policy         LoginPolicy
+	passwordPolicy PasswordPolicy
+	twoFactor      *TwoFactorService
+	statuses       *AccountStatusService
+	now            func() time.Time
+}
+
+// NewAuthService creates a new AuthService instance backed by db
+func NewAuthService(db *gorm.DB, tokens *TokenService, policy LoginPolicy) *AuthService {
+	return &AuthService{
+		db:             db,
+		tokens:         tokens,
+		policy:         policy,
+		passwordPolicy: LoadPasswordPolicy(),
+		twoFactor:      NewTwoFactorService(db),
+		statuses:       NewAccountStatusService(db),
+		now:            time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *AuthService) SetClock(now func() time.Time) {
+	s.now = now
+	s.twoFactor.SetClock(now)
+	s.statuses.SetClock(now)
+}
+
+// Login checks the credentials and issues a token pair, enforcing per-IP
+// limits, progressive per-account delays and account lockout
+func (s *AuthService) Login(ctx context.Context, email, password, ip string) (*models.User, *TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Login")
+	defer span.End()
+
+	now := s.now()
+	if err := s.checkThrottle(ctx, email, ip, now); err != nil {
+		return nil, nil, err
+	}
+
+	var user models.User
+	result := s.db.WithContext(ctx).Where("email = ?", email).First(&user)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, result.Error
+		}
+		// Spend as long as a real check would, so response times do not
+		// reveal which emails are registered
+		CheckHashedPassword(password, dummyHash())
+		s.recordAttempt(ctx, email, ip, false, now)
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	// A wrong password gets the same answer whether or not the account is
+	// locked, so the lock does not reveal that the email is registered
+	if !CheckHashedPassword(password, user.HashedPassword) {
+		s.recordAttempt(ctx, email, ip, false, now)
+		if user.IsLocked(now) {
+			return nil, nil, ErrInvalidCredentials
+		}
+		if err := s.registerFailure(ctx, &user, ip, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidCredentials
+	}
+	if user.IsLocked(now) {
+		s.recordAttempt(ctx, email, ip, false, now)
+		return nil, nil, ErrAccountLocked
+	}
+
+	s.upgradeHash(ctx, &user, password)
+	return s.firstFactorAccepted(ctx, &user, ip, now)
+}
+
+// LoginExternal logs in a user who has been authenticated by an external
+// identity provider. Lockout and two-factor still apply.
+func (s *AuthService) LoginExternal(ctx context.Context, user *models.User, ip string) (*models.User, *TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.LoginExternal")
+	defer span.End()
+
+	// The provider has proven who the caller is, so the lock can be revealed
+	now := s.now()
+	if user.IsLocked(now) {
+		s.recordAttempt(ctx, user.Email, ip, false, now)
+		return nil, nil, ErrAccountLocked
+	}
+	return s.firstFactorAccepted(ctx, user, ip, now)
+}
+
+// VerifyTwoFactor completes a login that Login answered with a
+// TwoFactorRequiredError. Wrong codes count towards the same delays and
+// lockout as wrong passwords.
+func (s *AuthService) VerifyTwoFactor(ctx context.Context, challengeToken, code, ip string) (*models.User, *TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.VerifyTwoFactor")
+	defer span.End()
+
+	user, _, err := s.verify(ctx, challengeToken, ChallengeToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := s.now()
+	if err := s.checkThrottle(ctx, user.Email, ip, now); err != nil {
+		return nil, nil, err
+	}
+	// Only someone who knew the password holds a challenge, so the lock can
+	// be revealed
+	if user.IsLocked(now) {
+		s.recordAttempt(ctx, user.Email, ip, false, now)
+		return nil, nil, ErrAccountLocked
+	}
+
+	ok, err := s.twoFactor.Verify(ctx, user, code)
 	if err != nil {
-		return "This password is invalid, please try a new one", err
+		return nil, nil, err
+	}
+	if !ok {
+		s.recordAttempt(ctx, user.Email, ip, false, now)
+		if err := s.registerFailure(ctx, user, ip, now); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidTwoFactorCode
 	}
-	return string(bytes), nil
+
+	return s.completeLogin(ctx, user, ip, now)
 }
 
-func CheckHashedPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
-}
\ No newline at end of file
+// Refresh exchanges a valid refresh token for a new token pair, unless the
+// account has since been deactivated or suspended
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Refresh")
+	defer span.End()
+
+	user, _, err := s.verify(ctx, refreshToken, RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActive(user, s.now()); err != nil {
+		return nil, err
+	}
+
+	return s.tokens.Issue(*user)
+}
+
+// Authenticate verifies an access token and checks it has not been revoked,
+// returning the user it was issued to and, for impersonation tokens, the
+// admin acting as them
+func (s *AuthService) Authenticate(ctx context.Context, accessToken string) (*models.User, *models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Authenticate")
+	defer span.End()
+
+	user, claims, err := s.verify(ctx, accessToken, AccessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.Actor == nil {
+		return user, nil, nil
+	}
+
+	// The admin must still be an admin, with their tokens not revoked
+	var impersonator models.User
+	if err := s.db.WithContext(ctx).First(&impersonator, claims.Actor.UserID()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	if impersonator.Role != models.RoleAdmin || impersonator.TokenVersion != claims.Actor.Version {
+		return nil, nil, ErrInvalidToken
+	}
+	return user, &impersonator, nil
+}
+
+// ChangePassword replaces the user's password after checking the current one,
+// and revokes every token issued so far. The caller gets a fresh token pair.
+func (s *AuthService) ChangePassword(ctx context.Context, userID uint, currentPassword, newPassword string) (*TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.ChangePassword")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	if !CheckHashedPassword(currentPassword, user.HashedPassword) {
+		logging.FromContext(ctx).Warn("password change rejected: wrong current password", "user_id", user.ID)
+		return nil, ErrIncorrectPassword
+	}
+	if err := s.passwordPolicy.Check(ctx, newPassword, user.Name, user.Email); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+
+	err = s.db.WithContext(ctx).Model(&user).Updates(map[string]interface{}{
+		"hashed_password": hashedPassword,
+		"token_version":   gorm.Expr("token_version + 1"),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Select("token_version").First(&user, user.ID).Error; err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("password changed, existing tokens revoked", "user_id", user.ID)
+	return s.tokens.Issue(user)
+}
+
+// verify parses tokenString and rejects it if the user no longer exists or
+// has revoked their tokens since it was issued
+func (s *AuthService) verify(ctx context.Context, tokenString, tokenType string) (*models.User, *TokenClaims, error) {
+	claims, err := s.tokens.Parse(tokenString, tokenType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, claims.UserID()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	if claims.Version != user.TokenVersion {
+		return nil, nil, ErrInvalidToken
+	}
+	return &user, claims, nil
+}
+
+// Unlock clears a lockout early on behalf of the admin adminID
+func (s *AuthService) Unlock(ctx context.Context, userID, adminID uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Unlock")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	now := s.now()
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.AccountLockout{}).
+			Where("user_id = ? AND unlocked_at IS NULL AND locked_until > ?", user.ID, now).
+			Updates(map[string]interface{}{
+				"unlocked_at":    now,
+				"unlocked_by_id": adminID,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+	logging.FromContext(ctx).Info("account unlocked", "user_id", user.ID, "admin_id", adminID)
+	return &user, nil
+}
+
+// checkThrottle refuses the attempt if the IP has failed too often recently,
+// or the account's progressive delay since its last failure has not elapsed
+func (s *AuthService) checkThrottle(ctx context.Context, email, ip string, now time.Time) error {
+	windowStart := now.Add(-s.policy.Window)
+
+	var ipFailures int64
+	err := s.db.WithContext(ctx).Model(&models.LoginAttempt{}).
+		Where("ip = ? AND success = ? AND created_at > ?", ip, false, windowStart).
+		Count(&ipFailures).Error
+	if err != nil {
+		return err
+	}
+	if s.policy.IPMaxFailures > 0 && ipFailures >= int64(s.policy.IPMaxFailures) {
+		logging.FromContext(ctx).Warn("login blocked for ip", "ip", ip, "failures", ipFailures)
+		return &TooManyAttemptsError{RetryAfter: s.policy.Window}
+	}
+
+	// Only failures since the last successful login count towards the delay
+	since := windowStart
+	var lastSuccess models.LoginAttempt
+	err = s.db.WithContext(ctx).Where("email = ? AND success = ?", email, true).
+		Order("created_at desc").Limit(1).Find(&lastSuccess).Error
+	if err != nil {
+		return err
+	}
+	if lastSuccess.ID != 0 && lastSuccess.CreatedAt.After(since) {
+		since = lastSuccess.CreatedAt
+	}
+
+	var failures []models.LoginAttempt
+	err = s.db.WithContext(ctx).Where("email = ? AND success = ? AND created_at > ?", email, false, since).
+		Order("created_at desc").Find(&failures).Error
+	if err != nil {
+		return err
+	}
+	if s.policy.DelayBase <= 0 || len(failures) < s.policy.DelayAfter {
+		return nil
+	}
+
+	delay := s.policy.DelayBase
+	for i := s.policy.DelayAfter; i < len(failures) && delay < s.policy.DelayMax; i++ {
+		delay *= 2
+	}
+	if delay > s.policy.DelayMax {
+		delay = s.policy.DelayMax
+	}
+
+	if wait := failures[0].CreatedAt.Add(delay).Sub(now); wait > 0 {
+		return &TooManyAttemptsError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// registerFailure counts a wrong password against user and locks the account
+// once the policy's threshold is reached. The count is changed in the
+// database rather than from user, so concurrent failures are all counted
+// and exactly one of them locks the account.
+func (s *AuthService) registerFailure(ctx context.Context, user *models.User, ip string, now time.Time) error {
+	increment := func(tx *gorm.DB) error {
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).
+			UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error
+	}
+	if s.policy.MaxFailures <= 0 {
+		return increment(s.db.WithContext(ctx))
+	}
+
+	lockedUntil := now.Add(s.policy.LockoutDuration)
+	locked := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND failed_login_attempts + 1 >= ?", user.ID, s.policy.MaxFailures).
+			UpdateColumns(map[string]interface{}{
+				"failed_login_attempts": 0,
+				"locked_until":          lockedUntil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return increment(tx)
+		}
+		locked = true
+		return tx.Create(&models.AccountLockout{
+			UserID:      user.ID,
+			IP:          ip,
+			LockedUntil: lockedUntil,
+			CreatedAt:   now,
+		}).Error
+	})
+	if err != nil || !locked {
+		return err
+	}
+
+	logging.FromContext(ctx).Warn("account locked after repeated login failures",
+		"user_id", user.ID, "ip", ip, "locked_until", lockedUntil)
+	return nil
+}
+
+// firstFactorAccepted finishes a login whose first factor checked out: users
+// with two-factor enabled get a challenge, everyone else their tokens
+func (s *AuthService) firstFactorAccepted(ctx context.Context, user *models.User, ip string, now time.Time) (*models.User, *TokenPair, error) {
+	if user.HasTwoFactor() {
+		challenge, expiresIn, err := s.tokens.IssueChallenge(*user)
+		if err != nil {
+			return nil, nil, err
+		}
+		logging.FromContext(ctx).Info("first factor accepted, second factor required", "user_id", user.ID)
+		return nil, nil, &TwoFactorRequiredError{ChallengeToken: challenge, ExpiresIn: expiresIn}
+	}
+
+	return s.completeLogin(ctx, user, ip, now)
+}
+
+// completeLogin records a successful login, clears the failure count and
+// issues the user's tokens. Deactivated and suspended accounts are turned
+// away only here, once every factor has checked out, so their status is not
+// revealed to someone guessing passwords.
+func (s *AuthService) completeLogin(ctx context.Context, user *models.User, ip string, now time.Time) (*models.User, *TokenPair, error) {
+	// Logging in again is how users undo their own deactivation
+	if user.StatusAt(now) == models.UserStatusDeactivated {
+		if err := s.statuses.Reactivate(ctx, user); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := checkActive(user, now); err != nil {
+		s.recordAttempt(ctx, user.Email, ip, false, now)
+		logging.FromContext(ctx).Warn("login rejected: account not active", "user_id", user.ID, "status", user.StatusAt(now))
+		return nil, nil, err
+	}
+	s.recordAttempt(ctx, user.Email, ip, true, now)
+	if user.FailedLoginAttempts != 0 || user.LockedUntil != nil {
+		err := s.db.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tokens, err := s.tokens.Issue(*user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logging.FromContext(ctx).Info("user logged in", "user_id", user.ID)
+	return user, tokens, nil
+}
+
+// upgradeHash re-hashes a just-verified password when its stored hash uses a
+// legacy algorithm or weaker parameters. Failure is logged, not fatal: the
+// user can still log in and the upgrade is retried next time.
+func (s *AuthService) upgradeHash(ctx context.Context, user *models.User, password string) {
+	if !DefaultPasswordHasher().NeedsRehash(user.HashedPassword) {
+		return
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err == nil {
+		err = s.db.WithContext(ctx).Model(user).Update("hashed_password", hashedPassword).Error
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to upgrade password hash", "user_id", user.ID, "error", err)
+		return
+	}
+	logging.FromContext(ctx).Info("upgraded password hash", "user_id", user.ID)
+}
+
+func (s *AuthService) recordAttempt(ctx context.Context, email, ip string, success bool, now time.Time) {
+	err := s.db.WithContext(ctx).Create(&models.LoginAttempt{
+		Email:     email,
+		IP:        ip,
+		Success:   success,
+		CreatedAt: now,
+	}).Error
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to record login attempt", "error", err)
+	}
+}
+
+var (
+	dummyHashOnce  sync.Once
+	dummyHashValue string
+)
+
+// dummyHash is a valid password hash to compare against for unknown emails
+func dummyHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHashValue, _ = HashPassword(randomToken(16))
+	})
+	return dummyHashValue
+}
+
+// randomToken returns n random bytes, hex encoded
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// Background runs work that outlives the request that started it, such as
+// data export builds, and lets shutdown wait for it before the database is
+// closed
+type Background struct {
+	wg sync.WaitGroup
+}
+
+func NewBackground() *Background {
+	return &Background{}
+}
+
+// Go runs job in its own goroutine
+func (b *Background) Go(job func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		job()
+	}()
+}
+
+// Wait blocks until every job has finished, or returns ctx's error once it
+// is done
+func (b *Background) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
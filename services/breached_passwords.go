@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// BreachedPasswordChecker reports whether a password is known to be common
+// or to have appeared in a breach
+type BreachedPasswordChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// HashPrefixChecker looks passwords up in a set of SHA-1 hashes grouped by
+// their first five hex characters, the k-anonymity layout used by the HIBP
+// range API. Only hashes are held, never plaintext passwords.
+type HashPrefixChecker struct {
+	ranges map[string]map[string]struct{}
+}
+
+// LoadHashPrefixChecker parses "PREFIX:SUFFIX" lines (5 and 35 hex
+// characters). Blank lines and lines starting with # are ignored, as is any
+// ":count" after the suffix.
+func LoadHashPrefixChecker(r io.Reader) (*HashPrefixChecker, error) {
+	checker := &HashPrefixChecker{ranges: make(map[string]map[string]struct{})}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.Split(strings.ToUpper(text), ":")
+		if len(parts) < 2 || len(parts[0]) != 5 || len(parts[1]) != 35 {
+			return nil, fmt.Errorf("invalid hash prefix entry on line %d", line)
+		}
+		suffixes, exists := checker.ranges[parts[0]]
+		if !exists {
+			suffixes = make(map[string]struct{})
+			checker.ranges[parts[0]] = suffixes
+		}
+		suffixes[parts[1]] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return checker, nil
+}
+
+// IsBreached implements BreachedPasswordChecker
+func (c *HashPrefixChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, exists := c.ranges[hash[:5]]
+	if !exists {
+		return false, nil
+	}
+	_, breached := suffixes[hash[5:]]
+	return breached, nil
+}
+
+//go:embed data/breached_passwords.txt
+var bundledBreachedPasswords string
+
+var (
+	bundledCheckerOnce sync.Once
+	bundledChecker     *HashPrefixChecker
+)
+
+// BundledBreachedPasswords returns the checker for the offline list shipped
+// with the binary
+func BundledBreachedPasswords() *HashPrefixChecker {
+	bundledCheckerOnce.Do(func() {
+		checker, err := LoadHashPrefixChecker(strings.NewReader(bundledBreachedPasswords))
+		if err != nil {
+			panic(fmt.Sprintf("bundled breached password list is invalid: %v", err))
+		}
+		bundledChecker = checker
+	})
+	return bundledChecker
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/tracing"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDataExportNotFound = errors.New("data export not found")
+	ErrDataExportNotReady = errors.New("data export is not ready")
+)
+
+// DataExportService builds ZIP archives of everything stored about a user.
+// Archives are built in the background and kept in the database until they
+// expire.
+type DataExportService struct {
+	db    *gorm.DB
+	audit *AuditService
+	ttl   time.Duration
+	now   func() time.Time
+	// run starts a build in the background
+	run func(func())
+}
+
+// NewDataExportService creates a DataExportService whose archives are built
+// as background jobs and can be downloaded for DATA_EXPORT_TTL
+func NewDataExportService(db *gorm.DB, background *Background) *DataExportService {
+	return &DataExportService{
+		db:    db,
+		audit: NewAuditService(db),
+		ttl:   initializers.GetEnvDuration("DATA_EXPORT_TTL", 7*24*time.Hour),
+		now:   time.Now,
+		run:   background.Go,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *DataExportService) SetClock(now func() time.Time) {
+	s.now = now
+	s.audit.SetClock(now)
+}
+
+// Request starts building an export for the user. While one is still being
+// built, that one is returned instead of starting another.
+func (s *DataExportService) Request(ctx context.Context, userID uint) (*models.DataExport, error) {
+	ctx, span := tracing.Start(ctx, "DataExportService.Request")
+	defer span.End()
+
+	now := s.now()
+	var export models.DataExport
+	created := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Expired archives are never downloaded again; clear them out as we go
+		if err := tx.Where("expires_at < ?", now).Delete(&models.DataExport{}).Error; err != nil {
+			return err
+		}
+		err := tx.Where("user_id = ? AND status = ?", userID, models.DataExportPending).First(&export).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		export = models.DataExport{
+			UserID:    userID,
+			Status:    models.DataExportPending,
+			ExpiresAt: now.Add(s.ttl),
+		}
+		if err := tx.Create(&export).Error; err != nil {
+			return err
+		}
+		created = true
+		return s.audit.RecordTx(ctx, tx, models.AuditLog{
+			Action:       models.AuditUserExport,
+			ResourceType: "user",
+			ResourceID:   strconv.FormatUint(uint64(userID), 10),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if created {
+		// The request is over before the job is; keep its logger and trace
+		jobCtx := context.WithoutCancel(ctx)
+		s.run(func() { s.build(jobCtx, export.ID) })
+		logging.FromContext(ctx).Info("data export requested", "user_id", userID, "export_id", export.ID)
+	}
+	return &export, nil
+}
+
+// Get returns one of the user's exports, without the archive
+func (s *DataExportService) Get(ctx context.Context, userID, id uint) (*models.DataExport, error) {
+	ctx, span := tracing.Start(ctx, "DataExportService.Get")
+	defer span.End()
+
+	var export models.DataExport
+	err := s.db.WithContext(ctx).Omit("archive").
+		Where("id = ? AND user_id = ? AND expires_at > ?", id, userID, s.now()).
+		First(&export).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDataExportNotFound
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+// Download returns the archive of one of the user's finished exports
+func (s *DataExportService) Download(ctx context.Context, userID, id uint) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, "DataExportService.Download")
+	defer span.End()
+
+	var export models.DataExport
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND user_id = ? AND expires_at > ?", id, userID, s.now()).
+		First(&export).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDataExportNotFound
+		}
+		return nil, err
+	}
+	if export.Status != models.DataExportReady {
+		return nil, ErrDataExportNotReady
+	}
+	return export.Archive, nil
+}
+
+// FailInterrupted marks exports still pending from before the process
+// started as failed, since nothing is building them any more, and returns
+// how many there were. Otherwise they would stop their users from requesting
+// another until they expire.
+func (s *DataExportService) FailInterrupted(ctx context.Context, startedAt time.Time) (int, error) {
+	ctx, span := tracing.Start(ctx, "DataExportService.FailInterrupted")
+	defer span.End()
+
+	result := s.db.WithContext(ctx).Model(&models.DataExport{}).
+		Where("status = ? AND created_at < ?", models.DataExportPending, startedAt).
+		Update("status", models.DataExportFailed)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected > 0 {
+		logging.FromContext(ctx).Warn("failed data exports interrupted by a restart", "count", result.RowsAffected)
+	}
+	return int(result.RowsAffected), nil
+}
+
+// build collects the user's data into the export's archive, marking the
+// export failed if anything goes wrong
+func (s *DataExportService) build(ctx context.Context, id uint) {
+	ctx, span := tracing.Start(ctx, "DataExportService.build")
+	defer span.End()
+
+	var export models.DataExport
+	if err := s.db.WithContext(ctx).Omit("archive").First(&export, id).Error; err != nil {
+		logging.FromContext(ctx).Error("failed to load data export", "export_id", id, "error", err)
+		return
+	}
+
+	updates := map[string]interface{}{"status": models.DataExportFailed}
+	archive, err := s.archive(ctx, export.UserID)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to build data export", "user_id", export.UserID, "export_id", id, "error", err)
+	} else {
+		updates = map[string]interface{}{
+			"status":       models.DataExportReady,
+			"archive":      archive,
+			"size":         len(archive),
+			"completed_at": s.now(),
+		}
+	}
+	if err := s.db.WithContext(ctx).Model(&export).Updates(updates).Error; err != nil {
+		logging.FromContext(ctx).Error("failed to save data export", "user_id", export.UserID, "export_id", id, "error", err)
+		return
+	}
+	logging.FromContext(ctx).Info("data export built", "user_id", export.UserID, "export_id", id, "status", updates["status"])
+}
+
+// archive writes the user's profile, posts and audit entries as JSON files
+// in a ZIP archive, along with the largest thumbnail of their avatar
+func (s *DataExportService) archive(ctx context.Context, userID uint) ([]byte, error) {
+	db := s.db.WithContext(ctx)
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	posts := []models.Post{}
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	var identities []models.ExternalIdentity
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	entries := []models.AuditLog{}
+	err := db.Where("actor_id = ? OR (resource_type = ? AND resource_id = ?)", userID, "user", strconv.FormatUint(uint64(userID), 10)).
+		Order("id").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	// Entries made by someone else, such as an admin suspending the user or
+	// impersonating them, say what happened but not who did it or from where
+	for i := range entries {
+		entry := &entries[i]
+		byUser := entry.ActorID != nil && *entry.ActorID == userID
+		if byUser && entry.ImpersonatorID == nil {
+			continue
+		}
+		if !byUser {
+			entry.ActorID = nil
+		}
+		entry.ImpersonatorID = nil
+		entry.IP = ""
+	}
+
+	var picture models.Avatar
+	err = db.Where("user_id = ?", userID).Order("size DESC").Limit(1).Find(&picture).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Linked provider accounts are part of the profile, not a separate file
+	providers := []map[string]interface{}{}
+	for _, identity := range identities {
+		providers = append(providers, map[string]interface{}{
+			"issuer":        identity.Issuer,
+			"subject":       identity.Subject,
+			"email":         identity.Email,
+			"linked_at":     identity.CreatedAt,
+			"last_login_at": identity.LastLoginAt,
+		})
+	}
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", map[string]interface{}{"user": user, "external_accounts": providers}},
+		{"posts.json", posts},
+		{"audit_log.json", entries},
+	}
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	if picture.ID != 0 {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: "avatar.png", Method: zip.Store, Modified: s.now()})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(picture.Data); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range files {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: s.now()})
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/mail"
+	"go-crud/models"
+	"go-crud/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+)
+
+// ResendThrottledError is returned when a verification email was sent too
+// recently; the caller may retry after RetryAfter
+type ResendThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ResendThrottledError) Error() string {
+	return fmt.Sprintf("verification email sent recently, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// EmailVerificationService emails verification links and confirms addresses
+type EmailVerificationService struct {
+	db             *gorm.DB
+	mailer         mail.Mailer
+	ttl            time.Duration
+	resendInterval time.Duration
+	verifyURL      string
+	now            func() time.Time
+}
+
+// NewEmailVerificationService creates an EmailVerificationService configured
+// from EMAIL_VERIFICATION_TTL, EMAIL_VERIFICATION_RESEND_INTERVAL and
+// EMAIL_VERIFICATION_URL
+func NewEmailVerificationService(db *gorm.DB, mailer mail.Mailer) *EmailVerificationService {
+	return &EmailVerificationService{
+		db:             db,
+		mailer:         mailer,
+		ttl:            initializers.GetEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		resendInterval: initializers.GetEnvDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute),
+		verifyURL:      initializers.GetEnv("EMAIL_VERIFICATION_URL", "http://localhost:8080/auth/verify"),
+		now:            time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *EmailVerificationService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Send emails user a fresh verification link
+func (s *EmailVerificationService) Send(ctx context.Context, user models.User) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.Send")
+	defer span.End()
+
+	token := randomToken(32)
+	now := s.now()
+	err := s.db.WithContext(ctx).Create(&models.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.Name, s.ttl, withToken(s.verifyURL, token)),
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("verification email sent", "user_id", user.ID)
+	return nil
+}
+
+// Resend emails a new link to an unverified user, at most once per
+// resend interval
+func (s *EmailVerificationService) Resend(ctx context.Context, userID uint) error {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.Resend")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("user not found")
+		}
+		return err
+	}
+	if user.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	var last models.EmailVerificationToken
+	err := s.db.WithContext(ctx).Where("user_id = ?", user.ID).
+		Order("created_at desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return err
+	}
+	if last.ID != 0 {
+		if wait := last.CreatedAt.Add(s.resendInterval).Sub(s.now()); wait > 0 {
+			return &ResendThrottledError{RetryAfter: wait}
+		}
+	}
+
+	return s.Send(ctx, user)
+}
+
+// Verify redeems token and marks the owner's email as verified
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.Verify")
+	defer span.End()
+
+	now := s.now()
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var verification models.EmailVerificationToken
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), now).
+			First(&verification).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidVerificationToken
+			}
+			return err
+		}
+
+		result := tx.Model(&models.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", verification.UserID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if err := tx.First(&user, verification.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidVerificationToken
+			}
+			return err
+		}
+		if user.IsEmailVerified() {
+			return nil
+		}
+		user.EmailVerifiedAt = &now
+		return tx.Model(&user).Update("email_verified_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("email verified", "user_id", user.ID)
+	return &user, nil
+}
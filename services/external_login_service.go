@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/metrics"
+	"go-crud/models"
+	"go-crud/oidc"
+	"go-crud/tracing"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrExternalLoginDisabled = errors.New("external login is not configured")
+	ErrExternalLoginFailed   = errors.New("external login failed")
+	// ErrExternalProviderUnavailable is returned when the provider's discovery
+	// document cannot be fetched or is unusable
+	ErrExternalProviderUnavailable = errors.New("external login provider is unavailable")
+	// ErrExternalEmailUnverified is returned when the provider does not vouch
+	// for the email address, so it can neither match nor create an account
+	ErrExternalEmailUnverified = errors.New("the provider has not verified this email address")
+	// ErrExternalAccountUnverified is returned when a local account with the
+	// same email exists but its owner never proved the address. Linking it
+	// would hand the account to whoever signs in with the provider, or leave
+	// whoever registered it first able to get in.
+	ErrExternalAccountUnverified = errors.New("an unverified account already uses this email address")
+)
+
+// ExternalLoginService signs users in with an external OpenID Connect
+// provider. Provider accounts are linked to local users by a verified email
+// address the first time, and by the provider's subject after that.
+type ExternalLoginService struct {
+	db       *gorm.DB
+	auth     *AuthService
+	issuer   string
+	config   oidc.Config
+	client   *http.Client
+	stateTTL time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewExternalLoginService creates an ExternalLoginService configured from
+// OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL and
+// OIDC_SCOPES. External login is disabled while OIDC_ISSUER is empty.
+func NewExternalLoginService(db *gorm.DB, auth *AuthService) *ExternalLoginService {
+	return &ExternalLoginService{
+		db:     db,
+		auth:   auth,
+		issuer: initializers.GetEnv("OIDC_ISSUER", ""),
+		config: oidc.Config{
+			ClientID:     initializers.GetEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret: initializers.GetEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  initializers.GetEnv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback"),
+			Scopes:       strings.Fields(initializers.GetEnv("OIDC_SCOPES", "openid email profile")),
+		},
+		client:   &http.Client{Timeout: 10 * time.Second},
+		stateTTL: 10 * time.Minute,
+		now:      time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *ExternalLoginService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Enabled reports whether an external provider is configured
+func (s *ExternalLoginService) Enabled() bool {
+	return s.issuer != ""
+}
+
+// StateTTL is how long the user has to finish at the provider
+func (s *ExternalLoginService) StateTTL() time.Duration {
+	return s.stateTTL
+}
+
+// Begin starts a login and returns the provider URL to send the browser to
+// and the state that will come back with the callback
+func (s *ExternalLoginService) Begin(ctx context.Context) (string, string, error) {
+	ctx, span := tracing.Start(ctx, "ExternalLoginService.Begin")
+	defer span.End()
+
+	provider, err := s.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := s.now()
+	state := randomToken(32)
+	login := models.ExternalLogin{
+		StateHash:    hashToken(state),
+		Nonce:        randomToken(16),
+		CodeVerifier: randomToken(32),
+		ExpiresAt:    now.Add(s.stateTTL),
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Abandoned logins are never completed; clear them out as we go
+		if err := tx.Where("expires_at < ?", now).Delete(&models.ExternalLogin{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&login).Error
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return provider.AuthCodeURL(s.config, state, login.Nonce, login.CodeVerifier), state, nil
+}
+
+// Complete finishes a login from the provider's callback: it redeems the
+// state and the code, validates the ID token and logs in the linked user,
+// creating or linking one if needed. Users with two-factor enabled get a
+// TwoFactorRequiredError, as with a password login.
+func (s *ExternalLoginService) Complete(ctx context.Context, state, code, ip string) (*models.User, *TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "ExternalLoginService.Complete")
+	defer span.End()
+
+	provider, err := s.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := s.now()
+	var login models.ExternalLogin
+	if err := s.db.WithContext(ctx).Where("state_hash = ?", hashToken(state)).First(&login).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrExternalLoginFailed
+		}
+		return nil, nil, err
+	}
+	result := s.db.WithContext(ctx).Model(&models.ExternalLogin{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", login.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrExternalLoginFailed
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, s.config, code, login.CodeVerifier)
+	if err != nil {
+		logging.FromContext(ctx).Warn("external login code exchange failed", "error", err)
+		return nil, nil, ErrExternalLoginFailed
+	}
+	claims, err := provider.VerifyIDToken(ctx, s.config.ClientID, rawIDToken, login.Nonce)
+	if err != nil {
+		logging.FromContext(ctx).Warn("external login ID token rejected", "error", err)
+		return nil, nil, ErrExternalLoginFailed
+	}
+
+	user, err := s.resolveUser(ctx, claims, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.auth.LoginExternal(ctx, user, ip)
+}
+
+// resolveUser finds the user linked to the provider account, linking an
+// existing user by email or registering a new one the first time
+func (s *ExternalLoginService) resolveUser(ctx context.Context, claims *oidc.Claims, now time.Time) (*models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identity models.ExternalIdentity
+		err := tx.Where("issuer = ? AND subject = ?", s.issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&identity).Update("last_login_at", now).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if claims.Email == "" || !bool(claims.EmailVerified) {
+			return ErrExternalEmailUnverified
+		}
+		err = tx.Where("email = ?", claims.Email).First(&user).Error
+		switch {
+		case err == nil:
+			if !user.IsEmailVerified() {
+				return ErrExternalAccountUnverified
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.register(ctx, tx, &user, claims, now); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.ExternalIdentity{
+			UserID:      user.ID,
+			Issuer:      s.issuer,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// register creates a user for a new provider account. The provider vouched
+// for the email, so it starts verified; the password is random until the
+// user sets one through a password reset.
+func (s *ExternalLoginService) register(ctx context.Context, tx *gorm.DB, user *models.User, claims *oidc.Claims, now time.Time) error {
+	hashed, err := HashPassword(randomToken(32))
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	*user = models.User{
+		Name:            name,
+		Email:           claims.Email,
+		HashedPassword:  hashed,
+		EmailVerifiedAt: &now,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	metrics.UsersRegistered.Inc()
+	logging.FromContext(ctx).Info("user registered via external login", "user_id", user.ID, "issuer", s.issuer)
+	return nil
+}
+
+// discover returns the provider, fetching its discovery document on first
+// use. A failed discovery is retried on the next login rather than cached, so
+// a provider that was down at startup does not disable login for good.
+func (s *ExternalLoginService) discover(ctx context.Context) (*oidc.Provider, error) {
+	if !s.Enabled() {
+		return nil, ErrExternalLoginDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider == nil {
+		provider, err := oidc.Discover(ctx, s.client, s.issuer)
+		if err != nil {
+			logging.FromContext(ctx).Error("external login provider discovery failed", "error", err)
+			return nil, fmt.Errorf("%w: %v", ErrExternalProviderUnavailable, err)
+		}
+		s.provider = provider
+	}
+	return s.provider, nil
+}
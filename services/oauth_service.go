@@ -0,0 +1,731 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/tracing"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOAuthClientNotFound   = errors.New("OAuth client not found")
+	ErrInvalidClientMetadata = errors.New("invalid client metadata")
+)
+
+// Prefixes of OAuth credentials, so they are recognisable at a glance and by
+// secret scanners
+const (
+	oauthClientPrefix       = "gcc_"
+	oauthAccessTokenPrefix  = "gcoa_"
+	oauthRefreshTokenPrefix = "gcor_"
+)
+
+// OAuth error codes from RFC 6749
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+)
+
+// OAuthError is an error reported to OAuth clients in the RFC 6749 format.
+// Redirectable errors in an authorization request are sent back to the
+// client's redirect URI; the others are shown to the user, because the
+// redirect URI itself could not be trusted.
+type OAuthError struct {
+	Code         string
+	Description  string
+	Redirectable bool
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// AuthorizationRequest is an authorization endpoint request (RFC 6749 4.1.1
+// with PKCE, RFC 7636)
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// AuthorizationPrompt is a validated authorization request, ready to show on
+// the consent screen
+type AuthorizationPrompt struct {
+	Client *models.OAuthClient
+	Scopes []string
+	// ConsentGiven is set when the user already agreed to every scope
+	ConsentGiven bool
+}
+
+// ClientCredentials are what a client presented to authenticate itself
+type ClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// OAuthTokens are the tokens issued by the token endpoint
+type OAuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    time.Duration
+	Scopes       []string
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token
+type IDTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// pkceVerifierPattern is the code verifier syntax from RFC 7636 4.1
+var pkceVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// OAuthService is an OAuth 2.1 authorization server with OpenID Connect: it
+// registers clients, runs the authorization code flow with PKCE and issues,
+// introspects and revokes opaque tokens
+type OAuthService struct {
+	db         *gorm.DB
+	signer     *OAuthSigner
+	issuer     string
+	codeTTL    time.Duration
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewOAuthService creates an OAuthService signing ID tokens with signer,
+// configured from OAUTH_ISSUER, OAUTH_CODE_TTL, OAUTH_ACCESS_TOKEN_TTL and
+// OAUTH_REFRESH_TOKEN_TTL
+func NewOAuthService(db *gorm.DB, signer *OAuthSigner) *OAuthService {
+	return &OAuthService{
+		db:         db,
+		signer:     signer,
+		issuer:     strings.TrimSuffix(initializers.GetEnv("OAUTH_ISSUER", "http://localhost:8080"), "/"),
+		codeTTL:    initializers.GetEnvDuration("OAUTH_CODE_TTL", time.Minute),
+		accessTTL:  initializers.GetEnvDuration("OAUTH_ACCESS_TOKEN_TTL", time.Hour),
+		refreshTTL: initializers.GetEnvDuration("OAUTH_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		now:        time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *OAuthService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Issuer is the issuer identifier, the base URL of every OAuth endpoint
+func (s *OAuthService) Issuer() string {
+	return s.issuer
+}
+
+// JWKS returns the keys ID tokens can be verified with
+func (s *OAuthService) JWKS() JSONWebKeySet {
+	return s.signer.JWKS()
+}
+
+// IsOAuthAccessToken reports whether a bearer token is an OAuth access token
+// rather than a first-party JWT
+func IsOAuthAccessToken(token string) bool {
+	return strings.HasPrefix(token, oauthAccessTokenPrefix)
+}
+
+// RegisterClient registers a client owned by ownerID and returns it with its
+// secret, which is only available now. Public clients get no secret.
+func (s *OAuthService) RegisterClient(ctx context.Context, ownerID uint, name string, redirectURIs, scopes []string, public bool) (*models.OAuthClient, string, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.RegisterClient")
+	defer span.End()
+
+	for _, uri := range redirectURIs {
+		if err := checkRedirectURI(uri, public); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.OAuthScopes, scope) {
+			return nil, "", fmt.Errorf("%w: unknown scope %q", ErrInvalidClientMetadata, scope)
+		}
+	}
+
+	client := models.OAuthClient{
+		ClientID:     oauthClientPrefix + randomToken(8),
+		Name:         name,
+		OwnerID:      ownerID,
+		RedirectURIs: redirectURIs,
+		Scopes:       slices.Compact(slices.Sorted(slices.Values(scopes))),
+		Public:       public,
+	}
+	secret := ""
+	if !public {
+		secret = randomToken(32)
+		client.SecretHash = hashToken(secret)
+	}
+	if err := s.db.WithContext(ctx).Create(&client).Error; err != nil {
+		return nil, "", err
+	}
+
+	logging.FromContext(ctx).Info("OAuth client registered", "user_id", ownerID, "client_id", client.ClientID)
+	return &client, secret, nil
+}
+
+// checkRedirectURI enforces the OAuth 2.1 redirect URI rules: absolute, no
+// fragment, and HTTPS unless it points at the loopback interface. Public
+// clients may also use a private-use scheme, as native apps do (RFC 8252).
+func checkRedirectURI(uri string, public bool) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+		return fmt.Errorf("%w: redirect URI %q must be absolute and have no fragment", ErrInvalidClientMetadata, uri)
+	}
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := parsed.Hostname(); host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+		return fmt.Errorf("%w: redirect URI %q must use HTTPS", ErrInvalidClientMetadata, uri)
+	case "javascript", "data", "file", "vbscript":
+		return fmt.Errorf("%w: redirect URI %q uses a forbidden scheme", ErrInvalidClientMetadata, uri)
+	}
+	if !public {
+		return fmt.Errorf("%w: redirect URI %q must use HTTPS", ErrInvalidClientMetadata, uri)
+	}
+	return nil
+}
+
+// ListClients returns the clients registered by ownerID
+func (s *OAuthService) ListClients(ctx context.Context, ownerID uint) ([]models.OAuthClient, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.ListClients")
+	defer span.End()
+
+	var clients []models.OAuthClient
+	err := s.db.WithContext(ctx).Where("owner_id = ?", ownerID).Order("id DESC").Find(&clients).Error
+	return clients, err
+}
+
+// DeleteClient removes one of ownerID's clients along with every token,
+// code and consent issued to it
+func (s *OAuthService) DeleteClient(ctx context.Context, ownerID uint, clientID string) error {
+	ctx, span := tracing.Start(ctx, "OAuthService.DeleteClient")
+	defer span.End()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("client_id = ? AND owner_id = ?", clientID, ownerID).Delete(&models.OAuthClient{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOAuthClientNotFound
+		}
+		for _, model := range []interface{}{&models.OAuthToken{}, &models.OAuthAuthorizationCode{}, &models.OAuthConsent{}} {
+			if err := tx.Where("client_id = ?", clientID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("OAuth client deleted", "user_id", ownerID, "client_id", clientID)
+	return nil
+}
+
+// PrepareAuthorization validates an authorization request for userID and
+// reports whether the user already consented to it
+func (s *OAuthService) PrepareAuthorization(ctx context.Context, userID uint, req AuthorizationRequest) (*AuthorizationPrompt, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.PrepareAuthorization")
+	defer span.End()
+
+	// Until the client and redirect URI are known to be genuine, errors must
+	// not be redirected anywhere
+	var client models.OAuthClient
+	if err := s.db.WithContext(ctx).Where("client_id = ?", req.ClientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, oauthError(OAuthInvalidClient, "unknown client_id")
+		}
+		return nil, err
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, oauthError(OAuthInvalidRequest, "redirect_uri is not registered for this client")
+	}
+
+	redirectable := func(code, description string) error {
+		return &OAuthError{Code: code, Description: description, Redirectable: true}
+	}
+	if req.ResponseType != "code" {
+		return nil, redirectable(OAuthUnsupportedResponseType, "only the code response type is supported")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return nil, redirectable(OAuthInvalidRequest, "a PKCE code_challenge with code_challenge_method S256 is required")
+	}
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		return nil, redirectable(OAuthInvalidScope, "scope is required")
+	}
+	if !client.AllowsScopes(scopes) {
+		return nil, redirectable(OAuthInvalidScope, "the client may not request these scopes")
+	}
+	scopes = slices.Compact(slices.Sorted(slices.Values(scopes)))
+
+	var consent models.OAuthConsent
+	err := s.db.WithContext(ctx).Where("user_id = ? AND client_id = ?", userID, client.ClientID).First(&consent).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	given := err == nil
+	for _, scope := range scopes {
+		given = given && slices.Contains(consent.Scopes, scope)
+	}
+
+	return &AuthorizationPrompt{Client: &client, Scopes: scopes, ConsentGiven: given}, nil
+}
+
+// Authorize records userID's consent to the request and returns a single-use
+// authorization code for the client
+func (s *OAuthService) Authorize(ctx context.Context, userID uint, req AuthorizationRequest) (string, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.Authorize")
+	defer span.End()
+
+	prompt, err := s.PrepareAuthorization(ctx, userID, req)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.now()
+	code := randomToken(32)
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var consent models.OAuthConsent
+		err := tx.Where("user_id = ? AND client_id = ?", userID, prompt.Client.ClientID).First(&consent).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		consent.UserID = userID
+		consent.ClientID = prompt.Client.ClientID
+		consent.Scopes = slices.Compact(slices.Sorted(slices.Values(append(consent.Scopes, prompt.Scopes...))))
+		if err := tx.Save(&consent).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.OAuthAuthorizationCode{
+			CodeHash:      hashToken(code),
+			GrantID:       randomToken(16),
+			ClientID:      prompt.Client.ClientID,
+			UserID:        userID,
+			RedirectURI:   req.RedirectURI,
+			Scopes:        prompt.Scopes,
+			CodeChallenge: req.CodeChallenge,
+			Nonce:         req.Nonce,
+			AuthTime:      now,
+			ExpiresAt:     now.Add(s.codeTTL),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	logging.FromContext(ctx).Info("OAuth authorization granted", "user_id", userID, "client_id", prompt.Client.ClientID, "scopes", prompt.Scopes)
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code at the token endpoint. A code
+// presented twice revokes every token issued from it.
+func (s *OAuthService) ExchangeCode(ctx context.Context, creds ClientCredentials, code, redirectURI, codeVerifier string) (*OAuthTokens, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.ExchangeCode")
+	defer span.End()
+
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	var grant models.OAuthAuthorizationCode
+	if err := s.db.WithContext(ctx).Where("code_hash = ?", hashToken(code)).First(&grant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, oauthError(OAuthInvalidGrant, "invalid authorization code")
+		}
+		return nil, err
+	}
+	if grant.ClientID != client.ClientID {
+		return nil, oauthError(OAuthInvalidGrant, "invalid authorization code")
+	}
+
+	now := s.now()
+	result := s.db.WithContext(ctx).Model(&models.OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", grant.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		logging.FromContext(ctx).Warn("OAuth authorization code replayed, revoking grant", "client_id", client.ClientID, "user_id", grant.UserID)
+		if err := s.revokeGrant(ctx, grant.GrantID); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(OAuthInvalidGrant, "invalid authorization code")
+	}
+
+	if !now.Before(grant.ExpiresAt) {
+		return nil, oauthError(OAuthInvalidGrant, "authorization code has expired")
+	}
+	if redirectURI != grant.RedirectURI {
+		return nil, oauthError(OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !pkceVerifierPattern.MatchString(codeVerifier) {
+		return nil, oauthError(OAuthInvalidRequest, "code_verifier must be 43 to 128 unreserved characters")
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(grant.CodeChallenge)) != 1 {
+		return nil, oauthError(OAuthInvalidGrant, "code_verifier does not match the code challenge")
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, grant.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, oauthError(OAuthInvalidGrant, "the user no longer exists")
+		}
+		return nil, err
+	}
+	if !user.IsActive(s.now()) {
+		return nil, oauthError(OAuthInvalidGrant, "the user's account is not active")
+	}
+
+	tokens, err := s.issueTokens(ctx, client, &user, grant.GrantID, grant.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(grant.Scopes, models.ScopeOpenID) {
+		if tokens.IDToken, err = s.idToken(client, &user, grant); err != nil {
+			return nil, err
+		}
+	}
+
+	logging.FromContext(ctx).Info("OAuth authorization code exchanged", "client_id", client.ClientID, "user_id", user.ID)
+	return tokens, nil
+}
+
+// Refresh rotates a refresh token: the old one is revoked and a new pair
+// issued, optionally narrowed to scope. A refresh token presented after it
+// was rotated revokes the whole grant, since one copy must have leaked.
+func (s *OAuthService) Refresh(ctx context.Context, creds ClientCredentials, refreshToken, scope string) (*OAuthTokens, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.Refresh")
+	defer span.End()
+
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.findToken(ctx, refreshToken, models.OAuthRefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.ClientID != client.ClientID {
+		return nil, oauthError(OAuthInvalidGrant, "invalid refresh token")
+	}
+
+	now := s.now()
+	if token.RevokedAt != nil {
+		logging.FromContext(ctx).Warn("revoked OAuth refresh token reused, revoking grant", "client_id", client.ClientID, "user_id", token.UserID)
+		if err := s.revokeGrant(ctx, token.GrantID); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(OAuthInvalidGrant, "invalid refresh token")
+	}
+	if !token.IsActive(now) {
+		return nil, oauthError(OAuthInvalidGrant, "refresh token has expired")
+	}
+
+	scopes := token.Scopes
+	if requested := strings.Fields(scope); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(token.Scopes, scope) {
+				return nil, oauthError(OAuthInvalidScope, "scope exceeds the original grant")
+			}
+		}
+		scopes = slices.Compact(slices.Sorted(slices.Values(requested)))
+	}
+
+	user, err := s.tokenUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, oauthError(OAuthInvalidGrant, "invalid refresh token")
+	}
+	if !user.IsActive(now) {
+		return nil, oauthError(OAuthInvalidGrant, "the user's account is not active")
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.OAuthToken{}).
+		Where("id = ? AND revoked_at IS NULL", token.ID).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Lost a race with another request using the same token
+		if err := s.revokeGrant(ctx, token.GrantID); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(OAuthInvalidGrant, "invalid refresh token")
+	}
+
+	return s.issueTokens(ctx, client, user, token.GrantID, scopes)
+}
+
+// Authenticate checks an OAuth access token presented to the API and returns
+// the token and the user it acts for
+func (s *OAuthService) Authenticate(ctx context.Context, accessToken string) (*models.User, *models.OAuthToken, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.Authenticate")
+	defer span.End()
+
+	token, err := s.findToken(ctx, accessToken, models.OAuthAccessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == nil || !token.IsActive(s.now()) {
+		return nil, nil, ErrInvalidToken
+	}
+	user, err := s.tokenUser(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, ErrInvalidToken
+	}
+	return user, token, nil
+}
+
+// Introspect returns the token if it is active and was issued to the calling
+// client, and nil otherwise (RFC 7662)
+func (s *OAuthService) Introspect(ctx context.Context, creds ClientCredentials, tokenString string) (*models.OAuthToken, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.Introspect")
+	defer span.End()
+
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := models.OAuthAccessToken
+	if strings.HasPrefix(tokenString, oauthRefreshTokenPrefix) {
+		kind = models.OAuthRefreshToken
+	}
+	token, err := s.findToken(ctx, tokenString, kind)
+	if err != nil || token == nil {
+		return nil, err
+	}
+	if token.ClientID != client.ClientID || !token.IsActive(s.now()) {
+		return nil, nil
+	}
+	user, err := s.tokenUser(ctx, token)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Revoke revokes a token issued to the calling client (RFC 7009). Revoking a
+// refresh token revokes its whole grant. Unknown tokens are ignored.
+func (s *OAuthService) Revoke(ctx context.Context, creds ClientCredentials, tokenString string) error {
+	ctx, span := tracing.Start(ctx, "OAuthService.Revoke")
+	defer span.End()
+
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return err
+	}
+
+	kind := models.OAuthAccessToken
+	if strings.HasPrefix(tokenString, oauthRefreshTokenPrefix) {
+		kind = models.OAuthRefreshToken
+	}
+	token, err := s.findToken(ctx, tokenString, kind)
+	if err != nil || token == nil || token.ClientID != client.ClientID {
+		return err
+	}
+
+	if kind == models.OAuthRefreshToken {
+		err = s.revokeGrant(ctx, token.GrantID)
+	} else {
+		err = s.db.WithContext(ctx).Model(&models.OAuthToken{}).
+			Where("id = ? AND revoked_at IS NULL", token.ID).
+			Update("revoked_at", s.now()).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("OAuth token revoked", "client_id", client.ClientID, "user_id", token.UserID, "kind", kind)
+	return nil
+}
+
+// User returns the user an access token acts for, for the UserInfo endpoint
+func (s *OAuthService) User(ctx context.Context, userID uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.User")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// authenticateClient checks the client's credentials. Confidential clients
+// must present their secret; public clients must not have one.
+func (s *OAuthService) authenticateClient(ctx context.Context, creds ClientCredentials) (*models.OAuthClient, error) {
+	if creds.ClientID == "" {
+		return nil, oauthError(OAuthInvalidClient, "client authentication is required")
+	}
+
+	var client models.OAuthClient
+	if err := s.db.WithContext(ctx).Where("client_id = ?", creds.ClientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+		}
+		return nil, err
+	}
+
+	if client.Public {
+		if creds.ClientSecret != "" {
+			return nil, oauthError(OAuthInvalidClient, "public clients have no secret")
+		}
+		return &client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(creds.ClientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+	}
+	return &client, nil
+}
+
+// issueTokens creates an access and refresh token pair within a grant
+func (s *OAuthService) issueTokens(ctx context.Context, client *models.OAuthClient, user *models.User, grantID string, scopes []string) (*OAuthTokens, error) {
+	now := s.now()
+	tokens := &OAuthTokens{
+		AccessToken:  oauthAccessTokenPrefix + randomToken(32),
+		RefreshToken: oauthRefreshTokenPrefix + randomToken(32),
+		ExpiresIn:    s.accessTTL,
+		Scopes:       scopes,
+	}
+	rows := []models.OAuthToken{
+		{TokenHash: hashToken(tokens.AccessToken), Kind: models.OAuthAccessToken, ExpiresAt: now.Add(s.accessTTL)},
+		{TokenHash: hashToken(tokens.RefreshToken), Kind: models.OAuthRefreshToken, ExpiresAt: now.Add(s.refreshTTL)},
+	}
+	for i := range rows {
+		rows[i].GrantID = grantID
+		rows[i].ClientID = client.ClientID
+		rows[i].UserID = user.ID
+		rows[i].Scopes = scopes
+		rows[i].TokenVersion = user.TokenVersion
+		rows[i].CreatedAt = now
+	}
+	if err := s.db.WithContext(ctx).Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// idToken signs an OpenID Connect ID token carrying the claims the granted
+// scopes allow
+func (s *OAuthService) idToken(client *models.OAuthClient, user *models.User, grant models.OAuthAuthorizationCode) (string, error) {
+	now := s.now()
+	claims := IDTokenClaims{
+		Nonce:    grant.Nonce,
+		AuthTime: grant.AuthTime.Unix(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+		},
+	}
+	if slices.Contains(grant.Scopes, models.ScopeProfile) {
+		claims.Name = user.Name
+	}
+	if slices.Contains(grant.Scopes, models.ScopeEmail) {
+		verified := user.IsEmailVerified()
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+	return s.signer.Sign(claims)
+}
+
+// findToken looks up a token of the given kind, returning nil if there is
+// none
+func (s *OAuthService) findToken(ctx context.Context, tokenString, kind string) (*models.OAuthToken, error) {
+	var token models.OAuthToken
+	err := s.db.WithContext(ctx).Where("token_hash = ? AND kind = ?", hashToken(tokenString), kind).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// tokenUser returns the token's user, or nil if the user is gone or has
+// revoked their tokens since it was issued
+func (s *OAuthService) tokenUser(ctx context.Context, token *models.OAuthToken) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, token.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if user.TokenVersion != token.TokenVersion {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+// revokeGrant revokes every token issued within a grant
+func (s *OAuthService) revokeGrant(ctx context.Context, grantID string) error {
+	return s.db.WithContext(ctx).Model(&models.OAuthToken{}).
+		Where("grant_id = ? AND revoked_at IS NULL", grantID).
+		Update("revoked_at", s.now()).Error
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unrecognised password hash format")
+
+// PasswordAlgorithm hashes passwords into self-describing strings, PHC format
+// or bcrypt's modular crypt format, and verifies passwords against them
+type PasswordAlgorithm interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// Identifies reports whether encoded was produced by this algorithm
+	Identifies(encoded string) bool
+	// NeedsRehash reports whether encoded used weaker parameters than the
+	// algorithm is currently configured with
+	NeedsRehash(encoded string) bool
+}
+
+// PasswordHasher hashes new passwords with its preferred algorithm while
+// still verifying hashes made by any of the legacy ones
+type PasswordHasher struct {
+	preferred PasswordAlgorithm
+	legacy    []PasswordAlgorithm
+}
+
+// NewPasswordHasher creates a PasswordHasher
+func NewPasswordHasher(preferred PasswordAlgorithm, legacy ...PasswordAlgorithm) *PasswordHasher {
+	return &PasswordHasher{
+		preferred: preferred,
+		legacy:    legacy,
+	}
+}
+
+// LoadPasswordHasher builds the hasher configured by PASSWORD_HASH_ALGORITHM
+// (argon2id or bcrypt) and the ARGON2_* / BCRYPT_COST parameters. Both
+// algorithms are always accepted when verifying.
+func LoadPasswordHasher() *PasswordHasher {
+	argon := &Argon2idAlgorithm{
+		Memory:      uint32(initializers.GetEnvInt("ARGON2_MEMORY_KIB", 64*1024)),
+		Iterations:  uint32(initializers.GetEnvInt("ARGON2_ITERATIONS", 3)),
+		Parallelism: uint8(initializers.GetEnvInt("ARGON2_PARALLELISM", 2)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	bcryptAlgorithm := &BcryptAlgorithm{Cost: initializers.GetEnvInt("BCRYPT_COST", bcrypt.DefaultCost)}
+
+	if initializers.GetEnv("PASSWORD_HASH_ALGORITHM", "argon2id") == "bcrypt" {
+		return NewPasswordHasher(bcryptAlgorithm, argon)
+	}
+	return NewPasswordHasher(argon, bcryptAlgorithm)
+}
+
+// Hash hashes password with the preferred algorithm
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify checks password against encoded, whichever algorithm produced it
+func (h *PasswordHasher) Verify(password, encoded string) (bool, error) {
+	algorithm := h.algorithmFor(encoded)
+	if algorithm == nil {
+		return false, ErrUnknownHashFormat
+	}
+	return algorithm.Verify(password, encoded)
+}
+
+// NeedsRehash reports whether encoded should be replaced by a fresh hash from
+// the preferred algorithm, because it used another algorithm or older
+// parameters
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	if !h.preferred.Identifies(encoded) {
+		return true
+	}
+	return h.preferred.NeedsRehash(encoded)
+}
+
+func (h *PasswordHasher) algorithmFor(encoded string) PasswordAlgorithm {
+	if h.preferred.Identifies(encoded) {
+		return h.preferred
+	}
+	for _, algorithm := range h.legacy {
+		if algorithm.Identifies(encoded) {
+			return algorithm
+		}
+	}
+	return nil
+}
+
+var (
+	defaultHasherOnce sync.Once
+	defaultHasher     *PasswordHasher
+)
+
+// DefaultPasswordHasher returns the process-wide hasher from LoadPasswordHasher
+func DefaultPasswordHasher() *PasswordHasher {
+	defaultHasherOnce.Do(func() {
+		defaultHasher = LoadPasswordHasher()
+	})
+	return defaultHasher
+}
+
+// Argon2idAlgorithm produces PHC strings such as
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type Argon2idAlgorithm struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// Hash implements PasswordAlgorithm
+func (a *Argon2idAlgorithm) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify implements PasswordAlgorithm
+func (a *Argon2idAlgorithm) Verify(password, encoded string) (bool, error) {
+	parsed, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), parsed.salt, parsed.iterations, parsed.memory, parsed.parallelism, uint32(len(parsed.key)))
+	return subtle.ConstantTimeCompare(key, parsed.key) == 1, nil
+}
+
+// Identifies implements PasswordAlgorithm
+func (a *Argon2idAlgorithm) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// NeedsRehash implements PasswordAlgorithm
+func (a *Argon2idAlgorithm) NeedsRehash(encoded string) bool {
+	parsed, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return parsed.memory < a.Memory ||
+		parsed.iterations < a.Iterations ||
+		parsed.parallelism != a.Parallelism ||
+		uint32(len(parsed.salt)) < a.SaltLength ||
+		uint32(len(parsed.key)) < a.KeyLength
+}
+
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	parsed := &argon2idHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsed.memory, &parsed.iterations, &parsed.parallelism); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	var err error
+	if parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	if parsed.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid argon2 hash: %w", err)
+	}
+	return parsed, nil
+}
+
+// BcryptAlgorithm produces standard $2a$ bcrypt hashes
+type BcryptAlgorithm struct {
+	Cost int
+}
+
+// Hash implements PasswordAlgorithm
+func (b *BcryptAlgorithm) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify implements PasswordAlgorithm
+func (b *BcryptAlgorithm) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Identifies implements PasswordAlgorithm
+func (b *BcryptAlgorithm) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// NeedsRehash implements PasswordAlgorithm
+func (b *BcryptAlgorithm) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < b.Cost
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go-crud/initializers"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Password policy violation codes
+const (
+	PasswordTooShort          = "password_too_short"
+	PasswordTooLong           = "password_too_long"
+	PasswordTooFewCharClasses = "password_too_few_character_classes"
+	PasswordMatchesIdentity   = "password_matches_identity"
+	PasswordBreached          = "password_breached"
+)
+
+// PasswordViolation is one way a password fails the policy
+type PasswordViolation struct {
+	Code    string
+	Message string
+}
+
+// PasswordPolicyError lists every rule a rejected password broke
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return "password does not meet policy: " + strings.Join(messages, "; ")
+}
+
+// PasswordPolicy describes what makes a password acceptable
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength defaults to 72 bytes, beyond which bcrypt ignores input
+	MaxLength int
+	// MinCharClasses of lower case, upper case, digits and symbols must appear
+	MinCharClasses int
+	Breached       BreachedPasswordChecker
+}
+
+// LoadPasswordPolicy reads the policy from the environment and checks
+// passwords against the bundled breached-password list
+func LoadPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:      initializers.GetEnvInt("PASSWORD_MIN_LENGTH", 10),
+		MaxLength:      initializers.GetEnvInt("PASSWORD_MAX_LENGTH", 72),
+		MinCharClasses: initializers.GetEnvInt("PASSWORD_MIN_CHAR_CLASSES", 3),
+		Breached:       BundledBreachedPasswords(),
+	}
+}
+
+// Check returns a *PasswordPolicyError describing every violation, or nil.
+// identity holds values the password must not equal, such as the user's
+// name and email.
+func (p PasswordPolicy) Check(ctx context.Context, password string, identity ...string) error {
+	violations := []PasswordViolation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("password must be at most %d bytes", p.MaxLength),
+		})
+	}
+
+	if classes := countCharClasses(password); classes < p.MinCharClasses {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooFewCharClasses,
+			Message: fmt.Sprintf("password must mix at least %d of lower case, upper case, digits and symbols", p.MinCharClasses),
+		})
+	}
+
+	if matchesIdentity(password, identity) {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordMatchesIdentity,
+			Message: "password must not be the same as your name or email",
+		})
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(ctx, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Code:    PasswordBreached,
+				Message: "password is too common or has appeared in a data breach",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func countCharClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+func matchesIdentity(password string, identity []string) bool {
+	for _, value := range identity {
+		if value == "" {
+			continue
+		}
+		candidates := []string{value}
+		if local, _, found := strings.Cut(value, "@"); found {
+			candidates = append(candidates, local)
+		}
+		for _, candidate := range candidates {
+			if strings.EqualFold(password, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
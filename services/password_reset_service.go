@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/mail"
+	"go-crud/models"
+	"go-crud/tracing"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// PasswordResetService issues and redeems single-use password reset tokens
+type PasswordResetService struct {
+	db             *gorm.DB
+	mailer         mail.Mailer
+	passwordPolicy PasswordPolicy
+	ttl            time.Duration
+	resetURL       string
+	now            func() time.Time
+	// run handles a reset request in the background
+	run func(func())
+}
+
+// NewPasswordResetService creates a PasswordResetService. Tokens live for
+// PASSWORD_RESET_TTL and are emailed as links to PASSWORD_RESET_URL by jobs
+// on background.
+func NewPasswordResetService(db *gorm.DB, mailer mail.Mailer, background *Background) *PasswordResetService {
+	return &PasswordResetService{
+		db:             db,
+		mailer:         mailer,
+		passwordPolicy: LoadPasswordPolicy(),
+		ttl:            initializers.GetEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		resetURL:       initializers.GetEnv("PASSWORD_RESET_URL", "http://localhost:8080/reset-password"),
+		now:            time.Now,
+		run:            background.Go,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *PasswordResetService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// RequestReset emails a reset link if email belongs to a user. Unknown
+// emails are silently ignored, and the work happens in the background so
+// the caller returns as quickly either way: neither the answer nor its
+// timing reveals whether an account exists. Failures are only logged.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) {
+	// The request is over before the job is; keep its logger and trace
+	jobCtx := context.WithoutCancel(ctx)
+	s.run(func() {
+		if err := s.sendReset(jobCtx, email); err != nil {
+			logging.FromContext(jobCtx).Error("failed to process password reset request", "error", err)
+		}
+	})
+}
+
+// sendReset issues a reset token for the user with email, if any, and
+// emails them the link
+func (s *PasswordResetService) sendReset(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.RequestReset")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logging.FromContext(ctx).Info("password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
+
+	token := randomToken(32)
+	now := s.now()
+	err := s.db.WithContext(ctx).Create(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask to reset your password, you can ignore this email.\n",
+			user.Name, s.ttl, withToken(s.resetURL, token)),
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("password reset requested", "user_id", user.ID)
+	return nil
+}
+
+// ResetPassword redeems token and sets the user's new password. Every other
+// reset token and every issued access/refresh token for the user is revoked,
+// and any login lockout is cleared.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.ResetPassword")
+	defer span.End()
+
+	now := s.now()
+	var resetToken models.PasswordResetToken
+	err := s.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), now).
+		First(&resetToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, resetToken.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if err := s.passwordPolicy.Check(ctx, newPassword, user.Name, user.Email); err != nil {
+		return err
+	}
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Claiming the token conditionally makes concurrent redemptions safe:
+		// only one of them can flip used_at
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"hashed_password":       hashedPassword,
+			"token_version":         gorm.Expr("token_version + 1"),
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("password reset, existing tokens revoked", "user_id", user.ID)
+	return nil
+}
+
+// hashToken returns the hex SHA-256 of a high-entropy random token. A fast
+// hash is enough because the token cannot be brute forced.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// withToken appends token as the "token" query parameter of link
+func withToken(link, token string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return link + "?token=" + url.QueryEscape(token)
+	}
+	query := parsed.Query()
+	query.Set("token", token)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
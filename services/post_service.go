@@ -1,28 +1,45 @@
 package services
 
 import (
+	"context"
 	"errors"
-	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/metrics"
 	"go-crud/models"
 	"go-crud/schemas"
+	"go-crud/tracing"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 // PostService handles business logic for Post operations
 type PostService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	audit *AuditService
+	now   func() time.Time
 }
 
-// NewPostService creates a new PostService instance
-func NewPostService() *PostService {
+// NewPostService creates a new PostService instance backed by db
+func NewPostService(db *gorm.DB) *PostService {
 	return &PostService{
-		db: initializers.DB,
+		db:    db,
+		audit: NewAuditService(db),
+		now:   time.Now,
 	}
 }
 
+// SetClock replaces the service's time source, for tests
+func (s *PostService) SetClock(now func() time.Time) {
+	s.now = now
+	s.audit.SetClock(now)
+}
+
 // Create creates a new post
-func (s *PostService) Create(post models.Post) (*models.Post, error) {
+func (s *PostService) Create(ctx context.Context, post models.Post) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "PostService.Create")
+	defer span.End()
+
 	if post.Title == "" {
 		return nil, errors.New("title is required")
 	}
@@ -30,18 +47,29 @@ func (s *PostService) Create(post models.Post) (*models.Post, error) {
 		return nil, errors.New("content is required")
 	}
 
-	result := s.db.Create(&post)
-	if result.Error != nil {
-		return nil, result.Error
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		return s.audit.RecordChange(ctx, tx, models.AuditPostCreate, "post", post.ID, nil, post)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to create post", "error", err)
+		return nil, err
 	}
 
+	metrics.PostsCreated.Inc()
+	logging.FromContext(ctx).Info("post created", "post_id", post.ID)
 	return &post, nil
 }
 
 // GetByID retrieves a post by ID
-func (s *PostService) GetByID(id uint) (*models.Post, error) {
+func (s *PostService) GetByID(ctx context.Context, id uint) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "PostService.GetByID")
+	defer span.End()
+
 	var post models.Post
-	result := s.db.First(&post, id)
+	result := s.db.WithContext(ctx).First(&post, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, errors.New("post not found")
@@ -52,10 +80,13 @@ func (s *PostService) GetByID(id uint) (*models.Post, error) {
 	return &post, nil
 }
 
-// GetAll retrieves all posts
-func (s *PostService) GetAll() ([]models.Post, error) {
+// GetAll retrieves all posts shown in public listings
+func (s *PostService) GetAll(ctx context.Context) ([]models.Post, error) {
+	ctx, span := tracing.Start(ctx, "PostService.GetAll")
+	defer span.End()
+
 	var posts []models.Post
-	result := s.db.Find(&posts)
+	result := s.listed(ctx).Find(&posts)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -63,13 +94,17 @@ func (s *PostService) GetAll() ([]models.Post, error) {
 	return posts, nil
 }
 
-// GetPaginated retrieves posts with pagination
-func (s *PostService) GetWithPagination(query schemas.ListPostsQueryParams) ([]models.Post, int64, error) {
+// GetPaginated retrieves posts with pagination, leaving out those hidden
+// from public listings
+func (s *PostService) GetWithPagination(ctx context.Context, query schemas.ListPostsQueryParams) ([]models.Post, int64, error) {
+	ctx, span := tracing.Start(ctx, "PostService.GetWithPagination")
+	defer span.End()
+
 	var posts []models.Post
 	var total int64
 	
 	// Get total count
-	if err := s.db.Model(&models.Post{}).Count(&total).Error; err != nil {
+	if err := s.listed(ctx).Model(&models.Post{}).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 	
@@ -77,7 +112,7 @@ func (s *PostService) GetWithPagination(query schemas.ListPostsQueryParams) ([]m
 	offset := (query.Page - 1) * query.Limit
 	
 	// Get paginated results
-	result := s.db.Limit(query.Limit).Offset(offset).Find(&posts)
+	result := s.listed(ctx).Limit(query.Limit).Offset(offset).Find(&posts)
 	if result.Error != nil {
 		return nil, 0, result.Error
 	}
@@ -86,11 +121,14 @@ func (s *PostService) GetWithPagination(query schemas.ListPostsQueryParams) ([]m
 }
 
 // Update updates an existing post
-func (s *PostService) Update(id uint, updatedPost models.Post) (*models.Post, error) {
+func (s *PostService) Update(ctx context.Context, id uint, updatedPost models.Post) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "PostService.Update")
+	defer span.End()
+
 	var post models.Post
 
 	// Check if post exists
-	result := s.db.First(&post, id)
+	result := s.db.WithContext(ctx).First(&post, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, errors.New("post not found")
@@ -107,24 +145,29 @@ func (s *PostService) Update(id uint, updatedPost models.Post) (*models.Post, er
 	}
 
 	// Update fields
+	before := post
 	post.Title = updatedPost.Title
 	post.Content = updatedPost.Content
 
 	// Save changes
-	result = s.db.Save(&post)
-	if result.Error != nil {
-		return nil, result.Error
+	if err := s.save(ctx, before, &post); err != nil {
+		logging.FromContext(ctx).Error("failed to update post", "post_id", id, "error", err)
+		return nil, err
 	}
 
+	logging.FromContext(ctx).Info("post updated", "post_id", post.ID)
 	return &post, nil
 }
 
 // PartialUpdate updates specific fields of an existing post
-func (s *PostService) PartialUpdate(id uint, partialData map[string]interface{}) (*models.Post, error) {
+func (s *PostService) PartialUpdate(ctx context.Context, id uint, partialData map[string]interface{}) (*models.Post, error) {
+	ctx, span := tracing.Start(ctx, "PostService.PartialUpdate")
+	defer span.End()
+
 	var post models.Post
 
 	// Check if post exists
-	result := s.db.First(&post, id)
+	result := s.db.WithContext(ctx).First(&post, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, errors.New("post not found")
@@ -133,6 +176,7 @@ func (s *PostService) PartialUpdate(id uint, partialData map[string]interface{})
 	}
 
 	// Update only provided fields
+	before := post
 	if title, exists := partialData["title"]; exists {
 		if titleStr, ok := title.(string); ok && titleStr != "" {
 			post.Title = titleStr
@@ -150,20 +194,24 @@ func (s *PostService) PartialUpdate(id uint, partialData map[string]interface{})
 	}
 
 	// Save changes
-	result = s.db.Save(&post)
-	if result.Error != nil {
-		return nil, result.Error
+	if err := s.save(ctx, before, &post); err != nil {
+		logging.FromContext(ctx).Error("failed to update post", "post_id", id, "error", err)
+		return nil, err
 	}
 
+	logging.FromContext(ctx).Info("post updated", "post_id", post.ID)
 	return &post, nil
 }
 
 // Delete deletes a post by ID
-func (s *PostService) Delete(id uint) error {
+func (s *PostService) Delete(ctx context.Context, id uint) error {
+	ctx, span := tracing.Start(ctx, "PostService.Delete")
+	defer span.End()
+
 	var post models.Post
 
 	// Check if post exists
-	result := s.db.First(&post, id)
+	result := s.db.WithContext(ctx).First(&post, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return errors.New("post not found")
@@ -172,6 +220,35 @@ func (s *PostService) Delete(id uint) error {
 	}
 
 	// Delete the post
-	result = s.db.Delete(&post)
-	return result.Error
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&post).Error; err != nil {
+			return err
+		}
+		return s.audit.RecordChange(ctx, tx, models.AuditPostDelete, "post", post.ID, post, nil)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to delete post", "post_id", id, "error", err)
+		return err
+	}
+
+	logging.FromContext(ctx).Info("post deleted", "post_id", id)
+	return nil
+}
+
+// save writes an updated post and its audit entry in one transaction
+func (s *PostService) save(ctx context.Context, before models.Post, post *models.Post) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(post).Error; err != nil {
+			return err
+		}
+		return s.audit.RecordChange(ctx, tx, models.AuditPostUpdate, "post", post.ID, before, *post)
+	})
+}
+
+// listed scopes a query to the posts shown in public listings: posts by
+// suspended users are hidden for as long as the suspension lasts
+func (s *PostService) listed(ctx context.Context) *gorm.DB {
+	suspended := s.db.Model(&models.User{}).Select("id").
+		Where("status = ? AND (status_until IS NULL OR status_until > ?)", models.UserStatusSuspended, s.now())
+	return s.db.WithContext(ctx).Where("user_id IS NULL OR user_id NOT IN (?)", suspended)
 }
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-crud/avatar"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/tracing"
+	"io"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAvatarTooLarge = errors.New("avatar file is too large")
+	ErrAvatarNotFound = errors.New("avatar not found")
+)
+
+// ProfileService serves public profiles and manages avatars
+type ProfileService struct {
+	db       *gorm.DB
+	audit    *AuditService
+	maxBytes int64
+	now      func() time.Time
+}
+
+// NewProfileService creates a ProfileService accepting avatar uploads of up
+// to AVATAR_MAX_BYTES
+func NewProfileService(db *gorm.DB) *ProfileService {
+	return &ProfileService{
+		db:       db,
+		audit:    NewAuditService(db),
+		maxBytes: int64(initializers.GetEnvInt("AVATAR_MAX_BYTES", 5<<20)),
+		now:      time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *ProfileService) SetClock(now func() time.Time) {
+	s.now = now
+	s.audit.SetClock(now)
+}
+
+// MaxAvatarBytes is the largest avatar file accepted
+func (s *ProfileService) MaxAvatarBytes() int64 {
+	return s.maxBytes
+}
+
+// Get returns the public profile of user id as seen by viewerID, zero for
+// anonymous viewers. The email is only shown to the user and to admins, who
+// can also still see deactivated and suspended users.
+func (s *ProfileService) Get(ctx context.Context, id, viewerID uint, viewerIsAdmin bool) (*schemas.Profile, error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Get")
+	defer span.End()
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("erased_at IS NULL").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	privileged := viewerIsAdmin || viewerID == user.ID
+	if !privileged && !user.IsActive(s.now()) {
+		return nil, errors.New("user not found")
+	}
+
+	profile := schemas.NewProfile(user, privileged)
+	return &profile, nil
+}
+
+// UploadAvatar reads a JPEG, PNG or GIF picture from r and replaces the
+// user's avatar with square thumbnails of it. Metadata such as EXIF,
+// including any location, is not kept.
+func (s *ProfileService) UploadAvatar(ctx context.Context, userID uint, r io.Reader) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.UploadAvatar")
+	defer span.End()
+
+	data, err := io.ReadAll(io.LimitReader(r, s.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxBytes {
+		return nil, ErrAvatarTooLarge
+	}
+	thumbnails, err := avatar.Thumbnails(data, avatar.Sizes)
+	if err != nil {
+		logging.FromContext(ctx).Warn("avatar rejected", "user_id", userID, "error", err)
+		return nil, err
+	}
+
+	now := s.now()
+	user, err := s.updateAvatar(ctx, userID, &now, func(tx *gorm.DB) error {
+		for _, size := range avatar.Sizes {
+			err := tx.Create(&models.Avatar{
+				UserID:      userID,
+				Size:        size,
+				ContentType: avatar.ContentType,
+				Data:        thumbnails[size],
+				CreatedAt:   now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("avatar uploaded", "user_id", userID, "bytes", len(data))
+	return user, nil
+}
+
+// DeleteAvatar removes the user's avatar
+func (s *ProfileService) DeleteAvatar(ctx context.Context, userID uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.DeleteAvatar")
+	defer span.End()
+
+	user, err := s.updateAvatar(ctx, userID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("avatar deleted", "user_id", userID)
+	return user, nil
+}
+
+// Avatar returns the user's thumbnail closest in size to, but no smaller
+// than, size; the largest one when size is bigger than any of them
+func (s *ProfileService) Avatar(ctx context.Context, userID uint, size int) (*models.Avatar, error) {
+	ctx, span := tracing.Start(ctx, "ProfileService.Avatar")
+	defer span.End()
+
+	sizes := slices.Sorted(slices.Values(avatar.Sizes))
+	chosen := sizes[len(sizes)-1]
+	for _, candidate := range sizes {
+		if candidate >= size {
+			chosen = candidate
+			break
+		}
+	}
+
+	var thumbnail models.Avatar
+	err := s.db.WithContext(ctx).
+		Joins("JOIN users ON users.id = avatars.user_id AND users.erased_at IS NULL").
+		Where("avatars.user_id = ? AND avatars.size = ?", userID, chosen).
+		First(&thumbnail).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAvatarNotFound
+		}
+		return nil, err
+	}
+	return &thumbnail, nil
+}
+
+// updateAvatar replaces the user's thumbnails with those create writes, or
+// none when create is nil, and records the change in the audit log
+func (s *ProfileService) updateAvatar(ctx context.Context, userID uint, updatedAt *time.Time, create func(tx *gorm.DB) error) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("erased_at IS NULL").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	before := user
+	user.AvatarUpdatedAt = updatedAt
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Avatar{}).Error; err != nil {
+			return err
+		}
+		if create != nil {
+			if err := create(tx); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&user).Update("avatar_updated_at", updatedAt).Error; err != nil {
+			return err
+		}
+		return s.audit.RecordChange(ctx, tx, models.AuditUserUpdate, "user", user.ID, before, user)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to update avatar", "user_id", userID, "error", err)
+		return nil, err
+	}
+	return &user, nil
+}
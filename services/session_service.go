@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/session"
+	"go-crud/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidSession  = errors.New("invalid or expired session")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// lastSeenResolution limits how often an active session's LastSeenAt is
+// written, which also bounds how precisely the idle timeout is applied
+const lastSeenResolution = time.Minute
+
+// SessionService starts, checks and revokes server-side login sessions
+type SessionService struct {
+	db              *gorm.DB
+	store           session.Store
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	now             func() time.Time
+}
+
+// NewSessionService creates a SessionService keeping sessions in store,
+// configured from SESSION_IDLE_TIMEOUT and SESSION_ABSOLUTE_TIMEOUT
+func NewSessionService(db *gorm.DB, store session.Store) *SessionService {
+	return &SessionService{
+		db:              db,
+		store:           store,
+		idleTimeout:     initializers.GetEnvDuration("SESSION_IDLE_TIMEOUT", 30*time.Minute),
+		absoluteTimeout: initializers.GetEnvDuration("SESSION_ABSOLUTE_TIMEOUT", 12*time.Hour),
+		now:             time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *SessionService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// AbsoluteTimeout is the longest a session can last, however active
+func (s *SessionService) AbsoluteTimeout() time.Duration {
+	return s.absoluteTimeout
+}
+
+// Start opens a session for an authenticated user and returns it with the
+// token for the session cookie, which is not stored
+func (s *SessionService) Start(ctx context.Context, user *models.User, userAgent, ip string) (*models.Session, string, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.Start")
+	defer span.End()
+
+	now := s.now()
+	token := randomToken(32)
+	created := &models.Session{
+		ID:           randomToken(16),
+		UserID:       user.ID,
+		TokenHash:    hashToken(token),
+		CSRFToken:    randomToken(32),
+		TokenVersion: user.TokenVersion,
+		UserAgent:    userAgent,
+		IP:           ip,
+		CreatedAt:    now,
+		LastSeenAt:   now,
+		ExpiresAt:    now.Add(s.absoluteTimeout),
+	}
+	if err := s.store.Create(ctx, created); err != nil {
+		return nil, "", err
+	}
+
+	logging.FromContext(ctx).Info("session started", "user_id", user.ID, "session_id", created.ID)
+	return created, token, nil
+}
+
+// Authenticate checks a session cookie token and returns the session and its
+// user. Sessions that went idle, outlived the absolute timeout or belong to
+// a user who has since revoked their tokens are ended.
+func (s *SessionService) Authenticate(ctx context.Context, token string) (*models.User, *models.Session, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.Authenticate")
+	defer span.End()
+
+	current, err := s.store.GetByToken(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, session.ErrNotFound) {
+			return nil, nil, ErrInvalidSession
+		}
+		return nil, nil, err
+	}
+
+	now := s.now()
+	if !now.Before(current.ExpiresAt) || now.Sub(current.LastSeenAt) >= s.idleTimeout {
+		s.end(ctx, current, "expired")
+		return nil, nil, ErrInvalidSession
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, current.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidSession
+		}
+		return nil, nil, err
+	}
+	if user.TokenVersion != current.TokenVersion {
+		s.end(ctx, current, "revoked")
+		return nil, nil, ErrInvalidSession
+	}
+
+	if now.Sub(current.LastSeenAt) >= lastSeenResolution {
+		if err := s.store.Touch(ctx, current.ID, now); err != nil {
+			logging.FromContext(ctx).Warn("failed to record session activity", "session_id", current.ID, "error", err)
+		}
+		current.LastSeenAt = now
+	}
+	return &user, current, nil
+}
+
+// List returns the user's sessions, marking currentID as the current one
+func (s *SessionService) List(ctx context.Context, userID uint, currentID string) ([]models.Session, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.List")
+	defer span.End()
+
+	sessions, err := s.store.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	active := []models.Session{}
+	for _, listed := range sessions {
+		if !now.Before(listed.ExpiresAt) || now.Sub(listed.LastSeenAt) >= s.idleTimeout {
+			continue
+		}
+		listed.Current = listed.ID == currentID
+		active = append(active, listed)
+	}
+	return active, nil
+}
+
+// Revoke ends one of the user's sessions
+func (s *SessionService) Revoke(ctx context.Context, userID uint, id string) error {
+	ctx, span := tracing.Start(ctx, "SessionService.Revoke")
+	defer span.End()
+
+	if err := s.store.Delete(ctx, userID, id); err != nil {
+		if errors.Is(err, session.ErrNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).Info("session revoked", "user_id", userID, "session_id", id)
+	return nil
+}
+
+// RevokeOthers ends every session of the user except keepID, and returns how
+// many were ended
+func (s *SessionService) RevokeOthers(ctx context.Context, userID uint, keepID string) (int, error) {
+	ctx, span := tracing.Start(ctx, "SessionService.RevokeOthers")
+	defer span.End()
+
+	sessions, err := s.store.ListByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, listed := range sessions {
+		if listed.ID == keepID {
+			continue
+		}
+		if err := s.store.Delete(ctx, userID, listed.ID); err != nil && !errors.Is(err, session.ErrNotFound) {
+			return revoked, err
+		}
+		revoked++
+	}
+
+	logging.FromContext(ctx).Info("other sessions revoked", "user_id", userID, "count", revoked)
+	return revoked, nil
+}
+
+// end deletes a session that can no longer be used
+func (s *SessionService) end(ctx context.Context, ended *models.Session, reason string) {
+	if err := s.store.Delete(ctx, ended.UserID, ended.ID); err != nil && !errors.Is(err, session.ErrNotFound) {
+		logging.FromContext(ctx).Warn("failed to delete session", "session_id", ended.ID, "error", err)
+		return
+	}
+	logging.FromContext(ctx).Info("session ended", "user_id", ended.UserID, "session_id", ended.ID, "reason", reason)
+}
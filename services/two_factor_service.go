@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/totp"
+	"go-crud/tracing"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor enrollment has not been started")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+)
+
+// recoveryCodeCount is how many recovery codes a user holds at once
+const recoveryCodeCount = 10
+
+// TwoFactorEnrollment is what a user needs to add the account to an
+// authenticator app
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+	QRCode []byte // PNG
+}
+
+// TwoFactorService enrolls users in TOTP two-factor authentication and checks
+// their codes
+type TwoFactorService struct {
+	db     *gorm.DB
+	issuer string
+	now    func() time.Time
+}
+
+// NewTwoFactorService creates a TwoFactorService; TWO_FACTOR_ISSUER names the
+// account in authenticator apps
+func NewTwoFactorService(db *gorm.DB) *TwoFactorService {
+	return &TwoFactorService{
+		db:     db,
+		issuer: initializers.GetEnv("TWO_FACTOR_ISSUER", "go-crud"),
+		now:    time.Now,
+	}
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *TwoFactorService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// BeginEnrollment gives the user a new secret. It is not enforced until
+// ConfirmEnrollment succeeds, so restarting enrollment is harmless.
+func (s *TwoFactorService) BeginEnrollment(ctx context.Context, userID uint) (*TwoFactorEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.BeginEnrollment")
+	defer span.End()
+
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.HasTwoFactor() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(user).Update("totp_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+
+	logging.FromContext(ctx).Info("two-factor enrollment started", "user_id", user.ID)
+	return s.enrollment(user)
+}
+
+// PendingEnrollment returns the enrollment started by BeginEnrollment, for
+// rendering its QR code again
+func (s *TwoFactorService) PendingEnrollment(ctx context.Context, userID uint) (*TwoFactorEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.PendingEnrollment")
+	defer span.End()
+
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.HasTwoFactor() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	return s.enrollment(user)
+}
+
+// ConfirmEnrollment enables two-factor authentication once the user proves
+// their authenticator works, and returns fresh recovery codes. The codes are
+// only ever shown here.
+func (s *TwoFactorService) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.ConfirmEnrollment")
+	defer span.End()
+
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.HasTwoFactor() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	now := s.now()
+	step, ok := totp.Validate(user.TOTPSecret, code, now, 1)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"two_factor_enabled_at": now,
+			"totp_last_step":        step,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for i := range codes {
+			codes[i] = newRecoveryCode()
+			err := tx.Create(&models.RecoveryCode{
+				UserID:    user.ID,
+				CodeHash:  hashToken(normalizeRecoveryCode(codes[i])),
+				CreatedAt: now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("two-factor authentication enabled", "user_id", user.ID)
+	return codes, nil
+}
+
+// Verify checks a TOTP code, or failing that an unused recovery code, for a
+// user with two-factor enabled. Each TOTP code and recovery code is only
+// accepted once.
+func (s *TwoFactorService) Verify(ctx context.Context, user *models.User, code string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Verify")
+	defer span.End()
+
+	now := s.now()
+	if step, ok := totp.Validate(user.TOTPSecret, code, now, 1); ok {
+		// Conditional update so concurrent logins cannot both spend one code
+		result := s.db.WithContext(ctx).Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		logging.FromContext(ctx).Warn("recovery code used", "user_id", user.ID)
+		return true, nil
+	}
+	return false, nil
+}
+
+// Reset turns two-factor authentication off on behalf of the admin adminID,
+// for users who lost both their authenticator and recovery codes. Existing
+// tokens are revoked.
+func (s *TwoFactorService) Reset(ctx context.Context, userID, adminID uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Reset")
+	defer span.End()
+
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":           "",
+			"two_factor_enabled_at": nil,
+			"totp_last_step":        0,
+			"token_version":         gorm.Expr("token_version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = ""
+	user.TwoFactorEnabledAt = nil
+	logging.FromContext(ctx).Warn("two-factor authentication reset by admin", "user_id", user.ID, "admin_id", adminID)
+	return user, nil
+}
+
+func (s *TwoFactorService) loadUser(ctx context.Context, userID uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *TwoFactorService) enrollment(user *models.User) (*TwoFactorEnrollment, error) {
+	uri := totp.URI(s.issuer, user.Email, user.TOTPSecret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{
+		Secret: user.TOTPSecret,
+		URI:    uri,
+		QRCode: png,
+	}, nil
+}
+
+// newRecoveryCode returns 80 random bits as five dash-separated groups of
+// hex, e.g. "3f9a-1c2b-77d0-e4a5-90b1"
+func newRecoveryCode() string {
+	raw := randomToken(10)
+	groups := make([]string, 0, 5)
+	for i := 0; i < len(raw); i += 4 {
+		groups = append(groups, raw[i:i+4])
+	}
+	return strings.Join(groups, "-")
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes so codes can be typed
+// loosely
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
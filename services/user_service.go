@@ -1,28 +1,45 @@
 package services
 
 import (
+	"context"
 	"errors"
-	"go-crud/initializers"
+	"go-crud/logging"
+	"go-crud/mail"
+	"go-crud/metrics"
 	"go-crud/models"
 	"go-crud/schemas"
+	"go-crud/tracing"
 
 	"gorm.io/gorm"
 )
 
 
 type UserService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	passwordPolicy PasswordPolicy
+	verifications  *EmailVerificationService
+	audit          *AuditService
+	deletion       *AccountDeletionService
 }
 
 
-func NewUserService() *UserService {
+// NewUserService creates a UserService that sends verification emails to
+// new users through mailer
+func NewUserService(db *gorm.DB, mailer mail.Mailer) *UserService {
 	return &UserService{
-		db: initializers.DB,
+		db:             db,
+		passwordPolicy: LoadPasswordPolicy(),
+		verifications:  NewEmailVerificationService(db, mailer),
+		audit:          NewAuditService(db),
+		deletion:       NewAccountDeletionService(db),
 	}
 }
 
 // Create creates a new user
-func (s *UserService) Create(user models.User) (*models.User, error) {
+func (s *UserService) Create(ctx context.Context, user models.User) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Create")
+	defer span.End()
+
 	if user.Name == "" {
 		return nil, errors.New("name is required")
 	}
@@ -32,6 +49,9 @@ func (s *UserService) Create(user models.User) (*models.User, error) {
 	if user.HashedPassword == "" {
 		return nil, errors.New("password is required")
 	}
+	if err := s.passwordPolicy.Check(ctx, user.HashedPassword, user.Name, user.Email); err != nil {
+		return nil, err
+	}
 
 	hashedPassword, err := HashPassword(user.HashedPassword)
 	if err != nil {
@@ -39,13 +59,34 @@ func (s *UserService) Create(user models.User) (*models.User, error) {
 	}
 	user.HashedPassword = hashedPassword
 
-	return &user, s.db.Create(&user).Error
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return s.audit.RecordChange(ctx, tx, models.AuditUserCreate, "user", user.ID, nil, user)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to create user", "error", err)
+		return &user, err
+	}
+
+	metrics.UsersRegistered.Inc()
+	logging.FromContext(ctx).Info("user registered", "user_id", user.ID)
+
+	// The account exists either way; the user can ask for another link
+	if err := s.verifications.Send(ctx, user); err != nil {
+		logging.FromContext(ctx).Error("failed to send verification email", "user_id", user.ID, "error", err)
+	}
+	return &user, nil
 }
 
 // GetByID retrieves a user by ID
-func (s *UserService) GetByID(id uint) (*models.User, error) {
+func (s *UserService) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByID")
+	defer span.End()
+
 	var user models.User
-	result := s.db.First(&user, id)
+	result := s.db.WithContext(ctx).Where("erased_at IS NULL").First(&user, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, errors.New("user not found")
@@ -56,49 +97,62 @@ func (s *UserService) GetByID(id uint) (*models.User, error) {
 }
 
 // Partial Update user fields partially
-func (s *UserService) PartialUpdate(id uint, input schemas.PartialUpdateUserInput) (*models.User, error) {
-	user, err := s.GetByID(id)
+func (s *UserService) PartialUpdate(ctx context.Context, id uint, input schemas.PartialUpdateUserInput) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.PartialUpdate")
+	defer span.End()
+
+	user, err := s.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
+	before := *user
 	if input.Name != nil {
 		user.Name = *input.Name
 	}
-	if input.Email != nil {
-		user.Email = *input.Email
+	if input.DisplayName != nil {
+		user.DisplayName = *input.DisplayName
 	}
-	if input.Password != nil {
-		hashedPassword, err := HashPassword(*input.Password)
-		if err != nil {
-			return nil, errors.New("failed to hash password")
-		}
-		user.HashedPassword = hashedPassword
+	if input.Bio != nil {
+		user.Bio = *input.Bio
+	}
+	if input.Website != nil {
+		user.Website = *input.Website
+	}
+	if input.Location != nil {
+		user.Location = *input.Location
 	}
 
-	result := s.db.Save(user)
-	if result.Error != nil {
-		return nil, result.Error
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		return s.audit.RecordChange(ctx, tx, models.AuditUserUpdate, "user", user.ID, before, *user)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to update user", "user_id", id, "error", err)
+		return nil, err
 	}
 
+	logging.FromContext(ctx).Info("user updated", "user_id", id, "changes", input)
 	return user, nil
 }
 
-// Delete user by ID
-func (s *UserService) Delete(id uint) error {
-	var user models.User
+// Delete erases the user right away, on an admin's behalf. The account is
+// anonymized rather than removed, so rows referencing it, such as their
+// posts, stay valid.
+func (s *UserService) Delete(ctx context.Context, id uint) error {
+	ctx, span := tracing.Start(ctx, "UserService.Delete")
+	defer span.End()
 
-	result := s.db.First(&user, id)
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return errors.New("user not found")
-		}
-		return result.Error
-	}
+	return s.deletion.Erase(ctx, id)
+}
 
-	result = s.db.Delete(&user)
-	if result.Error != nil {
-		return result.Error
-	}
-	return nil
+// ScheduleDeletion schedules the user's own account for erasure after the
+// grace period, once their password checks out
+func (s *UserService) ScheduleDeletion(ctx context.Context, id uint, password string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ScheduleDeletion")
+	defer span.End()
+
+	return s.deletion.Schedule(ctx, id, password)
 }
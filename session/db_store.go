@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"go-crud/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DBStore keeps sessions in the sessions table, so they survive restarts and
+// are shared by every replica
+type DBStore struct {
+	db *gorm.DB
+}
+
+// NewDBStore creates a DBStore on db
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Create implements Store. Sessions of the same user that are past their
+// absolute expiry are removed at the same time, so the table does not grow
+// without bound.
+func (s *DBStore) Create(ctx context.Context, session *models.Session) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND expires_at <= ?", session.UserID, session.CreatedAt).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(session).Error
+	})
+}
+
+// GetByToken implements Store
+func (s *DBStore) GetByToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Touch implements Store
+func (s *DBStore) Touch(ctx context.Context, id string, lastSeen time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", lastSeen).Error
+}
+
+// ListByUser implements Store
+func (s *DBStore) ListByUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// Delete implements Store
+func (s *DBStore) Delete(ctx context.Context, userID uint, id string) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"go-crud/initializers"
+	"go-crud/models"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Store persists sessions. MemoryStore is local to one process, so sessions
+// are lost on restart and not shared between replicas; DBStore keeps them in
+// the application database.
+type Store interface {
+	Create(ctx context.Context, s *models.Session) error
+	// GetByToken finds a session by the hash of its cookie token
+	GetByToken(ctx context.Context, tokenHash string) (*models.Session, error)
+	Touch(ctx context.Context, id string, lastSeen time.Time) error
+	ListByUser(ctx context.Context, userID uint) ([]models.Session, error)
+	// Delete removes the user's session id, or returns ErrNotFound
+	Delete(ctx context.Context, userID uint, id string) error
+}
+
+// StoreFromEnv picks the store named by SESSION_STORE: "database" (the
+// default) or "memory"
+func StoreFromEnv(db *gorm.DB) Store {
+	switch driver := initializers.GetEnv("SESSION_STORE", "database"); driver {
+	case "memory":
+		return NewMemoryStore()
+	case "database":
+		return NewDBStore(db)
+	default:
+		slog.Warn("unknown SESSION_STORE, using database", "store", driver)
+		return NewDBStore(db)
+	}
+}
+
+// MemoryStore is an in-process Store
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]models.Session
+	byToken  map[string]string
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]models.Session),
+		byToken:  make(map[string]string),
+	}
+}
+
+// Create implements Store
+func (s *MemoryStore) Create(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(session.CreatedAt)
+	s.sessions[session.ID] = *session
+	s.byToken[session.TokenHash] = session.ID
+	return nil
+}
+
+// GetByToken implements Store
+func (s *MemoryStore) GetByToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[s.byToken[tokenHash]]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+// Touch implements Store
+func (s *MemoryStore) Touch(ctx context.Context, id string, lastSeen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	session.LastSeenAt = lastSeen
+	s.sessions[id] = session
+	return nil
+}
+
+// ListByUser implements Store
+func (s *MemoryStore) ListByUser(ctx context.Context, userID uint) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(ctx context.Context, userID uint, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.sessions, id)
+	delete(s.byToken, session.TokenHash)
+	return nil
+}
+
+// sweep drops sessions past their absolute expiry. Sessions that only went
+// idle are removed when next used.
+func (s *MemoryStore) sweep(now time.Time) {
+	for id, session := range s.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(s.sessions, id)
+			delete(s.byToken, session.TokenHash)
+		}
+	}
+}
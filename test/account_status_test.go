@@ -0,0 +1,193 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) suspend(admin models.User, userID uint, body map[string]interface{}) *httptest.ResponseRecorder {
+	return suite.authedPost(fmt.Sprintf("/admin/users/%d/suspend", userID), suite.AuthHeader(admin), body)
+}
+
+func TestSuspendBlocksLoginAndWrites(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory(WithPassword("password123"))
+	auth := suite.AuthHeader(user)
+
+	w := suite.suspend(admin, user.ID, map[string]interface{}{"reason": "Posting spam"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response schemas.UserResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, models.UserStatusSuspended, response.Data.Status)
+	assert.Equal(t, "Posting spam", response.Data.StatusReason)
+
+	w = suite.login(user.Email, "password123")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var body schemas.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "account_suspended", body.Code)
+	assert.Contains(t, body.Error, "Posting spam")
+	// A wrong password gives nothing away
+	assert.Equal(t, http.StatusUnauthorized, suite.login(user.Email, "wrong-password").Code)
+
+	// Existing credentials can neither read nor write
+	w = suite.getUser(auth, user.ID)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "account_suspended", body.Code)
+	w = suite.authedPost("/posts", auth, map[string]string{"title": "Hi", "content": "Spam"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "account_suspended", body.Code)
+
+	trail := suite.auditTrail("user", user.ID)
+	if assert.NotEmpty(t, trail) {
+		entry := trail[len(trail)-1]
+		assert.Equal(t, models.AuditUserSuspend, entry.Action)
+		assert.Equal(t, admin.ID, *entry.ActorID)
+		assert.Equal(t, "Posting spam", entry.Details["reason"])
+	}
+
+	// They can still take their data with them
+	var export schemas.DataExportResponse
+	w = suite.authedPost("/users/me/export", auth, nil)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &export)
+	assert.Equal(t, models.DataExportReady, suite.waitForExport(auth, export.Data.ID).Status)
+
+	reinstate := fmt.Sprintf("/admin/users/%d/reinstate", user.ID)
+	assert.Equal(t, http.StatusOK, suite.authedPost(reinstate, suite.AuthHeader(admin), nil).Code)
+	assert.Equal(t, http.StatusConflict, suite.authedPost(reinstate, suite.AuthHeader(admin), nil).Code)
+	assert.Equal(t, http.StatusOK, suite.login(user.Email, "password123").Code)
+	assert.Equal(t, http.StatusCreated, suite.authedPost("/posts", auth, map[string]string{"title": "Hi", "content": "Sorry"}).Code)
+
+	var count int64
+	suite.db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", models.AuditUserReinstate, strconv.FormatUint(uint64(user.ID), 10)).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestSuspensionHidesPostsUntilItEnds(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory(WithPassword("password123"))
+	suite.authedPost("/posts", suite.AuthHeader(user), map[string]string{"title": "Theirs", "content": "Hello"})
+	suite.authedPost("/posts", suite.AuthHeader(admin), map[string]string{"title": "Mine", "content": "Hello"})
+
+	past := time.Now().Add(-time.Hour)
+	assert.Equal(t, http.StatusBadRequest, suite.suspend(admin, user.ID, map[string]interface{}{"reason": "Spam", "until": past}).Code)
+	assert.Equal(t, http.StatusForbidden, suite.suspend(admin, admin.ID, map[string]interface{}{"reason": "Oops"}).Code)
+	until := time.Now().Add(24 * time.Hour)
+	assert.Equal(t, http.StatusOK, suite.suspend(admin, user.ID, map[string]interface{}{"reason": "Spam", "until": until}).Code)
+
+	var list schemas.ListPostsResponse
+	json.Unmarshal(suite.authedGet("/posts?page=1&limit=10", "").Body.Bytes(), &list)
+	assert.Equal(t, 1, list.Total)
+	if assert.Len(t, list.Data, 1) {
+		assert.Equal(t, "Mine", list.Data[0].Title)
+	}
+
+	// Once the suspension runs out, everything is back without a reinstate
+	suite.db.Model(&models.User{}).Where("id = ?", user.ID).Update("status_until", past)
+	json.Unmarshal(suite.authedGet("/posts?page=1&limit=10", "").Body.Bytes(), &list)
+	assert.Equal(t, 2, list.Total)
+	assert.Equal(t, http.StatusOK, suite.login(user.Email, "password123").Code)
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory(WithPassword("password123"))
+	auth := suite.AuthHeader(user)
+
+	assert.Equal(t, http.StatusForbidden, suite.authedPost("/users/me/deactivate", auth, map[string]string{"password": "wrong-password"}).Code)
+	w := suite.authedPost("/users/me/deactivate", auth, map[string]string{"password": "password123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response schemas.UserResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, models.UserStatusDeactivated, response.Data.Status)
+
+	// Logged out everywhere, and a wrong password does not reopen it
+	assert.Equal(t, http.StatusUnauthorized, suite.getUser(auth, user.ID).Code)
+	assert.Equal(t, http.StatusUnauthorized, suite.login(user.Email, "wrong-password").Code)
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.Equal(t, models.UserStatusDeactivated, stored.Status)
+
+	assert.Equal(t, http.StatusOK, suite.authedPost(fmt.Sprintf("/admin/users/%d/reinstate", user.ID), suite.AuthHeader(admin), nil).Code)
+	assert.Equal(t, http.StatusOK, suite.login(user.Email, "password123").Code)
+}
+
+func TestLoggingInReactivatesDeactivatedAccount(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	assert.Equal(t, http.StatusOK, suite.authedPost("/users/me/deactivate", suite.AuthHeader(user), map[string]string{"password": "password123"}).Code)
+
+	w := suite.login(user.Email, "password123")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens schemas.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	auth := "Bearer " + tokens.AccessToken
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.Equal(t, models.UserStatusActive, stored.Status)
+
+	trail := suite.auditTrail("user", user.ID)
+	if assert.NotEmpty(t, trail) {
+		entry := trail[len(trail)-1]
+		assert.Equal(t, models.AuditUserReactivate, entry.Action)
+		assert.Equal(t, user.ID, *entry.ActorID)
+	}
+
+	var export schemas.DataExportResponse
+	w = suite.authedPost("/users/me/export", auth, nil)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &export)
+	assert.Equal(t, models.DataExportReady, suite.waitForExport(auth, export.Data.ID).Status)
+}
+
+func TestSuspendedPostsReturnWhenSuspensionEnds(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory()
+	suite.authedPost("/posts", suite.AuthHeader(user), map[string]string{"title": "Theirs", "content": "Hello"})
+	until := time.Now().Add(24 * time.Hour)
+	assert.Equal(t, http.StatusOK, suite.suspend(admin, user.ID, map[string]interface{}{"reason": "Spam", "until": until}).Code)
+
+	posts := services.NewPostService(suite.db)
+	listed, err := posts.GetAll(t.Context())
+	assert.NoError(t, err)
+	assert.Empty(t, listed)
+
+	// The cutoff follows the service's clock, like User.StatusAt
+	posts.SetClock(func() time.Time { return until })
+	listed, err = posts.GetAll(t.Context())
+	assert.NoError(t, err)
+	assert.Len(t, listed, 1)
+}
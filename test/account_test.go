@@ -0,0 +1,298 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForExport polls the export until it is no longer pending
+func (suite *BaseTestSuite) waitForExport(auth string, id uint) models.DataExport {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := suite.authedGet(fmt.Sprintf("/users/me/export/%d", id), auth)
+		var response schemas.DataExportResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Data.Status != models.DataExportPending || time.Now().After(deadline) {
+			return response.Data
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func readZip(t *testing.T, data []byte) map[string][]byte {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		rc, _ := file.Open()
+		files[file.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	return files
+}
+
+func TestDataExport(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+	suite.authedPost("/posts", auth, map[string]string{"title": "Mine", "content": "Hello"})
+	suite.PostFactory()
+
+	w := suite.authedPost("/users/me/export", auth, nil)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var response schemas.DataExportResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	export := suite.waitForExport(auth, response.Data.ID)
+	assert.Equal(t, models.DataExportReady, export.Status)
+	assert.NotZero(t, export.Size)
+
+	// Nobody else can see it
+	other := suite.AuthHeader(suite.UserFactory())
+	assert.Equal(t, http.StatusNotFound, suite.authedGet(fmt.Sprintf("/users/me/export/%d/download", export.ID), other).Code)
+
+	w = suite.authedGet(fmt.Sprintf("/users/me/export/%d/download", export.ID), auth)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	files := readZip(t, w.Body.Bytes())
+
+	var profile struct {
+		User models.User `json:"user"`
+	}
+	json.Unmarshal(files["profile.json"], &profile)
+	assert.Equal(t, user.Email, profile.User.Email)
+
+	var posts []models.Post
+	json.Unmarshal(files["posts.json"], &posts)
+	if assert.Len(t, posts, 1) {
+		assert.Equal(t, "Mine", posts[0].Title)
+	}
+
+	var entries []models.AuditLog
+	json.Unmarshal(files["audit_log.json"], &entries)
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	assert.Contains(t, actions, models.AuditPostCreate)
+	assert.Contains(t, actions, models.AuditUserExport)
+}
+
+func TestDataExportHidesWhoActedOnTheUser(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+	ctx := services.WithAuditContext(t.Context(), services.AuditContext{ActorID: &admin.ID, IP: "203.0.113.7"})
+	_, err := services.NewAccountStatusService(suite.db).Suspend(ctx, user.ID, admin.ID, "Posting spam", nil)
+	assert.NoError(t, err)
+
+	w := suite.authedPost("/users/me/export", auth, nil)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var response schemas.DataExportResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	export := suite.waitForExport(auth, response.Data.ID)
+	assert.Equal(t, models.DataExportReady, export.Status)
+
+	w = suite.authedGet(fmt.Sprintf("/users/me/export/%d/download", export.ID), auth)
+	files := readZip(t, w.Body.Bytes())
+	var entries []models.AuditLog
+	json.Unmarshal(files["audit_log.json"], &entries)
+	var suspension *models.AuditLog
+	for i := range entries {
+		if entries[i].Action == models.AuditUserSuspend {
+			suspension = &entries[i]
+		}
+	}
+	if assert.NotNil(t, suspension) {
+		assert.Equal(t, "Posting spam", suspension.Details["reason"])
+		assert.Nil(t, suspension.ActorID)
+		assert.Empty(t, suspension.IP)
+	}
+	assert.NotContains(t, string(files["audit_log.json"]), "203.0.113.7")
+}
+
+func TestInterruptedDataExportsFailOnStartup(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+	stuck := models.DataExport{
+		UserID:    user.ID,
+		Status:    models.DataExportPending,
+		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+		CreatedAt: time.Now().Add(-time.Minute),
+	}
+	suite.db.Create(&stuck)
+
+	// The pending export blocks new ones until nothing is building it
+	var response schemas.DataExportResponse
+	json.Unmarshal(suite.authedPost("/users/me/export", auth, nil).Body.Bytes(), &response)
+	assert.Equal(t, stuck.ID, response.Data.ID)
+
+	exports := services.NewDataExportService(suite.db, services.NewBackground())
+	count, err := exports.FailInterrupted(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	json.Unmarshal(suite.authedPost("/users/me/export", auth, nil).Body.Bytes(), &response)
+	assert.NotEqual(t, stuck.ID, response.Data.ID)
+	assert.Equal(t, models.DataExportReady, suite.waitForExport(auth, response.Data.ID).Status)
+}
+
+func TestDeleteAccountHasGracePeriod(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	auth := suite.AuthHeader(user)
+
+	w := suite.authedRequest("DELETE", "/users/me", auth, map[string]string{"password": "wrong-password"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = suite.authedRequest("DELETE", "/users/me", auth, map[string]string{"password": "password123"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var response schemas.UserResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if assert.NotNil(t, response.Data.DeletionScheduledAt) {
+		assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), *response.Data.DeletionScheduledAt, time.Minute)
+	}
+
+	// Every token is revoked, but logging in again still works
+	assert.Equal(t, http.StatusUnauthorized, suite.authedPost("/users/me/restore", auth, nil).Code)
+	var tokens schemas.TokenResponse
+	json.Unmarshal(suite.login(user.Email, "password123").Body.Bytes(), &tokens)
+	auth = "Bearer " + tokens.AccessToken
+
+	assert.Equal(t, http.StatusOK, suite.authedPost("/users/me/restore", auth, nil).Code)
+	assert.Equal(t, http.StatusConflict, suite.authedPost("/users/me/restore", auth, nil).Code)
+	suite.db.First(&user, user.ID)
+	assert.Nil(t, user.DeletionScheduledAt)
+}
+
+func TestEraseAnonymizesAccount(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	auth := suite.AuthHeader(user)
+	w := suite.authedPost("/posts", auth, map[string]string{"title": "Kept", "content": "Hello"})
+	var post schemas.PostResponse
+	json.Unmarshal(w.Body.Bytes(), &post)
+	suite.createAPIKey(user, models.ScopePostsRead)
+	suite.authedRequest("PATCH", fmt.Sprintf("/users/%d", user.ID), auth, map[string]string{"bio": "Lives at 12 Nguyen Hue"})
+	suite.authedRequest("DELETE", "/users/me", auth, map[string]string{"password": "password123"})
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	until := time.Now().Add(90 * 24 * time.Hour)
+	assert.Equal(t, http.StatusOK, suite.suspend(admin, user.ID, map[string]interface{}{"reason": "Posted a neighbour's address", "until": until}).Code)
+
+	deletion := services.NewAccountDeletionService(suite.db)
+	count, err := deletion.EraseDue(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	deletion.SetClock(func() time.Time { return time.Now().Add(31 * 24 * time.Hour) })
+	count, err = deletion.EraseDue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	var erased models.User
+	suite.db.First(&erased, user.ID)
+	assert.Equal(t, services.ErasedUserName, erased.Name)
+	assert.NotEqual(t, user.Email, erased.Email)
+	assert.NotNil(t, erased.ErasedAt)
+	assert.Equal(t, models.UserStatusActive, erased.Status)
+	assert.Empty(t, erased.StatusReason)
+	assert.Nil(t, erased.StatusUntil)
+	assert.Equal(t, http.StatusUnauthorized, suite.login(user.Email, "password123").Code)
+	assert.Equal(t, http.StatusNotFound, suite.getUser(suite.AuthHeader(suite.UserFactory()), user.ID).Code)
+
+	// Content stays, attributed to the anonymized account
+	var kept models.Post
+	suite.db.First(&kept, post.Data.ID)
+	assert.Equal(t, "Kept", kept.Title)
+	assert.Equal(t, user.ID, *kept.UserID)
+
+	var keys int64
+	suite.db.Model(&models.APIKey{}).Where("user_id = ?", user.ID).Count(&keys)
+	assert.Zero(t, keys)
+
+	// Earlier audit entries keep what happened, but not the personal data
+	trail := suite.auditTrail("user", user.ID)
+	assert.Equal(t, models.AuditUserUpdate, trail[0].Action)
+	assert.Equal(t, logging.Redacted, trail[0].After["bio"])
+	for _, entry := range trail {
+		if entry.Action == models.AuditUserSuspend {
+			assert.Equal(t, logging.Redacted, entry.Details["reason"])
+		}
+	}
+	assert.Equal(t, models.AuditUserDelete, trail[len(trail)-1].Action)
+	encoded, _ := json.Marshal(trail)
+	assert.NotContains(t, string(encoded), "Nguyen Hue")
+	assert.NotContains(t, string(encoded), "neighbour's address")
+}
+
+func TestDeleteUserKeepsPosts(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	w := suite.authedPost("/posts", suite.AuthHeader(user), map[string]string{"title": "Kept", "content": "Hello"})
+	var post schemas.PostResponse
+	json.Unmarshal(w.Body.Bytes(), &post)
+
+	admin := suite.AuthHeader(suite.UserFactory(WithRole(models.RoleAdmin)))
+	assert.Equal(t, http.StatusOK, suite.authedRequest("DELETE", fmt.Sprintf("/users/%d", user.ID), admin, nil).Code)
+	assert.Equal(t, http.StatusNotFound, suite.authedRequest("DELETE", fmt.Sprintf("/users/%d", user.ID), admin, nil).Code)
+	assert.Equal(t, http.StatusOK, suite.authedGet(fmt.Sprintf("/posts/%d", post.Data.ID), "").Code)
+}
+
+func TestDeleteUserRequiresOwnerOrAdmin(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	assert.Equal(t, http.StatusUnauthorized, suite.authedRequest("DELETE", path, "", nil).Code)
+	assert.Equal(t, http.StatusForbidden, suite.authedRequest("DELETE", path, suite.AuthHeader(suite.UserFactory()), nil).Code)
+
+	// The owner goes through the same password check and grace period as
+	// DELETE /users/me
+	auth := suite.AuthHeader(user)
+	assert.Equal(t, http.StatusForbidden, suite.authedRequest("DELETE", path, auth, map[string]string{"password": "wrong-password"}).Code)
+	w := suite.authedRequest("DELETE", path, auth, map[string]string{"password": "password123"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.NotNil(t, stored.DeletionScheduledAt)
+	assert.Nil(t, stored.ErasedAt)
+}
@@ -0,0 +1,202 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createAPIKey issues a key for user through the API and returns it
+func (suite *BaseTestSuite) createAPIKey(user models.User, scopes ...string) schemas.CreateAPIKeyResponse {
+	w := suite.authedPost("/users/me/api-keys", suite.AuthHeader(user), map[string]interface{}{
+		"name":   "CI",
+		"scopes": scopes,
+	})
+	if w.Code != http.StatusCreated {
+		suite.t.Fatalf("Failed to create API key: %s", w.Body.String())
+	}
+	var response schemas.CreateAPIKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+func (suite *BaseTestSuite) withAPIKey(method, path, apiKey string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.APIKeyHeader, apiKey)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+var testPost = map[string]string{"title": "Deployed", "content": "Released from CI"}
+
+func TestAPIKeyCreatesPosts(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	created := suite.createAPIKey(user, models.ScopePostsWrite)
+	assert.True(t, strings.HasPrefix(created.Key, created.Data.Prefix+"."))
+	assert.Equal(t, []string{models.ScopePostsWrite}, created.Data.Scopes)
+
+	var stored models.APIKey
+	suite.db.First(&stored, created.Data.ID)
+	assert.NotContains(t, stored.SecretHash, strings.TrimPrefix(created.Key, created.Data.Prefix+"."))
+	assert.Nil(t, stored.LastUsedAt)
+
+	w := suite.withAPIKey("POST", "/posts", created.Key, testPost)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	suite.db.First(&stored, created.Data.ID)
+	assert.NotNil(t, stored.LastUsedAt)
+}
+
+func TestAPIKeyIsLimitedToItsScopes(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	created := suite.createAPIKey(user, models.ScopePostsRead)
+
+	assert.Equal(t, http.StatusOK, suite.withAPIKey("GET", "/posts", created.Key, nil).Code)
+
+	w := suite.withAPIKey("POST", "/posts", created.Key, testPost)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "insufficient_scope")
+
+	// Keys cannot manage keys or account settings, whatever their scopes
+	w = suite.withAPIKey("POST", "/users/me/api-keys", created.Key, map[string]interface{}{
+		"name":   "escalated",
+		"scopes": models.APIKeyScopes,
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "scope_not_allowed")
+}
+
+func TestAPIKeyListAndRevoke(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	other := suite.UserFactory()
+	created := suite.createAPIKey(user, models.ScopePostsWrite)
+	suite.createAPIKey(other, models.ScopePostsWrite)
+
+	req, _ := http.NewRequest("GET", "/users/me/api-keys", nil)
+	req.Header.Set("Authorization", suite.AuthHeader(user))
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+
+	var list schemas.ListAPIKeysResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, created.Data.Prefix, list.Data[0].Prefix)
+
+	path := "/users/me/api-keys/" + strconv.FormatUint(uint64(created.Data.ID), 10)
+
+	// Another user cannot revoke the key
+	req, _ = http.NewRequest("DELETE", path, nil)
+	req.Header.Set("Authorization", suite.AuthHeader(other))
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("DELETE", path, nil)
+	req.Header.Set("Authorization", suite.AuthHeader(user))
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, suite.withAPIKey("POST", "/posts", created.Key, testPost).Code)
+}
+
+func TestAPIKeyExpires(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	w := suite.authedPost("/users/me/api-keys", suite.AuthHeader(user), map[string]interface{}{
+		"name":       "CI",
+		"scopes":     []string{models.ScopePostsWrite},
+		"expires_at": time.Now().Add(-time.Hour),
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	created := suite.createAPIKey(user, models.ScopePostsWrite)
+	suite.db.Model(&models.APIKey{}).Where("id = ?", created.Data.ID).Update("expires_at", time.Now().Add(-time.Minute))
+
+	assert.Equal(t, http.StatusUnauthorized, suite.withAPIKey("POST", "/posts", created.Key, testPost).Code)
+}
+
+func TestAPIKeyRevokedByPasswordChange(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	created := suite.createAPIKey(user, models.ScopePostsWrite)
+	assert.Equal(t, http.StatusCreated, suite.withAPIKey("POST", "/posts", created.Key, testPost).Code)
+
+	w := suite.changePassword(suite.AuthHeader(user), "password123", "Corr3ct-Horse-Battery")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, suite.withAPIKey("POST", "/posts", created.Key, testPost).Code)
+
+	// Keys created afterwards work
+	suite.db.First(&user, user.ID)
+	fresh := suite.createAPIKey(user, models.ScopePostsWrite)
+	assert.Equal(t, http.StatusCreated, suite.withAPIKey("POST", "/posts", fresh.Key, testPost).Code)
+
+	var list schemas.ListAPIKeysResponse
+	json.Unmarshal(suite.authedGet("/users/me/api-keys", suite.AuthHeader(user)).Body.Bytes(), &list)
+	if assert.Len(t, list.Data, 1) {
+		assert.Equal(t, fresh.Data.ID, list.Data[0].ID)
+	}
+}
+
+func TestAPIKeyRejectsBadInput(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+
+	w := suite.authedPost("/users/me/api-keys", auth, map[string]interface{}{
+		"name":   "CI",
+		"scopes": []string{"admin:everything"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	created := suite.createAPIKey(user, models.ScopePostsWrite)
+	tampered := created.Key[:len(created.Key)-1] + "x"
+	assert.Equal(t, http.StatusUnauthorized, suite.withAPIKey("POST", "/posts", tampered, testPost).Code)
+	assert.Equal(t, http.StatusUnauthorized, suite.withAPIKey("POST", "/posts", "not-a-key", testPost).Code)
+
+	// One credential per request
+	jsonData, _ := json.Marshal(testPost)
+	req, _ := http.NewRequest("POST", "/posts", bytes.NewBuffer(jsonData))
+	req.Header.Set("Authorization", auth)
+	req.Header.Set(middleware.APIKeyHeader, created.Key)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
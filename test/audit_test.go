@@ -0,0 +1,157 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-crud/logging"
+	"go-crud/models"
+	"go-crud/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) authedRequest(method, path, authHeader string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authHeader)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+// auditTrail returns the audit entries for a resource, oldest first
+func (suite *BaseTestSuite) auditTrail(resourceType string, id uint) []models.AuditLog {
+	var entries []models.AuditLog
+	suite.db.Where("resource_type = ? AND resource_id = ?", resourceType, strconv.FormatUint(uint64(id), 10)).Order("id").Find(&entries)
+	return entries
+}
+
+func TestAuditRecordsPostMutations(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+	w := suite.authedPost("/posts", auth, map[string]string{"title": "Draft", "content": "Hello"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created schemas.PostResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := fmt.Sprintf("/posts/%d", created.Data.ID)
+
+	assert.Equal(t, http.StatusOK, suite.authedRequest("PATCH", path, auth, map[string]string{"title": "Published"}).Code)
+	w = suite.authedRequest("DELETE", path, auth, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	entries := suite.auditTrail("post", created.Data.ID)
+	if !assert.Len(t, entries, 3) {
+		return
+	}
+	for _, entry := range entries {
+		assert.Equal(t, user.ID, *entry.ActorID)
+	}
+
+	assert.Equal(t, models.AuditPostCreate, entries[0].Action)
+	assert.Nil(t, entries[0].Before)
+	assert.Equal(t, "Draft", entries[0].After["title"])
+
+	// Updates keep only what changed
+	assert.Equal(t, models.AuditPostUpdate, entries[1].Action)
+	assert.Equal(t, "Draft", entries[1].Before["title"])
+	assert.Equal(t, "Published", entries[1].After["title"])
+	assert.NotContains(t, entries[1].After, "content")
+
+	assert.Equal(t, models.AuditPostDelete, entries[2].Action)
+	assert.Equal(t, "Published", entries[2].Before["title"])
+	assert.Nil(t, entries[2].After)
+	assert.Equal(t, w.Header().Get("X-Request-ID"), entries[2].RequestID)
+}
+
+func TestAuditMasksSecrets(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	email := gofakeit.Email()
+	w := suite.postJSON("/users", map[string]string{
+		"name":     gofakeit.Name(),
+		"email":    email,
+		"password": "Corr3ct-Horse-Battery",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var user models.User
+	suite.db.Where("email = ?", email).First(&user)
+
+	entries := suite.auditTrail("user", user.ID)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, models.AuditUserCreate, entries[0].Action)
+		assert.Nil(t, entries[0].ActorID)
+		assert.Equal(t, email, entries[0].After["email"])
+		assert.Equal(t, logging.Redacted, entries[0].After["hashed_password"])
+		assert.Equal(t, "", entries[0].After["totp_secret"])
+	}
+
+	var raw string
+	suite.db.Raw("SELECT after FROM audit_logs WHERE id = ?", entries[0].ID).Scan(&raw)
+	assert.NotContains(t, raw, user.HashedPassword)
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	post := suite.PostFactory()
+	assert.Equal(t, http.StatusOK, suite.authedRequest("DELETE", fmt.Sprintf("/posts/%d", post.ID), "", nil).Code)
+	entry := suite.auditTrail("post", post.ID)[0]
+
+	assert.ErrorIs(t, suite.db.Model(&entry).Update("action", "post.create").Error, models.ErrAuditLogAppendOnly)
+	assert.ErrorIs(t, suite.db.Delete(&entry).Error, models.ErrAuditLogAppendOnly)
+	assert.Len(t, suite.auditTrail("post", post.ID), 1)
+}
+
+func TestAdminAuditListAndExport(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory()
+	for _, title := range []string{"One", "Two", "Three"} {
+		suite.authedPost("/posts", suite.AuthHeader(user), map[string]string{"title": title, "content": "Hello"})
+	}
+	filter := fmt.Sprintf("?action=post.create&actor_id=%d", user.ID)
+
+	w := suite.authedGet("/admin/audit"+filter+"&limit=2", suite.AuthHeader(admin))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page schemas.ListAuditLogsResponse
+	json.Unmarshal(w.Body.Bytes(), &page)
+	assert.Equal(t, 3, page.Total)
+	if assert.Len(t, page.Data, 2) {
+		assert.Equal(t, "Three", page.Data[0].After["title"])
+	}
+
+	w = suite.authedGet("/admin/audit/export"+filter, suite.AuthHeader(admin))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	titles := []interface{}{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var entry models.AuditLog
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		titles = append(titles, entry.After["title"])
+	}
+	assert.Equal(t, []interface{}{"One", "Two", "Three"}, titles)
+
+	assert.Equal(t, http.StatusBadRequest, suite.authedGet("/admin/audit?since=yesterday", suite.AuthHeader(admin)).Code)
+	assert.Equal(t, http.StatusForbidden, suite.authedGet("/admin/audit", suite.AuthHeader(user)).Code)
+}
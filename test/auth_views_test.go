@@ -0,0 +1,245 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) login(email, password string) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(map[string]string{
+		"email":    email,
+		"password": password,
+	})
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginSuccess(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	w := suite.login(user.Email, "password123")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response schemas.TokenResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, response.AccessToken)
+	assert.NotEmpty(t, response.RefreshToken)
+	assert.Equal(t, "Bearer", response.TokenType)
+	assert.Equal(t, 900, response.ExpiresIn)
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	w := suite.login(user.Email, "wrong-password")
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var response schemas.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Invalid email or password", response.Error)
+}
+
+func TestLoginUnknownEmailLooksLikeWrongPassword(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	w := suite.login("nobody@example.com", "password123")
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var response schemas.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Invalid email or password", response.Error)
+}
+
+func TestLoginAppliesProgressiveDelay(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	for i := 0; i < 3; i++ {
+		w := suite.login(user.Email, "wrong-password")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Even the right password is refused until the delay has passed
+	w := suite.login(user.Email, "password123")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+}
+
+func TestRefreshTokenSuccess(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	var tokens schemas.TokenResponse
+	json.Unmarshal(suite.login(user.Email, "password123").Body.Bytes(), &tokens)
+
+	jsonData, _ := json.Marshal(map[string]string{"refresh_token": tokens.RefreshToken})
+	req, _ := http.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response schemas.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NotEmpty(t, response.AccessToken)
+}
+
+func TestRefreshRejectsAccessToken(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	var tokens schemas.TokenResponse
+	json.Unmarshal(suite.login(user.Email, "password123").Body.Bytes(), &tokens)
+
+	jsonData, _ := json.Marshal(map[string]string{"refresh_token": tokens.AccessToken})
+	req, _ := http.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAccountLocksAfterRepeatedFailuresAndUnlocksAutomatically(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := services.NewAuthService(suite.db, services.NewTokenService(), services.LoginPolicy{
+		MaxFailures:     3,
+		LockoutDuration: 30 * time.Minute,
+		Window:          15 * time.Minute,
+	})
+	service.SetClock(func() time.Time { return now })
+
+	user := suite.UserFactory(WithPassword("password123"))
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, _, err := service.Login(ctx, user.Email, "wrong-password", "203.0.113.7")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	}
+
+	// The lock is only revealed to someone who knows the password
+	_, _, err := service.Login(ctx, user.Email, "wrong-password", "203.0.113.7")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	_, _, err = service.Login(ctx, user.Email, "password123", "203.0.113.7")
+	assert.ErrorIs(t, err, services.ErrAccountLocked)
+
+	var lockouts []models.AccountLockout
+	suite.db.Where("user_id = ?", user.ID).Find(&lockouts)
+	assert.Len(t, lockouts, 1)
+	assert.Equal(t, "203.0.113.7", lockouts[0].IP)
+
+	now = now.Add(31 * time.Minute)
+	_, tokens, err := service.Login(ctx, user.Email, "password123", "203.0.113.7")
+	assert.NoError(t, err)
+	assert.NotNil(t, tokens)
+}
+
+func TestLoginBlocksIPAfterTooManyFailures(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	service := services.NewAuthService(suite.db, services.NewTokenService(), services.LoginPolicy{
+		Window:        15 * time.Minute,
+		IPMaxFailures: 2,
+	})
+
+	ctx := context.Background()
+	ip := "198.51.100.23"
+	service.Login(ctx, "first@example.com", "guess", ip)
+	service.Login(ctx, "second@example.com", "guess", ip)
+
+	user := suite.UserFactory(WithPassword("password123"))
+	_, _, err := service.Login(ctx, user.Email, "password123", ip)
+
+	var tooMany *services.TooManyAttemptsError
+	assert.True(t, errors.As(err, &tooMany))
+
+	_, _, err = service.Login(ctx, user.Email, "password123", "198.51.100.24")
+	assert.NoError(t, err)
+}
+
+func TestAdminUnlockUser(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	lockedUntil := time.Now().Add(time.Hour)
+	user := suite.UserFactory(WithPassword("password123"), func(u *models.User) {
+		u.LockedUntil = &lockedUntil
+	})
+
+	w := suite.login(user.Email, "wrong-password")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = suite.login(user.Email, "password123")
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	req, _ := http.NewRequest("POST", "/admin/users/"+strconv.FormatUint(uint64(user.ID), 10)+"/unlock", nil)
+	req.Header.Set("Authorization", suite.AuthHeader(admin))
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = suite.login(user.Email, "password123")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAdminUnlockUserRequiresAdmin(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	path := "/admin/users/" + strconv.FormatUint(uint64(user.ID), 10) + "/unlock"
+
+	req, _ := http.NewRequest("POST", path, nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("POST", path, nil)
+	req.Header.Set("Authorization", suite.AuthHeader(user))
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
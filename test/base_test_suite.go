@@ -2,17 +2,31 @@ package test
 
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"go-crud/initializers"
+	"go-crud/mail"
 	"go-crud/models"
 	"go-crud/router"
+	"go-crud/services"
+	"net/url"
+	"os"
+	"regexp"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 
+// BaseTestSuite runs a single test inside its own database transaction, so
+// tests can run in parallel and never touch rows they did not create.
 type BaseTestSuite struct {
 	router *gin.Engine
+	db *gorm.DB
+	mailer mail.Mailer
+	workers *router.Workers
 	t *testing.T
 }
 
@@ -23,17 +37,72 @@ func NewTestSuite(t *testing.T) *BaseTestSuite {
 }
 
 func (suite *BaseTestSuite) SetUp() {
-	gin.SetMode(gin.TestMode)
-	suite.router = router.SetupRouter()
-	suite.CleanUp()
+	suite.db = initializers.DB.Begin()
+	if suite.db.Error != nil {
+		suite.t.Fatalf("Failed to begin test transaction: %v", suite.db.Error)
+	}
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		suite.t.Fatalf("Failed to create mailer: %v", err)
+	}
+	suite.mailer = mailer
+	suite.workers = router.NewWorkers(suite.db)
+	suite.router = router.NewRouter(suite.db, suite.mailer, suite.workers)
 }
 
-func (suite *BaseTestSuite) CleanUp() {
-	initializers.DB.Where("1 = 1").Delete(&models.Post{})
-	initializers.DB.Where("1 = 1").Delete(&models.User{})
+func (suite *BaseTestSuite) TearDown() {
+	// Background jobs still use the transaction until they finish
+	suite.workers.Wait(context.Background())
+	suite.db.Rollback()
 }
 
-func (suite *BaseTestSuite) TearDown() {
-	suite.CleanUp()
+// AuthHeader returns an Authorization header value carrying a fresh access
+// token for user
+func (suite *BaseTestSuite) AuthHeader(user models.User) string {
+	tokens, err := services.NewTokenService().Issue(user)
+	if err != nil {
+		suite.t.Fatalf("Failed to issue token: %v", err)
+	}
+	return "Bearer " + tokens.AccessToken
+}
+
+// LastMailTo returns the most recent email the file mailer recorded for to
+func (suite *BaseTestSuite) LastMailTo(to string) mail.Message {
+	// Some emails, such as password resets, are sent in the background
+	suite.workers.Wait(context.Background())
+
+	file, err := os.Open(os.Getenv("MAIL_FILE"))
+	if err != nil {
+		suite.t.Fatalf("Failed to open mail file: %v", err)
+	}
+	defer file.Close()
+
+	var last *mail.Message
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message mail.Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err == nil && message.To == to {
+			last = &message
+		}
+	}
+	if last == nil {
+		suite.t.Fatalf("No email sent to %s", to)
+	}
+	return *last
 }
 
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// MailToken extracts the "token" query parameter from the first link in an
+// email body
+func (suite *BaseTestSuite) MailToken(message mail.Message) string {
+	link, err := url.Parse(linkPattern.FindString(message.Body))
+	if err != nil {
+		suite.t.Fatalf("Failed to parse link in email: %v", err)
+	}
+	token := link.Query().Get("token")
+	if token == "" {
+		suite.t.Fatalf("No token in email link: %q", message.Body)
+	}
+	return token
+}
@@ -0,0 +1,23 @@
+package test
+
+import (
+	"context"
+	"go-crud/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPrefixCheckerMatchesBundledList(t *testing.T) {
+	t.Parallel()
+
+	checker := services.BundledBreachedPasswords()
+
+	breached, err := checker.IsBreached(context.Background(), "P@ssw0rd")
+	assert.NoError(t, err)
+	assert.True(t, breached)
+
+	breached, err = checker.IsBreached(context.Background(), "Corr3ct-Horse-Battery")
+	assert.NoError(t, err)
+	assert.False(t, breached)
+}
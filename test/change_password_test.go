@@ -0,0 +1,118 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-crud/models"
+	"go-crud/schemas"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) changePassword(authHeader, currentPassword, newPassword string) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(map[string]string{
+		"current_password": currentPassword,
+		"new_password":     newPassword,
+	})
+	req, _ := http.NewRequest("POST", "/users/me/password", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BaseTestSuite) refresh(refreshToken string) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	req, _ := http.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BaseTestSuite) getUser(authHeader string, id uint) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/users/"+strconv.FormatUint(uint64(id), 10), nil)
+	req.Header.Set("Authorization", authHeader)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestChangePasswordRevokesExistingTokens(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	var oldTokens schemas.TokenResponse
+	json.Unmarshal(suite.login(user.Email, "password123").Body.Bytes(), &oldTokens)
+	oldAuth := "Bearer " + oldTokens.AccessToken
+
+	w := suite.changePassword(oldAuth, "password123", "Corr3ct-Horse-Battery")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var newTokens schemas.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &newTokens)
+	assert.NotEmpty(t, newTokens.AccessToken)
+
+	assert.Equal(t, http.StatusUnauthorized, suite.getUser(oldAuth, user.ID).Code)
+	assert.Equal(t, http.StatusUnauthorized, suite.refresh(oldTokens.RefreshToken).Code)
+	assert.Equal(t, http.StatusOK, suite.getUser("Bearer "+newTokens.AccessToken, user.ID).Code)
+	assert.Equal(t, http.StatusOK, suite.refresh(newTokens.RefreshToken).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, suite.login(user.Email, "password123").Code)
+	assert.Equal(t, http.StatusOK, suite.login(user.Email, "Corr3ct-Horse-Battery").Code)
+}
+
+func TestChangePasswordRequiresCurrentPassword(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+
+	w := suite.changePassword(suite.AuthHeader(user), "not-my-password", "Corr3ct-Horse-Battery")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.Equal(t, user.HashedPassword, stored.HashedPassword)
+	assert.Equal(t, 0, stored.TokenVersion)
+}
+
+func TestChangePasswordRequiresAuthentication(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	w := suite.changePassword("", "password123", "Corr3ct-Horse-Battery")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestChangePasswordEnforcesPolicy(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithEmail("Str0ng.Local-Part@example.com"), WithPassword("password123"))
+
+	w := suite.changePassword(suite.AuthHeader(user), "password123", "Str0ng.Local-Part")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response schemas.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "password_policy", response.Code)
+	assert.Len(t, response.Details, 1)
+	assert.Equal(t, "password_matches_identity", response.Details[0].Code)
+}
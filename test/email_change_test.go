@@ -0,0 +1,169 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-crud/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) changeEmail(authHeader, newEmail, password string) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(map[string]string{
+		"new_email": newEmail,
+		"password":  password,
+	})
+	req, _ := http.NewRequest("POST", "/users/me/email", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authHeader)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BaseTestSuite) get(path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path+"?token="+url.QueryEscape(token), nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestEmailChangeAppliesOnlyOnceConfirmed(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	newEmail := gofakeit.Email()
+
+	w := suite.changeEmail(suite.AuthHeader(user), newEmail, "password123")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.Equal(t, user.Email, stored.Email)
+
+	token := suite.MailToken(suite.LastMailTo(newEmail))
+	w = suite.get("/auth/email/confirm", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	suite.db.First(&stored, user.ID)
+	assert.Equal(t, newEmail, stored.Email)
+	assert.True(t, stored.IsEmailVerified())
+
+	notice := suite.LastMailTo(user.Email)
+	assert.Equal(t, "Your email address was changed", notice.Subject)
+	assert.Contains(t, notice.Body, newEmail)
+
+	assert.Equal(t, http.StatusBadRequest, suite.get("/auth/email/confirm", token).Code)
+}
+
+func TestEmailChangeRequiresPassword(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+
+	w := suite.changeEmail(suite.AuthHeader(user), gofakeit.Email(), "wrong-password")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestEmailChangeRevertRestoresOldAddressAndRevokesTokens(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	auth := suite.AuthHeader(user)
+	newEmail := gofakeit.Email()
+
+	suite.changeEmail(auth, newEmail, "password123")
+	suite.get("/auth/email/confirm", suite.MailToken(suite.LastMailTo(newEmail)))
+	revertToken := suite.MailToken(suite.LastMailTo(user.Email))
+
+	w := suite.get("/auth/email/revert", revertToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.Equal(t, user.Email, stored.Email)
+	assert.Equal(t, http.StatusUnauthorized, suite.getUser(auth, user.ID).Code)
+
+	assert.Equal(t, http.StatusBadRequest, suite.get("/auth/email/revert", revertToken).Code)
+}
+
+func TestEmailChangeRevertLinkExpires(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	newEmail := gofakeit.Email()
+
+	suite.changeEmail(suite.AuthHeader(user), newEmail, "password123")
+	suite.get("/auth/email/confirm", suite.MailToken(suite.LastMailTo(newEmail)))
+	revertToken := suite.MailToken(suite.LastMailTo(user.Email))
+
+	suite.db.Model(&models.EmailChange{}).Where("user_id = ?", user.ID).
+		Update("revert_expires_at", time.Now().Add(-time.Minute))
+
+	assert.Equal(t, http.StatusBadRequest, suite.get("/auth/email/revert", revertToken).Code)
+}
+
+func TestEmailChangeRejectsTakenAddress(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	other := suite.UserFactory()
+
+	w := suite.changeEmail(suite.AuthHeader(user), other.Email, "password123")
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestEmailChangeConfirmLosesRaceForAddress(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	first := suite.UserFactory(WithPassword("password123"))
+	second := suite.UserFactory(WithPassword("password123"))
+	newEmail := gofakeit.Email()
+
+	suite.changeEmail(suite.AuthHeader(first), newEmail, "password123")
+	firstToken := suite.MailToken(suite.LastMailTo(newEmail))
+	suite.changeEmail(suite.AuthHeader(second), newEmail, "password123")
+	secondToken := suite.MailToken(suite.LastMailTo(newEmail))
+
+	assert.Equal(t, http.StatusOK, suite.get("/auth/email/confirm", secondToken).Code)
+	assert.Equal(t, http.StatusConflict, suite.get("/auth/email/confirm", firstToken).Code)
+
+	var stored models.User
+	suite.db.First(&stored, first.ID)
+	assert.Equal(t, first.Email, stored.Email)
+}
+
+func TestNewEmailChangeSupersedesPendingOne(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	auth := suite.AuthHeader(user)
+	firstEmail, secondEmail := gofakeit.Email(), gofakeit.Email()
+
+	suite.changeEmail(auth, firstEmail, "password123")
+	firstToken := suite.MailToken(suite.LastMailTo(firstEmail))
+	suite.changeEmail(auth, secondEmail, "password123")
+
+	assert.Equal(t, http.StatusBadRequest, suite.get("/auth/email/confirm", firstToken).Code)
+}
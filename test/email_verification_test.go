@@ -0,0 +1,129 @@
+package test
+
+import (
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/services"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) verifyEmail(token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/auth/verify?token="+url.QueryEscape(token), nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BaseTestSuite) resendVerification(authHeader string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/auth/verify/resend", nil)
+	req.Header.Set("Authorization", authHeader)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSignupSendsVerificationEmail(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	email := gofakeit.Email()
+	w := suite.postJSON("/users", map[string]string{
+		"name":     gofakeit.Name(),
+		"email":    email,
+		"password": "Corr3ct-Horse-Battery",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var user models.User
+	suite.db.Where("email = ?", email).First(&user)
+	assert.False(t, user.IsEmailVerified())
+
+	message := suite.LastMailTo(email)
+	assert.Equal(t, "Verify your email address", message.Subject)
+	token := suite.MailToken(message)
+
+	w = suite.verifyEmail(token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	suite.db.First(&user, user.ID)
+	assert.True(t, user.IsEmailVerified())
+
+	// Links are single use
+	assert.Equal(t, http.StatusBadRequest, suite.verifyEmail(token).Code)
+}
+
+func TestVerifyEmailRejectsExpiredToken(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	verifications := services.NewEmailVerificationService(suite.db, suite.mailer)
+	verifications.SetClock(func() time.Time { return time.Now().Add(-72 * time.Hour) })
+	assert.NoError(t, verifications.Send(t.Context(), user))
+
+	w := suite.verifyEmail(suite.MailToken(suite.LastMailTo(user.Email)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestResendVerificationIsThrottled(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+
+	assert.Equal(t, http.StatusAccepted, suite.resendVerification(auth).Code)
+
+	w := suite.resendVerification(auth)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	suite.db.Model(&models.EmailVerificationToken{}).Where("user_id = ?", user.ID).
+		Update("created_at", time.Now().Add(-2*time.Minute))
+	assert.Equal(t, http.StatusAccepted, suite.resendVerification(auth).Code)
+
+	assert.NoError(t, suite.db.Model(&user).Update("email_verified_at", time.Now()).Error)
+	assert.Equal(t, http.StatusConflict, suite.resendVerification(auth).Code)
+}
+
+func TestRequireVerifiedEmailGuardsConfiguredActions(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	authService := services.NewAuthService(suite.db, services.NewTokenService(), services.LoadLoginPolicy())
+	router := gin.New()
+	router.Use(middleware.Authenticate(middleware.Authenticators{Tokens: authService}), middleware.RequireVerifiedEmail([]string{"POST /posts"}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/posts", ok)
+	router.GET("/posts", ok)
+
+	serve := func(method, authHeader string) int {
+		req, _ := http.NewRequest(method, "/posts", nil)
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	now := time.Now()
+	unverified := suite.UserFactory()
+	verified := suite.UserFactory(func(u *models.User) { u.EmailVerifiedAt = &now })
+
+	assert.Equal(t, http.StatusUnauthorized, serve("POST", ""))
+	assert.Equal(t, http.StatusForbidden, serve("POST", suite.AuthHeader(unverified)))
+	assert.Equal(t, http.StatusOK, serve("POST", suite.AuthHeader(verified)))
+	assert.Equal(t, http.StatusOK, serve("GET", suite.AuthHeader(unverified)))
+}
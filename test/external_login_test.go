@@ -0,0 +1,171 @@
+package test
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"go-crud/models"
+	"go-crud/schemas"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+)
+
+// providerUser adds an account with a verified email to the mock provider
+func providerUser(opts ...func(*MockOIDCUser)) MockOIDCUser {
+	user := MockOIDCUser{
+		Subject:       rand.Text(),
+		Email:         gofakeit.Email(),
+		EmailVerified: true,
+		Name:          gofakeit.Name(),
+	}
+	for _, opt := range opts {
+		opt(&user)
+	}
+	oidcProvider.AddUser(user)
+	return user
+}
+
+// startExternalLogin starts a login and signs in at the provider as subject,
+// returning the callback request the browser would make
+func (suite *BaseTestSuite) startExternalLogin(subject string) *http.Request {
+	w := suite.authedGet("/auth/oidc/login", "")
+	if w.Code != http.StatusFound {
+		suite.t.Fatalf("Failed to start external login: %d %s", w.Code, w.Body.String())
+	}
+	callback, err := oidcProvider.SignIn(w.Header().Get("Location"), subject)
+	if err != nil {
+		suite.t.Fatalf("Failed to sign in at the provider: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", callback.RequestURI(), nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func (suite *BaseTestSuite) externalLogin(subject string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, suite.startExternalLogin(subject))
+	return w
+}
+
+func TestExternalLoginRegistersNewUser(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	account := providerUser()
+	w := suite.externalLogin(account.Subject)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens schemas.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	var user models.User
+	suite.db.Where("email = ?", account.Email).First(&user)
+	assert.Equal(t, account.Name, user.Name)
+	assert.True(t, user.IsEmailVerified())
+
+	var identity models.ExternalIdentity
+	suite.db.Where("subject = ?", account.Subject).First(&identity)
+	assert.Equal(t, user.ID, identity.UserID)
+	assert.Equal(t, oidcProvider.Issuer(), identity.Issuer)
+
+	// The next login finds the same user by subject
+	assert.Equal(t, http.StatusOK, suite.externalLogin(account.Subject).Code)
+	var count int64
+	suite.db.Model(&models.User{}).Where("email = ?", account.Email).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestExternalLoginLinksVerifiedAccount(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	now := time.Now()
+	user := suite.UserFactory(func(u *models.User) { u.EmailVerifiedAt = &now })
+	account := providerUser(func(a *MockOIDCUser) { a.Email = user.Email })
+
+	w := suite.externalLogin(account.Subject)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var identity models.ExternalIdentity
+	suite.db.Where("subject = ?", account.Subject).First(&identity)
+	assert.Equal(t, user.ID, identity.UserID)
+
+	// Once linked, the provider's email no longer matters
+	account.Email = gofakeit.Email()
+	oidcProvider.AddUser(account)
+	assert.Equal(t, http.StatusOK, suite.externalLogin(account.Subject).Code)
+	var count int64
+	suite.db.Model(&models.User{}).Where("email = ?", account.Email).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestExternalLoginRefusesUnverifiedEmails(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	unverified := providerUser(func(a *MockOIDCUser) { a.EmailVerified = false })
+	assert.Equal(t, http.StatusForbidden, suite.externalLogin(unverified.Subject).Code)
+
+	// A local account nobody proved ownership of is never taken over
+	user := suite.UserFactory()
+	account := providerUser(func(a *MockOIDCUser) { a.Email = user.Email })
+	assert.Equal(t, http.StatusConflict, suite.externalLogin(account.Subject).Code)
+
+	var count int64
+	suite.db.Model(&models.ExternalIdentity{}).Where("subject IN ?", []string{unverified.Subject, account.Subject}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestExternalLoginRejectsForgedCallbacks(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	account := providerUser()
+
+	// A callback the browser did not start
+	req := suite.startExternalLogin(account.Subject)
+	forged, _ := http.NewRequest("GET", req.URL.RequestURI(), nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, forged)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Callbacks are single use
+	req = suite.startExternalLogin(account.Subject)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// ID tokens issued to another client
+	other := providerUser(func(a *MockOIDCUser) { a.Audience = "another-app" })
+	assert.Equal(t, http.StatusUnauthorized, suite.externalLogin(other.Subject).Code)
+}
+
+func TestExternalLoginRequiresTwoFactor(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	now := time.Now()
+	user := suite.UserFactory(WithPassword("password123"), func(u *models.User) { u.EmailVerifiedAt = &now })
+	suite.enableTwoFactor(user)
+	account := providerUser(func(a *MockOIDCUser) { a.Email = user.Email })
+
+	w := suite.externalLogin(account.Subject)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	var challenge schemas.TwoFactorChallengeResponse
+	json.Unmarshal(w.Body.Bytes(), &challenge)
+	assert.NotEmpty(t, challenge.ChallengeToken)
+}
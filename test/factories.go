@@ -1,8 +1,8 @@
 package test
 
 import (
-	"go-crud/initializers"
 	"go-crud/models"
+	"go-crud/services"
 
 	"github.com/brianvoe/gofakeit/v6"
 )
@@ -22,7 +22,7 @@ func WithContent(content string) PostOption {
     }
 }
 
-func PostFactory(opts ...PostOption) models.Post {
+func (suite *BaseTestSuite) PostFactory(opts ...PostOption) models.Post {
 	post := &models.Post{
 		Title:  gofakeit.Sentence(6),
 		Content: gofakeit.Paragraph(1, 3, 12, " "),
@@ -32,7 +32,7 @@ func PostFactory(opts ...PostOption) models.Post {
 		opt(post)
 	}
 
-	initializers.DB.Create(post)
+	suite.db.Create(post)
 	return *post
 }
 
@@ -50,7 +50,19 @@ func WithName(name string) UserOption {
 	}
 }
 
-func UserFactory(opts ...UserOption) models.User {
+func WithPassword(password string) UserOption {
+	return func(u *models.User) {
+		u.HashedPassword, _ = services.HashPassword(password)
+	}
+}
+
+func WithRole(role string) UserOption {
+	return func(u *models.User) {
+		u.Role = role
+	}
+}
+
+func (suite *BaseTestSuite) UserFactory(opts ...UserOption) models.User {
 	user := &models.User{
 		Name:  gofakeit.Name(),
 		Email: gofakeit.Email(),
@@ -61,6 +73,6 @@ func UserFactory(opts ...UserOption) models.User {
 		opt(user)
 	}
 
-	initializers.DB.Create(user)
+	suite.db.Create(user)
 	return *user
 }
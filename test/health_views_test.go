@@ -0,0 +1,143 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-crud/health"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLivezSuccess(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	req, _ := http.NewRequest("GET", "/livez", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReadyzSuccess(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response health.Report
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, health.StatusOK, response.Status)
+	assert.Equal(t, health.StatusOK, response.Checks["database"].Status)
+	assert.Equal(t, health.StatusOK, response.Checks["migrations"].Status)
+}
+
+func TestReadyzReportsAccountEraser(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	// The eraser is only reported once the workers are started
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.NotContains(t, w.Body.String(), "account_eraser")
+
+	// Stopped before its first pass, so it never beats
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	suite.workers.Start(ctx)
+	suite.workers.Wait(t.Context())
+
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response health.Report
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, health.StatusDegraded, response.Status)
+	assert.Equal(t, health.StatusUnavailable, response.Checks["account_eraser"].Status)
+	assert.Equal(t, "worker has not started", response.Checks["account_eraser"].Error)
+}
+
+func TestHealthRegistryUnavailableWhenCriticalCheckFails(t *testing.T) {
+	t.Parallel()
+
+	registry := health.NewRegistry("test", 0)
+	registry.Register(health.Check{
+		Name:     "critical",
+		Critical: true,
+		Run:      func(ctx context.Context) error { return errors.New("down") },
+	})
+
+	report := registry.Report(context.Background())
+	assert.False(t, report.Healthy())
+	assert.Equal(t, health.StatusUnavailable, report.Status)
+	assert.Equal(t, "down", report.Checks["critical"].Error)
+}
+
+func TestHealthRegistryDegradedWhenOptionalCheckFails(t *testing.T) {
+	t.Parallel()
+
+	var hb health.Heartbeat
+	registry := health.NewRegistry("test", 0)
+	registry.Register(health.HeartbeatCheck("worker", &hb, time.Minute, false))
+
+	report := registry.Report(context.Background())
+	assert.True(t, report.Healthy())
+	assert.Equal(t, health.StatusDegraded, report.Status)
+
+	hb.Beat()
+	report = registry.Report(context.Background())
+	assert.Equal(t, health.StatusOK, report.Status)
+}
+
+func TestHealthRegistryTimesOutSlowChecks(t *testing.T) {
+	t.Parallel()
+
+	registry := health.NewRegistry("test", 0)
+	registry.Register(health.Check{
+		Name:     "slow",
+		Critical: true,
+		Timeout:  10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	report := registry.Report(context.Background())
+	assert.Equal(t, health.StatusUnavailable, report.Status)
+	assert.Contains(t, report.Checks["slow"].Error, "deadline exceeded")
+}
+
+func TestHealthRegistryCachesReport(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	registry := health.NewRegistry("test", time.Minute)
+	registry.Register(health.Check{
+		Name: "counted",
+		Run: func(ctx context.Context) error {
+			calls++
+			return nil
+		},
+	})
+
+	registry.Report(context.Background())
+	registry.Report(context.Background())
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-crud/models"
+	"go-crud/schemas"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) impersonate(admin models.User, userID uint, reason string) schemas.ImpersonationResponse {
+	w := suite.authedPost(fmt.Sprintf("/admin/users/%d/impersonate", userID), suite.AuthHeader(admin), map[string]string{"reason": reason})
+	if w.Code != http.StatusCreated {
+		suite.t.Fatalf("Failed to impersonate user: %d %s", w.Code, w.Body.String())
+	}
+	var response schemas.ImpersonationResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+func TestImpersonationActsAsUser(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory()
+	response := suite.impersonate(admin, user.ID, "Ticket #42")
+	assert.Equal(t, user.ID, response.User.ID)
+	assert.Equal(t, 900, response.ExpiresIn)
+
+	w := suite.authedGet("/users/me/api-keys", "Bearer "+response.AccessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var start models.AuditLog
+	suite.db.Where("action = ?", models.AuditImpersonationStart).Where("resource_id = ?", strconv.FormatUint(uint64(user.ID), 10)).First(&start)
+	assert.Equal(t, admin.ID, *start.ActorID)
+	assert.Nil(t, start.ImpersonatorID)
+	assert.Equal(t, "Ticket #42", start.Details["reason"])
+
+	var requests []models.AuditLog
+	suite.db.Where("action = ? AND impersonator_id = ?", models.AuditImpersonationRequest, admin.ID).Find(&requests)
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, user.ID, *requests[0].ActorID)
+		assert.Equal(t, "GET", requests[0].Details["method"])
+		assert.Equal(t, "/users/me/api-keys", requests[0].Details["route"])
+		assert.EqualValues(t, http.StatusOK, requests[0].Details["status"])
+		assert.Equal(t, w.Header().Get("X-Request-ID"), requests[0].RequestID)
+	}
+}
+
+func TestImpersonationBlocksSensitiveActions(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory(WithPassword("password123"))
+	auth := "Bearer " + suite.impersonate(admin, user.ID, "Ticket #42").AccessToken
+
+	for _, w := range []interface{ Result() *http.Response }{
+		suite.changePassword(auth, "password123", "Corr3ct-Horse-Battery"),
+		suite.authedPost("/users/me/email", auth, map[string]string{"new_email": "attacker@example.com"}),
+		suite.authedPost("/users/me/api-keys", auth, map[string]interface{}{"name": "backdoor", "scopes": []string{models.ScopePostsRead}}),
+		suite.authedPost("/users/me/2fa/enroll", auth, nil),
+	} {
+		resp := w.Result()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		var body schemas.ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		assert.Equal(t, "impersonation_forbidden", body.Code)
+	}
+
+	// Refused attempts are audited too
+	var count int64
+	suite.db.Model(&models.AuditLog{}).Where("action = ? AND impersonator_id = ?", models.AuditImpersonationRequest, admin.ID).Count(&count)
+	assert.Equal(t, int64(4), count)
+}
+
+func TestImpersonationRules(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	otherAdmin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory()
+	path := fmt.Sprintf("/admin/users/%d/impersonate", user.ID)
+
+	w := suite.authedPost(path, suite.AuthHeader(admin), map[string]string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = suite.authedPost(path, suite.AuthHeader(suite.UserFactory()), map[string]string{"reason": "curious"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = suite.authedPost(fmt.Sprintf("/admin/users/%d/impersonate", admin.ID), suite.AuthHeader(admin), map[string]string{"reason": "test"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = suite.authedPost(fmt.Sprintf("/admin/users/%d/impersonate", otherAdmin.ID), suite.AuthHeader(admin), map[string]string{"reason": "test"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = suite.authedPost("/admin/users/999999/impersonate", suite.AuthHeader(admin), map[string]string{"reason": "test"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Impersonation tokens cannot be refreshed and carry no admin rights
+	w = suite.authedPost(path, suite.AuthHeader(admin), map[string]string{"reason": "Ticket #42"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var raw map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &raw)
+	assert.NotContains(t, raw, "refresh_token")
+	w = suite.authedPost(path, "Bearer "+raw["access_token"].(string), map[string]string{"reason": "nested"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestImpersonationEndsWithAdminAccess(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory()
+	auth := "Bearer " + suite.impersonate(admin, user.ID, "Ticket #42").AccessToken
+	assert.Equal(t, http.StatusOK, suite.authedGet("/users/me/api-keys", auth).Code)
+
+	// Demoting the admin ends the impersonation
+	suite.db.Model(&admin).Update("role", models.RoleUser)
+	assert.Equal(t, http.StatusUnauthorized, suite.authedGet("/users/me/api-keys", auth).Code)
+
+	// So does revoking the admin's tokens
+	suite.db.Model(&admin).Update("role", models.RoleAdmin)
+	auth = "Bearer " + suite.impersonate(admin, user.ID, "Ticket #42").AccessToken
+	suite.db.Model(&admin).Update("token_version", admin.TokenVersion+1)
+	assert.Equal(t, http.StatusUnauthorized, suite.authedGet("/users/me/api-keys", auth).Code)
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-crud/logging"
+	"go-crud/middleware"
+	"go-crud/schemas"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDIsPropagated(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	req, _ := http.NewRequest("GET", "/livez", nil)
+	req.Header.Set(middleware.RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, "abc-123", w.Header().Get(middleware.RequestIDHeader))
+}
+
+func TestRequestIDIsGeneratedWhenMissingOrInvalid(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	req, _ := http.NewRequest("GET", "/livez", nil)
+	req.Header.Set(middleware.RequestIDHeader, "bad id\nwith newline")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	requestID := w.Header().Get(middleware.RequestIDHeader)
+	assert.Len(t, requestID, 32)
+	assert.NotContains(t, requestID, " ")
+}
+
+func TestLoggerRedactsPasswords(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := logging.New(&buf, "debug", "json")
+	logger.Info("user input",
+		"input", schemas.CreateUserInput{Name: "Connor", Email: "connor@example.com", Password: "hunter2"},
+		"password", "hunter2",
+	)
+
+	assert.NotContains(t, buf.String(), "hunter2")
+
+	var entry map[string]any
+	err := json.Unmarshal(buf.Bytes(), &entry)
+	assert.NoError(t, err)
+	assert.Equal(t, logging.Redacted, entry["password"])
+	assert.Equal(t, "connor@example.com", entry["input"].(map[string]any)["email"])
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"fmt"
+	"go-crud/initializers"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanRecorder collects every span ended during the test run
+var spanRecorder = tracetest.NewSpanRecorder()
+
+// oidcProvider is the external login provider every test router is set up
+// with
+var oidcProvider *MockOIDCProvider
+
+// TestMain points the suite at an ephemeral SQLite file unless TEST_DB_DSN
+// names a real database, so the tests run without a local Postgres.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "go-crud-test-")
+	if err != nil {
+		fmt.Println("Failed to create test directory: ", err)
+		os.Exit(1)
+	}
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		// Parallel tests each hold a transaction; taking the write lock at
+		// BEGIN makes them queue on busy_timeout instead of deadlocking.
+		dsn = "sqlite://" + filepath.Join(dir, "test.db") + "?_txlock=immediate"
+	}
+	os.Setenv("DB_DSN", dsn)
+	os.Setenv("JWT_SECRET", "test-secret")
+	// Keep argon2id cheap so parallel tests don't exhaust memory
+	os.Setenv("ARGON2_MEMORY_KIB", "8192")
+	os.Setenv("ARGON2_ITERATIONS", "1")
+	os.Setenv("MAIL_DRIVER", "file")
+	os.Setenv("MAIL_FILE", filepath.Join(dir, "mail.jsonl"))
+
+	oidcProvider = NewMockOIDCProvider("go-crud", "oidc-secret", "http://localhost:8080/auth/oidc/callback")
+	os.Setenv("OIDC_ISSUER", oidcProvider.Issuer())
+	os.Setenv("OIDC_CLIENT_ID", "go-crud")
+	os.Setenv("OIDC_CLIENT_SECRET", "oidc-secret")
+	os.Setenv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback")
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	initializers.ConnectToDB()
+	if initializers.DB == nil {
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	if err := initializers.MigrateDB(); err != nil {
+		fmt.Println("Failed to migrate test database: ", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	oidcProvider.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
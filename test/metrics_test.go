@@ -0,0 +1,48 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsExposeRouteTemplatesAndDatabaseTimings(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	jsonData, _ := json.Marshal(map[string]string{
+		"title":   "Metrics Post",
+		"content": "Counted by the metrics middleware",
+	})
+	req, _ := http.NewRequest("POST", "/posts", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	post := suite.PostFactory()
+	req, _ = http.NewRequest("GET", "/posts/"+strconv.FormatUint(uint64(post.ID), 10), nil)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, body, `http_requests_total{method="POST",route="/posts",status="201"}`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/posts/:id",status="200"}`)
+	assert.NotContains(t, body, `route="/posts/`+strconv.FormatUint(uint64(post.ID), 10)+`"`)
+	assert.Contains(t, body, "http_request_duration_seconds_bucket")
+	assert.Contains(t, body, "http_requests_in_flight")
+	assert.Contains(t, body, `db_query_duration_seconds_count{operation="create",table="posts"}`)
+	assert.Contains(t, body, "posts_created_total")
+}
@@ -0,0 +1,370 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	oauthRedirectURI  = "https://partner.example.com/callback"
+	oauthCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// registerOAuthClient registers a confidential client owned by user
+func (suite *BaseTestSuite) registerOAuthClient(user models.User, scopes ...string) schemas.OAuthClientResponse {
+	w := suite.authedPost("/oauth/clients", suite.AuthHeader(user), map[string]interface{}{
+		"name":          "Partner Dashboard",
+		"redirect_uris": []string{oauthRedirectURI},
+		"scopes":        scopes,
+	})
+	if w.Code != http.StatusCreated {
+		suite.t.Fatalf("Failed to register OAuth client: %s", w.Body.String())
+	}
+	var response schemas.OAuthClientResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+// postForm sends a form, with HTTP Basic client credentials when clientID is
+// not empty and a bearer token when auth is not empty
+func (suite *BaseTestSuite) postForm(path, auth, clientID, clientSecret string, form url.Values) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+// authedGet sends a GET with authHeader, if not empty
+func (suite *BaseTestSuite) authedGet(path, authHeader string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func authorizeParams(clientID, scope string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {oauthRedirectURI},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"code_challenge":        {pkceChallenge(oauthCodeVerifier)},
+		"code_challenge_method": {"S256"},
+		"nonce":                 {"n-0S6"},
+	}
+}
+
+// authorizeCode approves an authorization request as user and returns the
+// code from the redirect
+func (suite *BaseTestSuite) authorizeCode(user models.User, clientID, scope string) string {
+	form := authorizeParams(clientID, scope)
+	form.Set("decision", "allow")
+	w := suite.postForm("/oauth/authorize", suite.AuthHeader(user), "", "", form)
+	if w.Code != http.StatusFound {
+		suite.t.Fatalf("Failed to authorize: %d %s", w.Code, w.Body.String())
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	return location.Query().Get("code")
+}
+
+func (suite *BaseTestSuite) exchangeCode(client schemas.OAuthClientResponse, code, verifier string) *httptest.ResponseRecorder {
+	return suite.postForm("/oauth/token", "", client.Data.ClientID, client.ClientSecret, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oauthRedirectURI},
+		"code_verifier": {verifier},
+	})
+}
+
+func tokenResponse(w *httptest.ResponseRecorder) schemas.OAuthTokenResponse {
+	var response schemas.OAuthTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+func TestOAuthConsentScreen(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	owner := suite.UserFactory()
+	user := suite.UserFactory()
+	client := suite.registerOAuthClient(owner, models.ScopeOpenID, models.ScopePostsRead)
+	assert.True(t, strings.HasPrefix(client.Data.ClientID, "gcc_"))
+	assert.NotEmpty(t, client.ClientSecret)
+
+	path := "/oauth/authorize?" + authorizeParams(client.Data.ClientID, "openid posts:read").Encode()
+	assert.Equal(t, http.StatusUnauthorized, suite.authedGet(path, "").Code)
+
+	w := suite.authedGet(path, suite.AuthHeader(user))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Contains(t, w.Body.String(), "Partner Dashboard wants to access your account")
+	assert.Contains(t, w.Body.String(), "Read posts")
+
+	// Once consented, the user goes straight back to the client
+	suite.authorizeCode(user, client.Data.ClientID, "openid posts:read")
+	w = suite.authedGet(path, suite.AuthHeader(user))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "code=")
+
+	// ...unless it asks for more than was granted
+	path = "/oauth/authorize?" + authorizeParams(client.Data.ClientID, "openid posts:read posts:write").Encode()
+	w = suite.authedGet(path, suite.AuthHeader(user))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "error=invalid_scope")
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	client := suite.registerOAuthClient(user, models.ScopeOpenID, models.ScopeEmail, models.ScopePostsWrite)
+	code := suite.authorizeCode(user, client.Data.ClientID, "openid email posts:write")
+	assert.NotEmpty(t, code)
+
+	w := suite.exchangeCode(client, code, oauthCodeVerifier)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	tokens := tokenResponse(w)
+	assert.True(t, strings.HasPrefix(tokens.AccessToken, "gcoa_"))
+	assert.True(t, strings.HasPrefix(tokens.RefreshToken, "gcor_"))
+	assert.Equal(t, "email openid posts:write", tokens.Scope)
+
+	// The ID token verifies against the published key set
+	var discovery schemas.OpenIDConfiguration
+	json.Unmarshal(suite.authedGet("/.well-known/openid-configuration", "").Body.Bytes(), &discovery)
+	assert.Contains(t, discovery.CodeChallengeMethodsSupported, "S256")
+
+	var jwks services.JSONWebKeySet
+	json.Unmarshal(suite.authedGet("/oauth/jwks", "").Body.Bytes(), &jwks)
+	assert.Len(t, jwks.Keys, 1)
+	claims := &services.IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokens.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, jwks.Keys[0].KeyID, token.Header["kid"])
+		x, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+		y, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].Y)
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer(discovery.Issuer), jwt.WithAudience(client.Data.ClientID))
+	assert.NoError(t, err)
+	assert.Equal(t, "n-0S6", claims.Nonce)
+	assert.Equal(t, user.Email, claims.Email)
+	assert.Empty(t, claims.Name)
+
+	// The access token can do what its scopes allow, and nothing else
+	bearer := "Bearer " + tokens.AccessToken
+	assert.Equal(t, http.StatusCreated, suite.authedPost("/posts", bearer, testPost).Code)
+	w = suite.authedGet("/posts", bearer)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "insufficient_scope")
+	w = suite.authedPost("/users/me/api-keys", bearer, map[string]interface{}{"name": "escalated", "scopes": models.APIKeyScopes})
+	assert.Contains(t, w.Body.String(), "scope_not_allowed")
+
+	var info schemas.UserInfoResponse
+	w = suite.authedGet("/oauth/userinfo", bearer)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &info)
+	assert.Equal(t, user.Email, info.Email)
+	assert.Empty(t, info.Name)
+}
+
+func TestOAuthCodeReplayRevokesGrant(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	client := suite.registerOAuthClient(user, models.ScopePostsRead)
+	code := suite.authorizeCode(user, client.Data.ClientID, "posts:read")
+
+	// The code is bound to the PKCE challenge
+	w := suite.exchangeCode(client, code, strings.Repeat("a", 43))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_grant")
+
+	code = suite.authorizeCode(user, client.Data.ClientID, "posts:read")
+	tokens := tokenResponse(suite.exchangeCode(client, code, oauthCodeVerifier))
+	assert.Equal(t, http.StatusOK, suite.authedGet("/posts", "Bearer "+tokens.AccessToken).Code)
+
+	w = suite.exchangeCode(client, code, oauthCodeVerifier)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_grant")
+	assert.Equal(t, http.StatusUnauthorized, suite.authedGet("/posts", "Bearer "+tokens.AccessToken).Code)
+
+	// Wrong client secret
+	client.ClientSecret = "wrong"
+	w = suite.exchangeCode(client, suite.authorizeCode(user, client.Data.ClientID, "posts:read"), oauthCodeVerifier)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_client")
+}
+
+func TestOAuthRefreshRotation(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	client := suite.registerOAuthClient(user, models.ScopePostsRead, models.ScopePostsWrite)
+	first := tokenResponse(suite.exchangeCode(client, suite.authorizeCode(user, client.Data.ClientID, "posts:read posts:write"), oauthCodeVerifier))
+
+	refresh := func(token, scope string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token}}
+		if scope != "" {
+			form.Set("scope", scope)
+		}
+		return suite.postForm("/oauth/token", "", client.Data.ClientID, client.ClientSecret, form)
+	}
+
+	w := refresh(first.RefreshToken, "posts:read")
+	assert.Equal(t, http.StatusOK, w.Code)
+	second := tokenResponse(w)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.Equal(t, "posts:read", second.Scope)
+	assert.Equal(t, http.StatusOK, suite.authedGet("/posts", "Bearer "+second.AccessToken).Code)
+
+	// Presenting the rotated token again is treated as theft
+	assert.Equal(t, http.StatusBadRequest, refresh(first.RefreshToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, suite.authedGet("/posts", "Bearer "+second.AccessToken).Code)
+	assert.Equal(t, http.StatusBadRequest, refresh(second.RefreshToken, "").Code)
+}
+
+func TestOAuthIntrospectAndRevoke(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	client := suite.registerOAuthClient(user, models.ScopePostsRead)
+	other := suite.registerOAuthClient(user, models.ScopePostsRead)
+	tokens := tokenResponse(suite.exchangeCode(client, suite.authorizeCode(user, client.Data.ClientID, "posts:read"), oauthCodeVerifier))
+
+	introspect := func(c schemas.OAuthClientResponse) schemas.IntrospectionResponse {
+		var response schemas.IntrospectionResponse
+		w := suite.postForm("/oauth/introspect", "", c.Data.ClientID, c.ClientSecret, url.Values{"token": {tokens.AccessToken}})
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	active := introspect(client)
+	assert.True(t, active.Active)
+	assert.Equal(t, "posts:read", active.Scope)
+	assert.Equal(t, client.Data.ClientID, active.ClientID)
+	assert.False(t, introspect(other).Active)
+
+	w := suite.postForm("/oauth/revoke", "", client.Data.ClientID, client.ClientSecret, url.Values{"token": {tokens.RefreshToken}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, introspect(client).Active)
+	assert.Equal(t, http.StatusUnauthorized, suite.authedGet("/posts", "Bearer "+tokens.AccessToken).Code)
+
+	// Password changes end delegated access too
+	tokens = tokenResponse(suite.exchangeCode(client, suite.authorizeCode(user, client.Data.ClientID, "posts:read"), oauthCodeVerifier))
+	suite.db.Model(&models.User{}).Where("id = ?", user.ID).Update("token_version", user.TokenVersion+1)
+	assert.Equal(t, http.StatusUnauthorized, suite.authedGet("/posts", "Bearer "+tokens.AccessToken).Code)
+}
+
+func TestOAuthAuthorizationErrors(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+	client := suite.registerOAuthClient(user, models.ScopePostsRead)
+
+	form := authorizeParams(client.Data.ClientID, "posts:read")
+	form.Set("decision", "deny")
+	w := suite.postForm("/oauth/authorize", auth, "", "", form)
+	assert.Equal(t, http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, "access_denied", location.Query().Get("error"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+
+	// Errors are never sent to a redirect URI the client did not register
+	form = authorizeParams(client.Data.ClientID, "posts:read")
+	form.Set("redirect_uri", "https://attacker.example.com/callback")
+	w = suite.authedGet("/oauth/authorize?"+form.Encode(), auth)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+
+	form = authorizeParams(client.Data.ClientID, "posts:read")
+	form.Del("code_challenge")
+	w = suite.authedGet("/oauth/authorize?"+form.Encode(), auth)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "error=invalid_request")
+
+	w = suite.authedPost("/oauth/clients", auth, map[string]interface{}{
+		"name":          "Phishing",
+		"redirect_uris": []string{"javascript:alert(1)"},
+		"scopes":        []string{models.ScopePostsRead},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOAuthConsentFormWithSession(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	client := suite.registerOAuthClient(user, models.ScopePostsRead)
+	cookie, started := suite.sessionLogin(user.Email, "password123")
+
+	form := authorizeParams(client.Data.ClientID, "posts:read")
+	form.Set("decision", "allow")
+	send := func(form url.Values) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/oauth/authorize", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(form)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "csrf_token_invalid")
+
+	form.Set("csrf_token", started.CSRFToken)
+	w = send(form)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "code=")
+
+	// The consent screen carries the token for the form
+	w = suite.withSession("GET", "/oauth/authorize?"+authorizeParams(client.Data.ClientID, "posts:read").Encode()+"&prompt=consent", cookie, "", nil)
+	assert.Contains(t, w.Body.String(), `name="csrf_token" value="`+started.CSRFToken+`"`)
+}
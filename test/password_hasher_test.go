@@ -0,0 +1,86 @@
+package test
+
+import (
+	"go-crud/models"
+	"go-crud/services"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2idHashIsPHCString(t *testing.T) {
+	t.Parallel()
+
+	algorithm := &services.Argon2idAlgorithm{Memory: 8192, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hash, err := algorithm.Hash("Corr3ct-Horse-Battery")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$"))
+
+	ok, err := algorithm.Verify("Corr3ct-Horse-Battery", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = algorithm.Verify("wrong-password", hash)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	stronger := &services.Argon2idAlgorithm{Memory: 16384, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	assert.False(t, algorithm.NeedsRehash(hash))
+	assert.True(t, stronger.NeedsRehash(hash))
+}
+
+func TestPasswordHasherVerifiesLegacyBcrypt(t *testing.T) {
+	t.Parallel()
+
+	argon := &services.Argon2idAlgorithm{Memory: 8192, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hasher := services.NewPasswordHasher(argon, &services.BcryptAlgorithm{Cost: bcrypt.MinCost})
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("Corr3ct-Horse-Battery"), bcrypt.MinCost)
+	ok, err := hasher.Verify("Corr3ct-Horse-Battery", string(legacy))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, hasher.NeedsRehash(string(legacy)))
+
+	_, err = hasher.Verify("Corr3ct-Horse-Battery", "not-a-hash")
+	assert.ErrorIs(t, err, services.ErrUnknownHashFormat)
+}
+
+func TestLoginUpgradesLegacyBcryptHash(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	user := suite.UserFactory(func(u *models.User) {
+		u.HashedPassword = string(legacy)
+	})
+
+	w := suite.login(user.Email, "password123")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.True(t, strings.HasPrefix(stored.HashedPassword, "$argon2id$"))
+	assert.True(t, services.CheckHashedPassword("password123", stored.HashedPassword))
+
+	w = suite.login(user.Email, "password123")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLoginKeepsCurrentHash(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+
+	w := suite.login(user.Email, "password123")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.Equal(t, user.HashedPassword, stored.HashedPassword)
+}
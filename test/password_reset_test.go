@@ -0,0 +1,141 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-crud/mail"
+	"go-crud/models"
+	"go-crud/schemas"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) postJSON(path string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BaseTestSuite) forgotPassword(email string) *httptest.ResponseRecorder {
+	return suite.postJSON("/auth/password/forgot", map[string]string{"email": email})
+}
+
+func (suite *BaseTestSuite) resetPassword(token, newPassword string) *httptest.ResponseRecorder {
+	return suite.postJSON("/auth/password/reset", map[string]string{
+		"token":        token,
+		"new_password": newPassword,
+	})
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	oldAuth := suite.AuthHeader(user)
+
+	w := suite.forgotPassword(user.Email)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	message := suite.LastMailTo(user.Email)
+	assert.Equal(t, "Reset your password", message.Subject)
+	token := suite.MailToken(message)
+
+	var stored models.PasswordResetToken
+	suite.db.Where("user_id = ?", user.ID).First(&stored)
+	assert.NotEqual(t, token, stored.TokenHash)
+
+	w = suite.resetPassword(token, "Corr3ct-Horse-Battery")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, suite.login(user.Email, "password123").Code)
+	assert.Equal(t, http.StatusOK, suite.login(user.Email, "Corr3ct-Horse-Battery").Code)
+	assert.Equal(t, http.StatusUnauthorized, suite.getUser(oldAuth, user.ID).Code)
+}
+
+func TestPasswordResetTokenIsSingleUse(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	suite.forgotPassword(user.Email)
+	first := suite.MailToken(suite.LastMailTo(user.Email))
+	suite.forgotPassword(user.Email)
+	second := suite.MailToken(suite.LastMailTo(user.Email))
+
+	assert.Equal(t, http.StatusOK, suite.resetPassword(second, "Corr3ct-Horse-Battery").Code)
+	assert.Equal(t, http.StatusBadRequest, suite.resetPassword(second, "An0ther-Horse-Battery").Code)
+	// Redeeming one link revokes every other outstanding link
+	assert.Equal(t, http.StatusBadRequest, suite.resetPassword(first, "An0ther-Horse-Battery").Code)
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	suite.forgotPassword(user.Email)
+	token := suite.MailToken(suite.LastMailTo(user.Email))
+
+	suite.db.Model(&models.PasswordResetToken{}).Where("user_id = ?", user.ID).
+		Update("expires_at", time.Now().Add(-time.Minute))
+
+	w := suite.resetPassword(token, "Corr3ct-Horse-Battery")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPasswordResetEnforcesPolicy(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	suite.forgotPassword(user.Email)
+	token := suite.MailToken(suite.LastMailTo(user.Email))
+
+	w := suite.resetPassword(token, "password123")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response schemas.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "password_policy", response.Code)
+
+	// A rejected password leaves the token usable
+	assert.Equal(t, http.StatusOK, suite.resetPassword(token, "Corr3ct-Horse-Battery").Code)
+}
+
+func TestForgotPasswordDoesNotRevealUnknownEmail(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	known := suite.forgotPassword(user.Email)
+	unknown := suite.forgotPassword(gofakeit.Email())
+
+	assert.Equal(t, known.Code, unknown.Code)
+	assert.Equal(t, known.Body.String(), unknown.Body.String())
+}
+
+func TestMailerRejectsHeaderInjection(t *testing.T) {
+	t.Parallel()
+
+	mailer := mail.NewFileMailer(t.TempDir() + "/mail.jsonl")
+	err := mailer.Send(t.Context(), mail.Message{
+		To:      "victim@example.com\r\nBcc: attacker@example.com",
+		Subject: "Hello",
+	})
+	assert.ErrorIs(t, err, mail.ErrInvalidHeader)
+}
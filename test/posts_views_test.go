@@ -14,6 +14,7 @@ import (
 
 
 func TestCreatePostSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 	
@@ -40,6 +41,7 @@ func TestCreatePostSuccess(t *testing.T) {
 }
 
 func TestCreatePostValidationError(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 	
@@ -64,11 +66,12 @@ func TestCreatePostValidationError(t *testing.T) {
 
 
 func TestGetPostByIDSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
 	// Create mock data Post
-	post := PostFactory()
+	post := suite.PostFactory()
 	req, _ := http.NewRequest("GET", "/posts/"+strconv.FormatUint(uint64(post.ID), 10), nil)
 	req.Header.Set("Content-Type", "application/json")
 
@@ -84,6 +87,7 @@ func TestGetPostByIDSuccess(t *testing.T) {
 }
 
 func TestGetPostByIDDataDoesNotExist(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
@@ -101,12 +105,13 @@ func TestGetPostByIDDataDoesNotExist(t *testing.T) {
 }
 
 func TestListPostsSuccessWithDefaultPagination(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
 	// Create mock data Posts
 	for i := 0; i < 10; i++ {
-		PostFactory()
+		suite.PostFactory()
 	}
 
 	req, _ := http.NewRequest("GET", "/posts", nil)
@@ -126,12 +131,13 @@ func TestListPostsSuccessWithDefaultPagination(t *testing.T) {
 }
 
 func TestListPostsSuccessWithCustomPagination(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
 	// Create mock data Posts
 	for i := 0; i < 10; i++ {
-		PostFactory()
+		suite.PostFactory()
 	}
 
 	req, _ := http.NewRequest("GET", "/posts?page=2&limit=5", nil)
@@ -151,6 +157,7 @@ func TestListPostsSuccessWithCustomPagination(t *testing.T) {
 }
 
 func TestListPostsShouldReturnDefaultPaginationWhenInvalidQueryParams(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
@@ -171,11 +178,12 @@ func TestListPostsShouldReturnDefaultPaginationWhenInvalidQueryParams(t *testing
 }
 
 func TestUpdatePostSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
 	// Create mock data Post
-	post := PostFactory()
+	post := suite.PostFactory()
 	
 	requestBody := map[string]string{
 		"title":   "Updated Title",
@@ -199,6 +207,7 @@ func TestUpdatePostSuccess(t *testing.T) {
 }
 
 func TestUpdatePostFailWhenDataDoesNotExist(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 	
@@ -222,11 +231,12 @@ func TestUpdatePostFailWhenDataDoesNotExist(t *testing.T) {
 }
 
 func TestUpdatePostFailWhenDataIsInvalid(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
 	// Create mock data Post
-	post := PostFactory()
+	post := suite.PostFactory()
 	
 	requestBody := map[string]string{
 		"author":   "", // Invalid un-exist field
@@ -248,11 +258,12 @@ func TestUpdatePostFailWhenDataIsInvalid(t *testing.T) {
 }
 
 func TestPartiallyUpdatePostSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
 	// Create mock data Post
-	post := PostFactory()
+	post := suite.PostFactory()
 	
 	requestBody := map[string]string{
 		"content": "Partially Updated Content",
@@ -275,6 +286,7 @@ func TestPartiallyUpdatePostSuccess(t *testing.T) {
 }
 
 func TestPartiallyUpdatePostFailWhenDataDoesNotExist(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 	
@@ -297,10 +309,11 @@ func TestPartiallyUpdatePostFailWhenDataDoesNotExist(t *testing.T) {
 }
 
 func TestPartiallyUpdatePostFailInvalidData(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 	// Create mock data Post
-	post := PostFactory()
+	post := suite.PostFactory()
 	
 	requestBody := map[string]string{
 		"title": "", // Invalid empty title
@@ -321,11 +334,12 @@ func TestPartiallyUpdatePostFailInvalidData(t *testing.T) {
 }
 
 func TestDeletePostSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
 	// Create mock data Post
-	post := PostFactory()
+	post := suite.PostFactory()
 	req, _ := http.NewRequest("DELETE", "/posts/"+strconv.FormatUint(uint64(post.ID), 10), nil)
 	req.Header.Set("Content-Type", "application/json")
 
@@ -340,6 +354,7 @@ func TestDeletePostSuccess(t *testing.T) {
 }
 
 func TestDeletePostFailWhenDataDoesNotExist(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-crud/models"
+	"go-crud/schemas"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// uploadAvatar sends data as the avatar form field of a multipart upload
+func (suite *BaseTestSuite) uploadAvatar(authHeader string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("avatar", "avatar.jpg")
+	part.Write(data)
+	writer.Close()
+
+	req, _ := http.NewRequest("PUT", "/users/me/avatar", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", authHeader)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func (suite *BaseTestSuite) getProfile(authHeader string, id uint) schemas.Profile {
+	w := suite.authedGet(fmt.Sprintf("/users/%d/profile", id), authHeader)
+	if w.Code != http.StatusOK {
+		suite.t.Fatalf("Failed to get profile: %d %s", w.Code, w.Body.String())
+	}
+	var response schemas.ProfileResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.Data
+}
+
+// sidewaysPhoto returns a JPEG, red on the left and blue on the right, whose
+// EXIF says to turn it clockwise to display it and records where it was
+// taken
+func sidewaysPhoto() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	var encoded bytes.Buffer
+	jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 95})
+
+	// Big-endian TIFF with one IFD entry: orientation 6, then a fake GPS note
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	tiff = append(tiff, []byte("GPS 10.7769N 106.7009E")...)
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}
+	segment = append(segment, exif...)
+
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+func TestProfileShowsEmailToOwnerAndAdmins(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	auth := suite.AuthHeader(user)
+
+	update := fmt.Sprintf("/users/%d", user.ID)
+	assert.Equal(t, http.StatusBadRequest, suite.authedRequest("PATCH", update, auth, map[string]string{"website": "javascript:alert(1)"}).Code)
+	assert.Equal(t, http.StatusBadRequest, suite.authedRequest("PATCH", update, auth, map[string]string{"bio": string(bytes.Repeat([]byte("a"), 501))}).Code)
+	w := suite.authedRequest("PATCH", update, auth, map[string]string{
+		"display_name": "Connor",
+		"bio":          "Backend developer",
+		"website":      "https://connortran.dev",
+		"location":     "Ho Chi Minh City",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	profile := suite.getProfile("", user.ID)
+	assert.Equal(t, "Connor", profile.DisplayName)
+	assert.Equal(t, "Backend developer", profile.Bio)
+	assert.Equal(t, "https://connortran.dev", profile.Website)
+	assert.Equal(t, "Ho Chi Minh City", profile.Location)
+	assert.Empty(t, profile.Email)
+	assert.Empty(t, suite.getProfile(suite.AuthHeader(suite.UserFactory()), user.ID).Email)
+	assert.Equal(t, user.Email, suite.getProfile(auth, user.ID).Email)
+	assert.Equal(t, user.Email, suite.getProfile(suite.AuthHeader(admin), user.ID).Email)
+
+	// Suspended users drop out of sight, except for themselves and admins
+	suite.db.Model(&user).Update("status", models.UserStatusSuspended)
+	assert.Equal(t, http.StatusNotFound, suite.authedGet(fmt.Sprintf("/users/%d/profile", user.ID), "").Code)
+	assert.Equal(t, user.Email, suite.getProfile(suite.AuthHeader(admin), user.ID).Email)
+}
+
+func TestProfileEditsRequireOwnerOrAdmin(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	update := fmt.Sprintf("/users/%d", user.ID)
+	body := map[string]string{"bio": "Defaced"}
+
+	assert.Equal(t, http.StatusUnauthorized, suite.authedRequest("PATCH", update, "", body).Code)
+	assert.Equal(t, http.StatusForbidden, suite.authedRequest("PATCH", update, suite.AuthHeader(suite.UserFactory()), body).Code)
+	assert.Empty(t, suite.getProfile("", user.ID).Bio)
+
+	admin := suite.AuthHeader(suite.UserFactory(WithRole(models.RoleAdmin)))
+	assert.Equal(t, http.StatusOK, suite.authedRequest("PATCH", update, admin, map[string]string{"bio": "Moderated"}).Code)
+	assert.Equal(t, "Moderated", suite.getProfile("", user.ID).Bio)
+}
+
+func TestAvatarUpload(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+
+	w := suite.uploadAvatar(auth, []byte("#!/bin/sh\necho not an image\n"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = suite.uploadAvatar(auth, sidewaysPhoto())
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response schemas.ProfileResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response.Data.Avatars, 3)
+
+	w = suite.authedGet(response.Data.Avatars["64"], "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "GPS")
+	thumbnail, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, image.Rect(0, 0, 64, 64), thumbnail.Bounds())
+		// Turned upright, so the left half is now on top
+		r, _, b, _ := thumbnail.At(32, 8).RGBA()
+		assert.Greater(t, r>>8, uint32(200))
+		assert.Less(t, b>>8, uint32(60))
+		r, _, b, _ = thumbnail.At(32, 56).RGBA()
+		assert.Less(t, r>>8, uint32(60))
+		assert.Greater(t, b>>8, uint32(200))
+	}
+
+	// Sizes in between get the next size up
+	w = suite.authedGet(fmt.Sprintf("/users/%d/avatar?size=100", user.ID), "")
+	if config, err := png.DecodeConfig(bytes.NewReader(w.Body.Bytes())); assert.NoError(t, err) {
+		assert.Equal(t, 128, config.Width)
+	}
+
+	assert.Equal(t, http.StatusOK, suite.authedRequest("DELETE", "/users/me/avatar", auth, nil).Code)
+	assert.Equal(t, http.StatusNotFound, suite.authedGet(fmt.Sprintf("/users/%d/avatar", user.ID), "").Code)
+	assert.Empty(t, suite.getProfile("", user.ID).Avatars)
+}
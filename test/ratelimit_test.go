@@ -0,0 +1,102 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-crud/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateUserIsRateLimited(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 6; i++ {
+		jsonData, _ := json.Marshal(map[string]string{
+			"name":     gofakeit.Name(),
+			"email":    gofakeit.Email(),
+			"password": "Corr3ct-Horse-Battery",
+		})
+		req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		suite.router.ServeHTTP(w, req)
+
+		if i < 5 {
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "720", w.Header().Get("Retry-After"))
+}
+
+func TestProbesAreNotRateLimited(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	req, _ := http.NewRequest("GET", "/livez", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestMemoryStoreRefillsTokens(t *testing.T) {
+	t.Parallel()
+
+	store := ratelimit.NewMemoryStore()
+	policy := ratelimit.Policy{Name: "test", Limit: 2, Period: time.Minute}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	first, _ := store.Take(ctx, "client", policy, now)
+	second, _ := store.Take(ctx, "client", policy, now)
+	third, _ := store.Take(ctx, "client", policy, now)
+	assert.True(t, first.Allowed)
+	assert.True(t, second.Allowed)
+	assert.False(t, third.Allowed)
+	assert.Equal(t, 30*time.Second, third.RetryAfter)
+
+	other, _ := store.Take(ctx, "other-client", policy, now)
+	assert.True(t, other.Allowed)
+
+	refilled, _ := store.Take(ctx, "client", policy, now.Add(30*time.Second))
+	assert.True(t, refilled.Allowed)
+	assert.Equal(t, 0, refilled.Remaining)
+}
+
+func TestLoginIsRateLimitedBeforeAuthentication(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	// Requests with a bad token are turned away by authentication, but must
+	// still count against the IP
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 21; i++ {
+		w = suite.authedPost("/auth/login", "Bearer not-a-token", map[string]string{
+			"email":    "nobody@example.com",
+			"password": "guess",
+		})
+		if i < 20 {
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "20", w.Header().Get("RateLimit-Limit"))
+}
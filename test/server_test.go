@@ -0,0 +1,68 @@
+package test
+
+import (
+	"context"
+	"go-crud/server"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerDrainsInFlightRequestsOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	config := server.LoadConfig()
+	config.ShutdownTimeout = 5 * time.Second
+	srv := server.New(handler, config)
+
+	hookCalled := false
+	srv.OnShutdown(func(context.Context) error {
+		hookCalled = true
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ctx, listener)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	response := <-responses
+	assert.NoError(t, response.err)
+	assert.Equal(t, "done", response.body)
+	assert.NoError(t, <-serveErr)
+	assert.True(t, hookCalled)
+}
@@ -0,0 +1,250 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/session"
+	"go-crud/totp"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sessionLogin logs in through /auth/session and returns the session cookie
+// and the response body
+func (suite *BaseTestSuite) sessionLogin(email, password string) (*http.Cookie, schemas.SessionResponse) {
+	w := suite.postJSON("/auth/session", map[string]string{
+		"email":    email,
+		"password": password,
+	})
+	if w.Code != http.StatusOK {
+		suite.t.Fatalf("Failed to start session: %d %s", w.Code, w.Body.String())
+	}
+	var response schemas.SessionResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return sessionCookie(w), response
+}
+
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == middleware.SessionCookie {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// withSession sends a request with the session cookie and, when csrf is not
+// empty, the CSRF header
+func (suite *BaseTestSuite) withSession(method, path string, cookie *http.Cookie, csrf string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(cookie)
+	if csrf != "" {
+		req.Header.Set(middleware.CSRFHeader, csrf)
+	}
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSessionLoginSetsSecureCookie(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	cookie, started := suite.sessionLogin(user.Email, "password123")
+
+	assert.NotNil(t, cookie)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.NotEmpty(t, started.CSRFToken)
+
+	var stored models.Session
+	suite.db.First(&stored, "id = ?", started.Data.ID)
+	assert.NotEqual(t, cookie.Value, stored.TokenHash)
+
+	w := suite.withSession("GET", "/users/me/sessions", cookie, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list schemas.ListSessionsResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	assert.Len(t, list.Data, 1)
+	assert.True(t, list.Data[0].Current)
+
+	w = suite.withSession("GET", "/auth/session", cookie, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var current schemas.SessionResponse
+	json.Unmarshal(w.Body.Bytes(), &current)
+	assert.Equal(t, started.CSRFToken, current.CSRFToken)
+}
+
+func TestSessionRequiresCSRFTokenForUnsafeMethods(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	cookie, started := suite.sessionLogin(user.Email, "password123")
+	post := map[string]string{"title": "From the admin UI", "content": "Posted with a cookie"}
+
+	w := suite.withSession("POST", "/posts", cookie, "", post)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "csrf_token_invalid")
+
+	assert.Equal(t, http.StatusForbidden, suite.withSession("POST", "/posts", cookie, "wrong", post).Code)
+	assert.Equal(t, http.StatusCreated, suite.withSession("POST", "/posts", cookie, started.CSRFToken, post).Code)
+}
+
+func TestSessionIdleAndAbsoluteTimeouts(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+
+	idle, idleSession := suite.sessionLogin(user.Email, "password123")
+	suite.db.Model(&models.Session{}).Where("id = ?", idleSession.Data.ID).
+		Update("last_seen_at", time.Now().Add(-31*time.Minute))
+	assert.Equal(t, http.StatusUnauthorized, suite.withSession("GET", "/users/me/sessions", idle, "", nil).Code)
+
+	var count int64
+	suite.db.Model(&models.Session{}).Where("id = ?", idleSession.Data.ID).Count(&count)
+	assert.Zero(t, count)
+
+	// Activity does not extend the absolute timeout
+	active, activeSession := suite.sessionLogin(user.Email, "password123")
+	suite.db.Model(&models.Session{}).Where("id = ?", activeSession.Data.ID).
+		Update("expires_at", time.Now().Add(-time.Second))
+	assert.Equal(t, http.StatusUnauthorized, suite.withSession("GET", "/users/me/sessions", active, "", nil).Code)
+
+	// A stale cookie does not get in the way of logging in again
+	w := httptest.NewRecorder()
+	jsonData, _ := json.Marshal(map[string]string{"email": user.Email, "password": "password123"})
+	req, _ := http.NewRequest("POST", "/auth/session", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(active)
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	laptop, laptopSession := suite.sessionLogin(user.Email, "password123")
+	phone, phoneSession := suite.sessionLogin(user.Email, "password123")
+	tablet, _ := suite.sessionLogin(user.Email, "password123")
+
+	// Another user cannot revoke the session
+	other := suite.UserFactory()
+	req, _ := http.NewRequest("DELETE", "/users/me/sessions/"+phoneSession.Data.ID, nil)
+	req.Header.Set("Authorization", suite.AuthHeader(other))
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = suite.withSession("DELETE", "/users/me/sessions/"+phoneSession.Data.ID, laptop, laptopSession.CSRFToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, suite.withSession("GET", "/users/me/sessions", phone, "", nil).Code)
+
+	w = suite.withSession("DELETE", "/users/me/sessions", laptop, laptopSession.CSRFToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, suite.withSession("GET", "/users/me/sessions", tablet, "", nil).Code)
+	assert.Equal(t, http.StatusOK, suite.withSession("GET", "/users/me/sessions", laptop, "", nil).Code)
+
+	w = suite.withSession("DELETE", "/auth/session", laptop, laptopSession.CSRFToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, -1, sessionCookie(w).MaxAge)
+	assert.Equal(t, http.StatusUnauthorized, suite.withSession("GET", "/users/me/sessions", laptop, "", nil).Code)
+}
+
+func TestPasswordChangeEndsSessions(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	cookie, _ := suite.sessionLogin(user.Email, "password123")
+
+	w := suite.changePassword(suite.AuthHeader(user), "password123", "Corr3ct-Horse-Battery")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, suite.withSession("GET", "/users/me/sessions", cookie, "", nil).Code)
+}
+
+func TestSessionLoginWithTwoFactor(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	secret, _, step := suite.enableTwoFactor(user)
+
+	w := suite.postJSON("/auth/session", map[string]string{"email": user.Email, "password": "password123"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Nil(t, sessionCookie(w))
+
+	var challenge schemas.TwoFactorChallengeResponse
+	json.Unmarshal(w.Body.Bytes(), &challenge)
+	code, _ := totp.Code(secret, step+1)
+	w = suite.postJSON("/auth/session/2fa", map[string]string{
+		"challenge_token": challenge.ChallengeToken,
+		"code":            code,
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotNil(t, sessionCookie(w))
+}
+
+func TestSessionStores(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	stores := map[string]session.Store{
+		"memory":   session.NewMemoryStore(),
+		"database": session.NewDBStore(suite.db),
+	}
+	for name, store := range stores {
+		now := time.Now().Truncate(time.Second)
+		created := &models.Session{
+			ID:         name + "-session",
+			UserID:     user.ID,
+			TokenHash:  name + "-hash",
+			CSRFToken:  "csrf",
+			CreatedAt:  now,
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(time.Hour),
+		}
+		assert.NoError(t, store.Create(t.Context(), created), name)
+
+		found, err := store.GetByToken(t.Context(), name+"-hash")
+		assert.NoError(t, err, name)
+		assert.Equal(t, created.ID, found.ID, name)
+
+		assert.NoError(t, store.Touch(t.Context(), created.ID, now.Add(time.Minute)), name)
+		found, _ = store.GetByToken(t.Context(), name+"-hash")
+		assert.True(t, found.LastSeenAt.Equal(now.Add(time.Minute)), name)
+
+		listed, err := store.ListByUser(t.Context(), user.ID)
+		assert.NoError(t, err, name)
+		assert.Len(t, listed, 1, name)
+
+		assert.ErrorIs(t, store.Delete(t.Context(), user.ID+1, created.ID), session.ErrNotFound, name)
+		assert.NoError(t, store.Delete(t.Context(), user.ID, created.ID), name)
+		_, err = store.GetByToken(t.Context(), name+"-hash")
+		assert.ErrorIs(t, err, session.ErrNotFound, name)
+	}
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"encoding/json"
+	"go-crud/middleware"
+	"go-crud/schemas"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func spansForTrace(traceID string) map[string]sdktrace.ReadOnlySpan {
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range spanRecorder.Ended() {
+		if span.SpanContext().TraceID().String() == traceID {
+			spans[span.Name()] = span
+		}
+	}
+	return spans
+}
+
+func TestTracingContinuesIncomingTraceContext(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("GET", "/posts/9999", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response schemas.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, traceID, response.TraceID)
+	assert.Equal(t, traceID, w.Header().Get(middleware.TraceIDHeader))
+
+	spans := spansForTrace(traceID)
+	requestSpan, ok := spans["GET /posts/:id"]
+	assert.True(t, ok)
+	serviceSpan, ok := spans["PostService.GetByID"]
+	assert.True(t, ok)
+	querySpan, ok := spans["gorm.query"]
+	assert.True(t, ok)
+
+	if requestSpan != nil && serviceSpan != nil && querySpan != nil {
+		assert.Equal(t, "00f067aa0ba902b7", requestSpan.Parent().SpanID().String())
+		assert.Equal(t, requestSpan.SpanContext().SpanID(), serviceSpan.Parent().SpanID())
+		assert.Equal(t, serviceSpan.SpanContext().SpanID(), querySpan.Parent().SpanID())
+	}
+}
+
+func TestTracingStartsNewTraceWithoutTraceContext(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	req, _ := http.NewRequest("GET", "/posts/9999", nil)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	var response schemas.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	assert.Len(t, response.TraceID, 32)
+	assert.Equal(t, response.TraceID, w.Header().Get(middleware.TraceIDHeader))
+}
@@ -0,0 +1,244 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"go-crud/totp"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (suite *BaseTestSuite) authedPost(path, authHeader string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authHeader)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	return w
+}
+
+// enableTwoFactor enrolls user through the API and returns the TOTP secret,
+// the recovery codes and the time step already spent on confirmation
+func (suite *BaseTestSuite) enableTwoFactor(user models.User) (string, []string, int64) {
+	auth := suite.AuthHeader(user)
+
+	var enrollment schemas.TwoFactorEnrollmentResponse
+	w := suite.authedPost("/users/me/2fa/enroll", auth, nil)
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, step)
+	var recovery schemas.RecoveryCodesResponse
+	w = suite.authedPost("/users/me/2fa/confirm", auth, map[string]string{"code": code})
+	if w.Code != http.StatusOK {
+		suite.t.Fatalf("Failed to confirm two-factor enrollment: %s", w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &recovery)
+	return enrollment.Secret, recovery.RecoveryCodes, step
+}
+
+func (suite *BaseTestSuite) loginChallenge(email, password string) string {
+	w := suite.login(email, password)
+	if w.Code != http.StatusAccepted {
+		suite.t.Fatalf("Expected a two-factor challenge, got %d: %s", w.Code, w.Body.String())
+	}
+	var challenge schemas.TwoFactorChallengeResponse
+	json.Unmarshal(w.Body.Bytes(), &challenge)
+	return challenge.ChallengeToken
+}
+
+func (suite *BaseTestSuite) verifyTwoFactor(challenge, code string) *httptest.ResponseRecorder {
+	return suite.postJSON("/auth/2fa/verify", map[string]string{
+		"challenge_token": challenge,
+		"code":            code,
+	})
+}
+
+func TestTOTPMatchesRFC6238Vectors(t *testing.T) {
+	t.Parallel()
+
+	// Base32 of the RFC's SHA-1 key "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, want, code, "T=%d", unix)
+	}
+
+	step, ok := totp.Validate(secret, "287082", time.Unix(59+30, 0), 1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), step)
+	_, ok = totp.Validate(secret, "287082", time.Unix(59+90, 0), 1)
+	assert.False(t, ok)
+}
+
+func TestTwoFactorEnrollmentReturnsURIAndQRCode(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	auth := suite.AuthHeader(user)
+
+	w := suite.authedPost("/users/me/2fa/enroll", auth, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var enrollment schemas.TwoFactorEnrollmentResponse
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	assert.Contains(t, enrollment.OTPAuthURI, "otpauth://totp/")
+	assert.Contains(t, enrollment.OTPAuthURI, "secret="+enrollment.Secret)
+	assert.True(t, bytes.HasPrefix(enrollment.QRCodePNG, []byte("\x89PNG")))
+
+	req, _ := http.NewRequest("GET", "/users/me/2fa/qr.png", nil)
+	req.Header.Set("Authorization", auth)
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	// Not enforced until confirmed
+	assert.Equal(t, http.StatusOK, suite.login(user.Email, "password123").Code)
+}
+
+func TestTwoFactorConfirmRejectsWrongCode(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	auth := suite.AuthHeader(user)
+	suite.authedPost("/users/me/2fa/enroll", auth, nil)
+
+	w := suite.authedPost("/users/me/2fa/confirm", auth, map[string]string{"code": "000000"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.False(t, stored.HasTwoFactor())
+}
+
+func TestTwoFactorLoginRequiresCode(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	secret, _, step := suite.enableTwoFactor(user)
+
+	challenge := suite.loginChallenge(user.Email, "password123")
+
+	// The challenge is not an access token
+	req, _ := http.NewRequest("GET", "/users/"+strconv.FormatUint(uint64(user.ID), 10), nil)
+	req.Header.Set("Authorization", "Bearer "+challenge)
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, suite.verifyTwoFactor(challenge, "000000").Code)
+
+	// The code spent on confirmation cannot be replayed
+	used, _ := totp.Code(secret, step)
+	assert.Equal(t, http.StatusUnauthorized, suite.verifyTwoFactor(challenge, used).Code)
+
+	next, _ := totp.Code(secret, step+1)
+	w = suite.verifyTwoFactor(challenge, next)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var tokens schemas.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	assert.NotEmpty(t, tokens.AccessToken)
+}
+
+func TestTwoFactorRecoveryCodesAreSingleUse(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+	_, codes, _ := suite.enableTwoFactor(user)
+	assert.Len(t, codes, 10)
+
+	var stored []models.RecoveryCode
+	suite.db.Where("user_id = ?", user.ID).Find(&stored)
+	for _, code := range stored {
+		assert.NotContains(t, codes, code.CodeHash)
+	}
+
+	challenge := suite.loginChallenge(user.Email, "password123")
+	assert.Equal(t, http.StatusOK, suite.verifyTwoFactor(challenge, codes[0]).Code)
+
+	challenge = suite.loginChallenge(user.Email, "password123")
+	assert.Equal(t, http.StatusUnauthorized, suite.verifyTwoFactor(challenge, codes[0]).Code)
+}
+
+func TestAdminResetsTwoFactor(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+	user := suite.UserFactory(WithPassword("password123"))
+	suite.enableTwoFactor(user)
+	path := "/admin/users/" + strconv.FormatUint(uint64(user.ID), 10) + "/2fa/reset"
+
+	assert.Equal(t, http.StatusForbidden, suite.authedPost(path, suite.AuthHeader(user), nil).Code)
+	assert.Equal(t, http.StatusOK, suite.authedPost(path, suite.AuthHeader(admin), nil).Code)
+
+	assert.Equal(t, http.StatusOK, suite.login(user.Email, "password123").Code)
+
+	var count int64
+	suite.db.Model(&models.RecoveryCode{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestTwoFactorWithInjectedClock(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	user := suite.UserFactory(WithPassword("password123"))
+	twoFactor := services.NewTwoFactorService(suite.db)
+	twoFactor.SetClock(clock)
+
+	enrollment, err := twoFactor.BeginEnrollment(t.Context(), user.ID)
+	assert.NoError(t, err)
+	code, _ := totp.Code(enrollment.Secret, totp.Step(now))
+	_, err = twoFactor.ConfirmEnrollment(t.Context(), user.ID, code)
+	assert.NoError(t, err)
+
+	auth := services.NewAuthService(suite.db, services.NewTokenService(), services.LoadLoginPolicy())
+	auth.SetClock(clock)
+
+	_, _, err = auth.Login(t.Context(), user.Email, "password123", "198.51.100.41")
+	var required *services.TwoFactorRequiredError
+	assert.True(t, errors.As(err, &required))
+
+	// Two minutes later the code is outside the accepted drift
+	now = now.Add(2 * time.Minute)
+	_, _, err = auth.VerifyTwoFactor(t.Context(), required.ChallengeToken, code, "198.51.100.41")
+	assert.ErrorIs(t, err, services.ErrInvalidTwoFactorCode)
+
+	code, _ = totp.Code(enrollment.Secret, totp.Step(now))
+	_, tokens, err := auth.VerifyTwoFactor(t.Context(), required.ChallengeToken, code, "198.51.100.41")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+}
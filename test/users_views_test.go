@@ -3,6 +3,7 @@ package test
 import (
 	"bytes"
 	"encoding/json"
+	"go-crud/models"
 	"go-crud/schemas"
 	"net/http"
 	"net/http/httptest"
@@ -13,13 +14,14 @@ import (
 )
 
 func TestCreateUserSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
 	requestBody := map[string]string{
 		"name":   "Connor Tran",
 		"email": "connortran@gmail.com",
-		"password": "password123",
+		"password": "Corr3ct-Horse-Battery",
 	}
 
 	jsonData, _ := json.Marshal(requestBody)
@@ -40,6 +42,7 @@ func TestCreateUserSuccess(t *testing.T) {
 }
 
 func TestCreateUserValidationError(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
@@ -66,6 +69,7 @@ func TestCreateUserValidationError(t *testing.T) {
 }
 
 func TestCreateUserMissingFields(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
@@ -91,25 +95,49 @@ func TestCreateUserMissingFields(t *testing.T) {
 }
 
 func TestGetUserByIDSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
-	user := UserFactory()
+	user := suite.UserFactory()
 	req, _ := http.NewRequest("GET", "/users/"+strconv.FormatUint(uint64(user.ID), 10), nil)
+	req.Header.Set("Authorization", suite.AuthHeader(user))
 
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	var response schemas.UserResponse
+	var response schemas.ProfileResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.Equal(t, user.Name, response.Data.Name)
 	assert.Equal(t, user.Email, response.Data.Email)
 }
 
+func TestGetUserByIDHidesPrivateFields(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory()
+	req, _ := http.NewRequest("GET", "/users/"+strconv.FormatUint(uint64(user.ID), 10), nil)
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), user.Email)
+	assert.NotContains(t, w.Body.String(), "status")
+
+	suite.db.Model(&user).Updates(map[string]interface{}{"status": models.UserStatusSuspended, "status_reason": "Posting spam"})
+	w = httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
 func TestGetUserByIDNotFound(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
@@ -127,10 +155,11 @@ func TestGetUserByIDNotFound(t *testing.T) {
 }
 
 func TestPartialUpdateUserSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
-	user := UserFactory()
+	user := suite.UserFactory()
 
 	requestBody := map[string]string{
 		"name": "Updated Name",
@@ -140,6 +169,7 @@ func TestPartialUpdateUserSuccess(t *testing.T) {
 
 	req, _ := http.NewRequest("PATCH", "/users/"+strconv.FormatUint(uint64(user.ID), 10), bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", suite.AuthHeader(user))
 
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
@@ -154,6 +184,7 @@ func TestPartialUpdateUserSuccess(t *testing.T) {
 }
 
 func TestPartialUpdateUserNotFound(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
@@ -163,8 +194,11 @@ func TestPartialUpdateUserNotFound(t *testing.T) {
 
 	jsonData, _ := json.Marshal(requestBody)
 
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+
 	req, _ := http.NewRequest("PATCH", "/users/9999", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", suite.AuthHeader(admin))
 
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
@@ -178,19 +212,21 @@ func TestPartialUpdateUserNotFound(t *testing.T) {
 }
 
 func TestPartialUpdateUserValidationError(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
-	user := UserFactory()
+	user := suite.UserFactory()
 
 	requestBody := map[string]string{
-		"email": "invalid-email",
+		"name": "ab",
 	}
 
 	jsonData, _ := json.Marshal(requestBody)
 
 	req, _ := http.NewRequest("PATCH", "/users/"+strconv.FormatUint(uint64(user.ID), 10), bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", suite.AuthHeader(user))
 
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
@@ -204,12 +240,15 @@ func TestPartialUpdateUserValidationError(t *testing.T) {
 }
 
 func TestDeleteUserSuccess(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
-	user := UserFactory()
+	user := suite.UserFactory()
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
 
 	req, _ := http.NewRequest("DELETE", "/users/"+strconv.FormatUint(uint64(user.ID), 10), nil)
+	req.Header.Set("Authorization", suite.AuthHeader(admin))
 
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
@@ -223,10 +262,14 @@ func TestDeleteUserSuccess(t *testing.T) {
 }
 
 func TestDeleteUserNotFound(t *testing.T) {
+	t.Parallel()
 	suite := NewTestSuite(t)
 	defer suite.TearDown()
 
+	admin := suite.UserFactory(WithRole(models.RoleAdmin))
+
 	req, _ := http.NewRequest("DELETE", "/users/9999", nil)
+	req.Header.Set("Authorization", suite.AuthHeader(admin))
 
 	w := httptest.NewRecorder()
 	suite.router.ServeHTTP(w, req)
@@ -238,3 +281,65 @@ func TestDeleteUserNotFound(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, response.Error, "User not found")
 }
+
+func TestCreateUserRejectsWeakPassword(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	requestBody := map[string]string{
+		"name":     "Connor Tran",
+		"email":    "connor.weak@example.com",
+		"password": "password123",
+	}
+
+	jsonData, _ := json.Marshal(requestBody)
+
+	req, _ := http.NewRequest("POST", "/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response schemas.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "password_policy", response.Code)
+
+	codes := []string{}
+	for _, detail := range response.Details {
+		codes = append(codes, detail.Code)
+	}
+	assert.ElementsMatch(t, []string{"password_too_few_character_classes", "password_breached"}, codes)
+}
+
+func TestPartialUpdateUserIgnoresPassword(t *testing.T) {
+	t.Parallel()
+	suite := NewTestSuite(t)
+	defer suite.TearDown()
+
+	user := suite.UserFactory(WithPassword("password123"))
+
+	requestBody := map[string]string{
+		"name":     "Renamed User",
+		"password": "Corr3ct-Horse-Battery",
+	}
+
+	jsonData, _ := json.Marshal(requestBody)
+
+	req, _ := http.NewRequest("PATCH", "/users/"+strconv.FormatUint(uint64(user.ID), 10), bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", suite.AuthHeader(user))
+
+	w := httptest.NewRecorder()
+	suite.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stored models.User
+	suite.db.First(&stored, user.ID)
+	assert.Equal(t, "Renamed User", stored.Name)
+	assert.Equal(t, user.HashedPassword, stored.HashedPassword)
+}
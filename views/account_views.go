@@ -0,0 +1,235 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/middleware"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountViews struct {
+	deletion *services.AccountDeletionService
+	exports  *services.DataExportService
+	status   *services.AccountStatusService
+}
+
+func NewAccountViews(deletion *services.AccountDeletionService, exports *services.DataExportService, status *services.AccountStatusService) *AccountViews {
+	return &AccountViews{
+		deletion: deletion,
+		exports:  exports,
+		status:   status,
+	}
+}
+
+// @Summary Export my data
+// @Description Starts building a ZIP of your profile, posts and audit log entries. Poll the returned export until its status is ready, then download it. While an export is being built, asking again returns it.
+// @Tags users
+// @Security BearerAuth
+// @Success 202 {object} schemas.DataExportResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 429 {object} schemas.ErrorResponse
+// @Router /users/me/export [post]
+func (v *AccountViews) RequestExport(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	export, err := v.exports.Request(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to start data export: %v", err)))
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/users/me/export/%d", export.ID))
+	c.JSON(http.StatusAccepted, schemas.DataExportResponse{
+		Data:    *export,
+		Message: "Data export started",
+	})
+}
+
+// @Summary Get a data export
+// @Tags users
+// @Security BearerAuth
+// @Param id path int true "Export ID"
+// @Success 200 {object} schemas.DataExportResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /users/me/export/{id} [get]
+func (v *AccountViews) GetExport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid export ID"))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	export, err := v.exports.Get(c.Request.Context(), userID, uint(id))
+	if err != nil {
+		dataExportErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.DataExportResponse{Data: *export})
+}
+
+// @Summary Download a data export
+// @Tags users
+// @Security BearerAuth
+// @Produce application/zip
+// @Param id path int true "Export ID"
+// @Success 200 {file} file "ZIP archive"
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /users/me/export/{id}/download [get]
+func (v *AccountViews) DownloadExport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid export ID"))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	archive, err := v.exports.Download(c.Request.Context(), userID, uint(id))
+	if err != nil {
+		dataExportErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="go-crud-export-%d.zip"`, id))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+func dataExportErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrDataExportNotFound):
+		c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "Data export not found or expired"))
+	case errors.Is(err, services.ErrDataExportNotReady):
+		c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), "Data export is not ready"))
+	default:
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch data export: %v", err)))
+	}
+}
+
+// @Summary Delete my account
+// @Description Requires the current password. Logs you out everywhere and erases the account once the grace period ends, unless you log in and cancel first. Erasure anonymizes the account; your posts stay, without your name.
+// @Tags users
+// @Security BearerAuth
+// @Param input body schemas.DeleteAccountInput true "Current password"
+// @Success 202 {object} schemas.UserResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Router /users/me [delete]
+func (v *AccountViews) DeleteAccount(c *gin.Context) {
+	var input schemas.DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	user, err := v.deletion.Schedule(c.Request.Context(), userID, input.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword):
+			c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "Current password is incorrect"))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to schedule account deletion: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, schemas.UserResponse{
+		Data:    *user,
+		Message: "Account scheduled for deletion",
+	})
+}
+
+// @Summary Cancel my account deletion
+// @Tags users
+// @Security BearerAuth
+// @Success 200 {object} schemas.UserResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /users/me/restore [post]
+func (v *AccountViews) CancelDeletion(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	user, err := v.deletion.Cancel(c.Request.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDeletionNotScheduled):
+			c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), "Account deletion is not scheduled"))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to cancel account deletion: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.UserResponse{
+		Data:    *user,
+		Message: "Account deletion cancelled",
+	})
+}
+
+// @Summary Deactivate my account
+// @Description Requires the current password. Logs you out everywhere; logging in again reopens the account. Nothing is erased.
+// @Tags users
+// @Security BearerAuth
+// @Param input body schemas.DeactivateAccountInput true "Current password"
+// @Success 200 {object} schemas.UserResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Router /users/me/deactivate [post]
+func (v *AccountViews) Deactivate(c *gin.Context) {
+	var input schemas.DeactivateAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	user, err := v.status.Deactivate(c.Request.Context(), userID, input.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword):
+			c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "Current password is incorrect"))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to deactivate account: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.UserResponse{
+		Data:    *user,
+		Message: "Account deactivated",
+	})
+}
+
+// RegisterRoutes registers data export, deactivation and account deletion
+// routes
+func (v *AccountViews) RegisterRoutes(router *gin.Engine) {
+	me := router.Group("/users/me", middleware.RequireAuth())
+	{
+		me.POST("/export", v.RequestExport)
+		me.GET("/export/:id", v.GetExport)
+		me.GET("/export/:id/download", v.DownloadExport)
+		me.DELETE("", v.DeleteAccount)
+		me.POST("/restore", v.CancelDeletion)
+		me.POST("/deactivate", v.Deactivate)
+	}
+}
@@ -0,0 +1,332 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-crud/logging"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminViews struct {
+	authService   *services.AuthService
+	twoFactor     *services.TwoFactorService
+	impersonation *services.ImpersonationService
+	audit         *services.AuditService
+	status        *services.AccountStatusService
+}
+
+func NewAdminViews(authService *services.AuthService, twoFactor *services.TwoFactorService, impersonation *services.ImpersonationService, audit *services.AuditService, status *services.AccountStatusService) *AdminViews {
+	return &AdminViews{
+		authService:   authService,
+		twoFactor:     twoFactor,
+		impersonation: impersonation,
+		audit:         audit,
+		status:        status,
+	}
+}
+
+// @Summary Unlock a locked-out user
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} schemas.UserResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /admin/users/{id}/unlock [post]
+func (v *AdminViews) UnlockUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
+		return
+	}
+
+	adminID, _ := middleware.CurrentUserID(c)
+	result, err := v.authService.Unlock(c.Request.Context(), uint(id), adminID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "User not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to unlock user: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.UserResponse{
+		Data:    *result,
+		Message: "User unlocked successfully",
+	})
+}
+
+// @Summary Reset a user's two-factor authentication
+// @Description For users who lost their authenticator and recovery codes. Disables two-factor and revokes the user's tokens.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} schemas.UserResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /admin/users/{id}/2fa/reset [post]
+func (v *AdminViews) ResetTwoFactor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
+		return
+	}
+
+	adminID, _ := middleware.CurrentUserID(c)
+	result, err := v.twoFactor.Reset(c.Request.Context(), uint(id), adminID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "User not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to reset two-factor authentication: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.UserResponse{
+		Data:    *result,
+		Message: "Two-factor authentication reset successfully",
+	})
+}
+
+// @Summary Suspend a user
+// @Description Stops the user logging in or making changes, until the given time or, without one, until reinstated. Their posts are hidden from public listings meanwhile. The reason is shown to the user when they try to log in.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param input body schemas.SuspendUserInput true "Why and until when"
+// @Success 200 {object} schemas.UserResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /admin/users/{id}/suspend [post]
+func (v *AdminViews) SuspendUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
+		return
+	}
+
+	var input schemas.SuspendUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	adminID, _ := middleware.CurrentUserID(c)
+	result, err := v.status.Suspend(c.Request.Context(), uint(id), adminID, input.Reason, input.Until)
+	if err != nil {
+		switch {
+		case err.Error() == "user not found":
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "User not found"))
+		case errors.Is(err, services.ErrSuspendSelf):
+			c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), err.Error()))
+		case errors.Is(err, services.ErrSuspensionEnded):
+			c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to suspend user: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.UserResponse{
+		Data:    *result,
+		Message: "User suspended successfully",
+	})
+}
+
+// @Summary Reinstate a user
+// @Description Makes a suspended or deactivated account active again.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} schemas.UserResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /admin/users/{id}/reinstate [post]
+func (v *AdminViews) ReinstateUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
+		return
+	}
+
+	adminID, _ := middleware.CurrentUserID(c)
+	result, err := v.status.Reinstate(c.Request.Context(), uint(id), adminID)
+	if err != nil {
+		switch {
+		case err.Error() == "user not found":
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "User not found"))
+		case errors.Is(err, services.ErrAccountNotBlocked):
+			c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), "User is already active"))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to reinstate user: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.UserResponse{
+		Data:    *result,
+		Message: "User reinstated successfully",
+	})
+}
+
+// @Summary Impersonate a user
+// @Description Issues a short-lived access token acting as the user, for support. The reason is recorded in the audit log, as is every request made with the token. Password, email, two-factor, API key, OAuth and session changes are refused while impersonating, and there is no refresh token.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param input body schemas.ImpersonateInput true "Why the user is being impersonated"
+// @Success 201 {object} schemas.ImpersonationResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /admin/users/{id}/impersonate [post]
+func (v *AdminViews) Impersonate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
+		return
+	}
+
+	var input schemas.ImpersonateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	adminID, _ := middleware.CurrentUserID(c)
+	target, tokens, err := v.impersonation.Start(c.Request.Context(), adminID, uint(id), input.Reason)
+	if err != nil {
+		switch {
+		case err.Error() == "user not found":
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "User not found"))
+		case errors.Is(err, services.ErrImpersonateSelf), errors.Is(err, services.ErrImpersonateAdmin):
+			c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), err.Error()))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to start impersonation: %v", err)))
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, schemas.ImpersonationResponse{
+		AccessToken: tokens.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(tokens.ExpiresIn.Seconds()),
+		User:        *target,
+		Message:     "Impersonation started",
+	})
+}
+
+// bindAuditQuery reads the audit log filters, answering 400 if they are
+// invalid
+func bindAuditQuery(c *gin.Context) (schemas.ListAuditLogsQueryParams, bool) {
+	var query schemas.ListAuditLogsQueryParams
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid query parameters: %v", err)))
+		return query, false
+	}
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return query, false
+	}
+	return query, true
+}
+
+// @Summary List audit log entries
+// @Description Newest first. Filters combine; since and until are RFC 3339 timestamps.
+// @Tags admin
+// @Security BearerAuth
+// @Param query query schemas.ListAuditLogsQueryParams false "Filters"
+// @Success 200 {object} schemas.ListAuditLogsResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Router /admin/audit [get]
+func (v *AdminViews) ListAuditLogs(c *gin.Context) {
+	query, ok := bindAuditQuery(c)
+	if !ok {
+		return
+	}
+
+	entries, total, err := v.audit.List(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch audit log: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.ListAuditLogsResponse{
+		Data:  entries,
+		Limit: query.Limit,
+		Page:  query.Page,
+		Total: int(total),
+	})
+}
+
+// @Summary Export audit log entries
+// @Description Streams every matching entry, oldest first, as JSON lines. Takes the same filters as /admin/audit; paging is ignored.
+// @Tags admin
+// @Security BearerAuth
+// @Produce application/x-ndjson
+// @Param query query schemas.ListAuditLogsQueryParams false "Filters"
+// @Success 200 {string} string "One AuditLog per line"
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Router /admin/audit/export [get]
+func (v *AdminViews) ExportAuditLogs(c *gin.Context) {
+	query, ok := bindAuditQuery(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit-log.jsonl"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	err := v.audit.Export(c.Request.Context(), query, func(entry models.AuditLog) error {
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		// The status is already sent; a truncated file is all we can signal
+		logging.FromContext(c.Request.Context()).Error("audit log export failed", "error", err)
+	}
+}
+
+// RegisterRoutes registers admin-only routes
+func (v *AdminViews) RegisterRoutes(router *gin.Engine) {
+	admin := router.Group("/admin", middleware.RequireRole(models.RoleAdmin))
+	{
+		admin.POST("/users/:id/unlock", v.UnlockUser)
+		admin.POST("/users/:id/2fa/reset", v.ResetTwoFactor)
+		admin.POST("/users/:id/suspend", v.SuspendUser)
+		admin.POST("/users/:id/reinstate", v.ReinstateUser)
+		admin.POST("/users/:id/impersonate", v.Impersonate)
+		admin.GET("/audit", v.ListAuditLogs)
+		admin.GET("/audit/export", v.ExportAuditLogs)
+	}
+}
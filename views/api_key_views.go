@@ -0,0 +1,121 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/middleware"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyViews struct {
+	service *services.APIKeyService
+}
+
+func NewAPIKeyViews(service *services.APIKeyService) *APIKeyViews {
+	return &APIKeyViews{
+		service: service,
+	}
+}
+
+// @Summary List API keys
+// @Tags api-keys
+// @Security BearerAuth
+// @Success 200 {object} schemas.ListAPIKeysResponse
+// @Router /users/me/api-keys [get]
+func (v *APIKeyViews) ListAPIKeys(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	keys, err := v.service.List(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch API keys: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.ListAPIKeysResponse{Data: keys})
+}
+
+// @Summary Create API key
+// @Description Issues a personal API key for the X-API-Key header. The key is returned only once.
+// @Tags api-keys
+// @Security BearerAuth
+// @Param key body schemas.CreateAPIKeyInput true "Key name, scopes and optional expiry"
+// @Success 201 {object} schemas.CreateAPIKeyResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /users/me/api-keys [post]
+func (v *APIKeyViews) CreateAPIKey(c *gin.Context) {
+	var input schemas.CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	key, rawKey, err := v.service.Create(c.Request.Context(), userID, input.Name, input.Scopes, input.ExpiresAt)
+	if err != nil {
+		var unknownScope *services.UnknownScopeError
+		var limit *services.APIKeyLimitError
+		switch {
+		case errors.As(err, &unknownScope), errors.Is(err, services.ErrInvalidAPIExpiry):
+			c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		case errors.As(err, &limit):
+			c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), err.Error()))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to create API key: %v", err)))
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, schemas.CreateAPIKeyResponse{
+		Data:    *key,
+		Key:     rawKey,
+		Message: "API key created, store it now as it will not be shown again",
+	})
+}
+
+// @Summary Revoke API key
+// @Tags api-keys
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} schemas.MessageResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /users/me/api-keys/{id} [delete]
+func (v *APIKeyViews) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid ID format"))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	if err := v.service.Revoke(c.Request.Context(), userID, uint(id)); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "API key not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to revoke API key: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.MessageResponse{Message: "API key revoked"})
+}
+
+// RegisterRoutes registers API key management routes
+func (v *APIKeyViews) RegisterRoutes(router *gin.Engine) {
+	apiKeys := router.Group("/users/me/api-keys", middleware.RequireAuth())
+	{
+		apiKeys.GET("", v.ListAPIKeys)
+		apiKeys.POST("", v.CreateAPIKey)
+		apiKeys.DELETE("/:id", v.RevokeAPIKey)
+	}
+}
@@ -0,0 +1,474 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthViews struct {
+	service       *services.AuthService
+	resets        *services.PasswordResetService
+	verifications *services.EmailVerificationService
+	emailChanges  *services.EmailChangeService
+}
+
+func NewAuthViews(service *services.AuthService, resets *services.PasswordResetService, verifications *services.EmailVerificationService, emailChanges *services.EmailChangeService) *AuthViews {
+	return &AuthViews{
+		service:       service,
+		resets:        resets,
+		verifications: verifications,
+		emailChanges:  emailChanges,
+	}
+}
+
+func newTokenResponse(tokens *services.TokenPair) schemas.TokenResponse {
+	return schemas.TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+	}
+}
+
+// @Summary Log in
+// @Tags auth
+// @Param credentials body schemas.LoginInput true "Credentials"
+// @Description Answers 202 with a challenge token instead of tokens when the account has two-factor enabled; finish with /auth/2fa/verify.
+// @Success 200 {object} schemas.TokenResponse
+// @Success 202 {object} schemas.TwoFactorChallengeResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 423 {object} schemas.ErrorResponse
+// @Failure 429 {object} schemas.ErrorResponse
+// @Router /auth/login [post]
+func (v *AuthViews) Login(c *gin.Context) {
+	var input schemas.LoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	_, tokens, err := v.service.Login(c.Request.Context(), input.Email, input.Password, c.ClientIP())
+	if err != nil {
+		var required *services.TwoFactorRequiredError
+		if errors.As(err, &required) {
+			c.JSON(http.StatusAccepted, newTwoFactorChallengeResponse(required))
+			return
+		}
+		loginErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+func newTwoFactorChallengeResponse(required *services.TwoFactorRequiredError) schemas.TwoFactorChallengeResponse {
+	return schemas.TwoFactorChallengeResponse{
+		ChallengeToken: required.ChallengeToken,
+		ExpiresIn:      int(required.ExpiresIn.Seconds()),
+		Message:        "Two-factor authentication required",
+	}
+}
+
+// @Summary Complete a two-factor login
+// @Tags auth
+// @Param verification body schemas.VerifyTwoFactorInput true "Challenge token from /auth/login and a TOTP or recovery code"
+// @Success 200 {object} schemas.TokenResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 423 {object} schemas.ErrorResponse
+// @Failure 429 {object} schemas.ErrorResponse
+// @Router /auth/2fa/verify [post]
+func (v *AuthViews) VerifyTwoFactor(c *gin.Context) {
+	var input schemas.VerifyTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	_, tokens, err := v.service.VerifyTwoFactor(c.Request.Context(), input.ChallengeToken, input.Code, c.ClientIP())
+	if err != nil {
+		twoFactorErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+// twoFactorErrorResponse maps the errors of the second login step
+func twoFactorErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidToken):
+		c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "Invalid or expired challenge token"))
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "Invalid two-factor code"))
+	default:
+		loginErrorResponse(c, err)
+	}
+}
+
+// loginErrorResponse maps the errors shared by both login steps
+func loginErrorResponse(c *gin.Context, err error) {
+	var tooMany *services.TooManyAttemptsError
+	var inactive *services.AccountInactiveError
+	switch {
+	case errors.As(err, &inactive):
+		accountInactiveResponse(c, inactive)
+	case errors.As(err, &tooMany):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, schemas.NewErrorResponse(c.Request.Context(), "Too many failed login attempts, please retry later"))
+	case errors.Is(err, services.ErrAccountLocked):
+		c.JSON(http.StatusLocked, schemas.NewErrorResponse(c.Request.Context(), "Account is temporarily locked"))
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "Invalid email or password"))
+	default:
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to log in: %v", err)))
+	}
+}
+
+// accountInactiveResponse tells a deactivated or suspended user why they
+// cannot log in and, for suspensions, until when
+func accountInactiveResponse(c *gin.Context, inactive *services.AccountInactiveError) {
+	message := fmt.Sprintf("Account is %s", inactive.Status)
+	if inactive.Until != nil {
+		message += " until " + inactive.Until.UTC().Format(time.RFC3339)
+	}
+	if inactive.Reason != "" {
+		message += ": " + inactive.Reason
+	}
+	response := schemas.NewErrorResponse(c.Request.Context(), message)
+	response.Code = "account_" + inactive.Status
+	c.JSON(http.StatusForbidden, response)
+}
+
+// @Summary Refresh tokens
+// @Tags auth
+// @Param token body schemas.RefreshTokenInput true "Refresh token"
+// @Success 200 {object} schemas.TokenResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Router /auth/refresh [post]
+func (v *AuthViews) Refresh(c *gin.Context) {
+	var input schemas.RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	tokens, err := v.service.Refresh(c.Request.Context(), input.RefreshToken)
+	if err != nil {
+		var inactive *services.AccountInactiveError
+		if errors.As(err, &inactive) {
+			accountInactiveResponse(c, inactive)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "Invalid or expired refresh token"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to refresh token: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+// @Summary Change own password
+// @Description Requires the current password. Every previously issued token is revoked; a fresh pair is returned.
+// @Tags auth
+// @Security BearerAuth
+// @Param passwords body schemas.ChangePasswordInput true "Current and new password"
+// @Success 200 {object} schemas.TokenResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Router /users/me/password [post]
+func (v *AuthViews) ChangePassword(c *gin.Context) {
+	var input schemas.ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	tokens, err := v.service.ChangePassword(c.Request.Context(), userID, input.CurrentPassword, input.NewPassword)
+	if err != nil {
+		if response, ok := passwordPolicyResponse(c, err); ok {
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		if errors.Is(err, services.ErrIncorrectPassword) {
+			c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "Current password is incorrect"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to change password: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+// @Summary Request a password reset
+// @Description Emails a single-use reset link if the address belongs to an account. The response is the same either way.
+// @Tags auth
+// @Param email body schemas.ForgotPasswordInput true "Account email"
+// @Success 202 {object} schemas.MessageResponse
+// @Router /auth/password/forgot [post]
+func (v *AuthViews) ForgotPassword(c *gin.Context) {
+	var input schemas.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	// Handled in the background, so the response never reveals whether the
+	// email is registered
+	v.resets.RequestReset(c.Request.Context(), input.Email)
+
+	c.JSON(http.StatusAccepted, schemas.MessageResponse{
+		Message: "If that email is registered, a password reset link has been sent",
+	})
+}
+
+// @Summary Reset password with a reset token
+// @Description Redeems a token from /auth/password/forgot. Every existing token for the account is revoked.
+// @Tags auth
+// @Param reset body schemas.ResetPasswordInput true "Reset token and new password"
+// @Success 200 {object} schemas.MessageResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Router /auth/password/reset [post]
+func (v *AuthViews) ResetPassword(c *gin.Context) {
+	var input schemas.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	if err := v.resets.ResetPassword(c.Request.Context(), input.Token, input.NewPassword); err != nil {
+		if response, ok := passwordPolicyResponse(c, err); ok {
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid or expired reset token"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to reset password: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.MessageResponse{
+		Message: "Password reset successfully",
+	})
+}
+
+// @Summary Verify email address
+// @Tags auth
+// @Param token query string true "Token from the verification email"
+// @Success 200 {object} schemas.UserResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Router /auth/verify [get]
+func (v *AuthViews) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Verification token is required"))
+		return
+	}
+
+	user, err := v.verifications.Verify(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid or expired verification token"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to verify email: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.UserResponse{
+		Data:    *user,
+		Message: "Email verified successfully",
+	})
+}
+
+// @Summary Resend the verification email
+// @Tags auth
+// @Security BearerAuth
+// @Success 202 {object} schemas.MessageResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Failure 429 {object} schemas.ErrorResponse
+// @Router /auth/verify/resend [post]
+func (v *AuthViews) ResendVerification(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	err := v.verifications.Resend(c.Request.Context(), userID)
+	if err != nil {
+		var throttled *services.ResendThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, schemas.NewErrorResponse(c.Request.Context(), "A verification email was sent recently, please retry later"))
+		case errors.Is(err, services.ErrEmailAlreadyVerified):
+			c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), "Email is already verified"))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to resend verification email: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, schemas.MessageResponse{
+		Message: "Verification email sent",
+	})
+}
+
+// @Summary Request an email change
+// @Description Requires the current password. The change only applies once confirmed from the new address.
+// @Tags auth
+// @Security BearerAuth
+// @Param change body schemas.ChangeEmailInput true "New email and current password"
+// @Success 202 {object} schemas.MessageResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /users/me/email [post]
+func (v *AuthViews) ChangeEmail(c *gin.Context) {
+	var input schemas.ChangeEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	_, err := v.emailChanges.RequestChange(c.Request.Context(), userID, input.Password, input.NewEmail)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword):
+			c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "Current password is incorrect"))
+		case errors.Is(err, services.ErrSameEmail):
+			c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "New email is the same as the current one"))
+		case errors.Is(err, services.ErrEmailTaken):
+			c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), "Email is already in use"))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to request email change: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, schemas.MessageResponse{
+		Message: "Check the new address for a confirmation link",
+	})
+}
+
+// @Summary Confirm an email change
+// @Tags auth
+// @Param token query string true "Token from the confirmation email"
+// @Success 200 {object} schemas.UserResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /auth/email/confirm [get]
+func (v *AuthViews) ConfirmEmailChange(c *gin.Context) {
+	v.redeemEmailChange(c, v.emailChanges.Confirm, "Email changed successfully")
+}
+
+// @Summary Revert an email change
+// @Description Restores the previous address and revokes every token for the account
+// @Tags auth
+// @Param token query string true "Token from the change notification"
+// @Success 200 {object} schemas.UserResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /auth/email/revert [get]
+func (v *AuthViews) RevertEmailChange(c *gin.Context) {
+	v.redeemEmailChange(c, v.emailChanges.Revert, "Email change reverted successfully")
+}
+
+func (v *AuthViews) redeemEmailChange(c *gin.Context, redeem func(context.Context, string) (*models.User, error), message string) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Token is required"))
+		return
+	}
+
+	user, err := redeem(c.Request.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidEmailChangeToken):
+			c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid or expired token"))
+		case errors.Is(err, services.ErrEmailTaken):
+			c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), "Email is already in use"))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to update email: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.UserResponse{
+		Data:    *user,
+		Message: message,
+	})
+}
+
+// RegisterRoutes registers authentication routes
+func (v *AuthViews) RegisterRoutes(router *gin.Engine) {
+	auth := router.Group("/auth")
+	{
+		auth.POST("/login", v.Login)
+		auth.POST("/refresh", v.Refresh)
+		auth.POST("/2fa/verify", v.VerifyTwoFactor)
+		auth.POST("/password/forgot", v.ForgotPassword)
+		auth.POST("/password/reset", v.ResetPassword)
+		auth.GET("/verify", v.VerifyEmail)
+		auth.POST("/verify/resend", middleware.RequireAuth(), v.ResendVerification)
+		auth.GET("/email/confirm", v.ConfirmEmailChange)
+		auth.GET("/email/revert", v.RevertEmailChange)
+	}
+
+	router.POST("/users/me/password", middleware.RequireAuth(), v.ChangePassword)
+	router.POST("/users/me/email", middleware.RequireAuth(), v.ChangeEmail)
+}
@@ -0,0 +1,137 @@
+package views
+
+import (
+	"crypto/subtle"
+	"errors"
+	"go-crud/initializers"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie ties the provider's callback to the browser that started
+// the login, so an attacker cannot log a victim into the attacker's account
+const oidcStateCookie = "go_crud_oidc_state"
+
+type ExternalLoginViews struct {
+	service      *services.ExternalLoginService
+	secureCookie bool
+}
+
+// NewExternalLoginViews creates the external provider login views. The state
+// cookie follows SESSION_COOKIE_SECURE.
+func NewExternalLoginViews(service *services.ExternalLoginService) *ExternalLoginViews {
+	return &ExternalLoginViews{
+		service:      service,
+		secureCookie: initializers.GetEnvBool("SESSION_COOKIE_SECURE", true),
+	}
+}
+
+// @Summary Log in with the external provider
+// @Description Redirects the browser to the configured OpenID Connect provider.
+// @Tags auth
+// @Success 302 {string} string "Redirect to the provider"
+// @Failure 404 {object} schemas.ErrorResponse
+// @Failure 502 {object} schemas.ErrorResponse
+// @Router /auth/oidc/login [get]
+func (v *ExternalLoginViews) Login(c *gin.Context) {
+	authURL, state, err := v.service.Begin(c.Request.Context())
+	if err != nil {
+		externalLoginErrorResponse(c, err)
+		return
+	}
+
+	v.setStateCookie(c, state, int(v.service.StateTTL().Seconds()))
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// @Summary External provider callback
+// @Description Completes an external login. Links the provider account to the user with the same verified email, or registers a new user. Answers 202 with a challenge token when the account has two-factor enabled; finish with /auth/2fa/verify.
+// @Tags auth
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login redirect"
+// @Success 200 {object} schemas.TokenResponse
+// @Success 202 {object} schemas.TwoFactorChallengeResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Failure 423 {object} schemas.ErrorResponse
+// @Router /auth/oidc/callback [get]
+func (v *ExternalLoginViews) Callback(c *gin.Context) {
+	// The state is single use whatever happens next
+	cookie, _ := c.Cookie(oidcStateCookie)
+	v.setStateCookie(c, "", -1)
+
+	if providerError := c.Query("error"); providerError != "" {
+		c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "The provider did not complete the login: "+providerError))
+		return
+	}
+	state := c.Query("state")
+	if state == "" || c.Query("code") == "" {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "code and state are required"))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Login was not started from this browser"))
+		return
+	}
+
+	_, tokens, err := v.service.Complete(c.Request.Context(), state, c.Query("code"), c.ClientIP())
+	if err != nil {
+		var required *services.TwoFactorRequiredError
+		if errors.As(err, &required) {
+			c.JSON(http.StatusAccepted, newTwoFactorChallengeResponse(required))
+			return
+		}
+		externalLoginErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, newTokenResponse(tokens))
+}
+
+// externalLoginErrorResponse maps the errors of both external login steps
+func externalLoginErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrExternalLoginDisabled):
+		c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "External login is not configured"))
+	case errors.Is(err, services.ErrExternalLoginFailed):
+		c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "External login failed or expired, please start again"))
+	case errors.Is(err, services.ErrExternalEmailUnverified):
+		c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "The provider has not verified your email address"))
+	case errors.Is(err, services.ErrExternalAccountUnverified):
+		c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), "An account with this email exists but is not verified; log in with your password and verify your email first"))
+	case errors.Is(err, services.ErrExternalProviderUnavailable):
+		c.JSON(http.StatusBadGateway, schemas.NewErrorResponse(c.Request.Context(), "Failed to reach the login provider"))
+	default:
+		loginErrorResponse(c, err)
+	}
+}
+
+// setStateCookie writes the state cookie; a negative maxAge deletes it
+func (v *ExternalLoginViews) setStateCookie(c *gin.Context, state string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		Secure:   v.secureCookie,
+		HttpOnly: true,
+		// Lax, so the cookie comes back on the provider's top-level redirect
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RegisterRoutes registers external provider login routes
+func (v *ExternalLoginViews) RegisterRoutes(router *gin.Engine) {
+	oidc := router.Group("/auth/oidc")
+	{
+		oidc.GET("/login", v.Login)
+		oidc.GET("/callback", v.Callback)
+	}
+}
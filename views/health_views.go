@@ -0,0 +1,51 @@
+package views
+
+import (
+	"go-crud/health"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthViews struct {
+	registry *health.Registry
+}
+
+func NewHealthViews(registry *health.Registry) *HealthViews {
+	return &HealthViews{
+		registry: registry,
+	}
+}
+
+// @Summary Liveness probe
+// @Tags health
+// @Success 200 {object} map[string]string
+// @Router /livez [get]
+func (v *HealthViews) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": health.StatusOK,
+	})
+}
+
+// @Summary Readiness probe
+// @Tags health
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (v *HealthViews) Readyz(c *gin.Context) {
+	report := v.registry.Report(c.Request.Context())
+
+	statusCode := http.StatusOK
+	if !report.Healthy() {
+		statusCode = http.StatusServiceUnavailable
+	}
+	c.JSON(statusCode, report)
+}
+
+// RegisterRoutes registers the probe routes. /health is kept as an alias of
+// /readyz for existing monitors.
+func (v *HealthViews) RegisterRoutes(router *gin.Engine) {
+	router.GET("/livez", v.Livez)
+	router.GET("/readyz", v.Readyz)
+	router.GET("/health", v.Readyz)
+}
@@ -0,0 +1,113 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/middleware"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OAuthClientViews struct {
+	service *services.OAuthService
+}
+
+func NewOAuthClientViews(service *services.OAuthService) *OAuthClientViews {
+	return &OAuthClientViews{
+		service: service,
+	}
+}
+
+// @Summary Register OAuth client
+// @Description Registers a third-party application. Confidential clients get a secret, returned only once.
+// @Tags oauth
+// @Security BearerAuth
+// @Param client body schemas.RegisterOAuthClientInput true "Client metadata"
+// @Success 201 {object} schemas.OAuthClientResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Router /oauth/clients [post]
+func (v *OAuthClientViews) RegisterClient(c *gin.Context) {
+	var input schemas.RegisterOAuthClientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	client, secret, err := v.service.RegisterClient(c.Request.Context(), userID, input.Name, input.RedirectURIs, input.Scopes, input.Public)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidClientMetadata) {
+			c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to register client: %v", err)))
+		return
+	}
+
+	message := "Client registered"
+	if secret != "" {
+		message = "Client registered, store the secret now as it will not be shown again"
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, schemas.OAuthClientResponse{
+		Data:         *client,
+		ClientSecret: secret,
+		Message:      message,
+	})
+}
+
+// @Summary List own OAuth clients
+// @Tags oauth
+// @Security BearerAuth
+// @Success 200 {object} schemas.ListOAuthClientsResponse
+// @Router /oauth/clients [get]
+func (v *OAuthClientViews) ListClients(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	clients, err := v.service.ListClients(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch clients: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.ListOAuthClientsResponse{Data: clients})
+}
+
+// @Summary Delete OAuth client
+// @Description Deletes the client and revokes every token issued to it.
+// @Tags oauth
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} schemas.MessageResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /oauth/clients/{client_id} [delete]
+func (v *OAuthClientViews) DeleteClient(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	if err := v.service.DeleteClient(c.Request.Context(), userID, c.Param("client_id")); err != nil {
+		if errors.Is(err, services.ErrOAuthClientNotFound) {
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "Client not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to delete client: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.MessageResponse{Message: "Client deleted"})
+}
+
+// RegisterRoutes registers OAuth client management routes
+func (v *OAuthClientViews) RegisterRoutes(router *gin.Engine) {
+	clients := router.Group("/oauth/clients", middleware.RequireAuth())
+	{
+		clients.POST("", v.RegisterClient)
+		clients.GET("", v.ListClients)
+		clients.DELETE("/:client_id", v.DeleteClient)
+	}
+}
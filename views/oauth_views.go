@@ -0,0 +1,469 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scopeDescriptions explain each scope on the consent screen
+var scopeDescriptions = map[string]string{
+	models.ScopeOpenID:     "Confirm your identity",
+	models.ScopeProfile:    "See your name",
+	models.ScopeEmail:      "See your email address",
+	models.ScopePostsRead:  "Read posts",
+	models.ScopePostsWrite: "Create, edit and delete posts",
+	models.ScopeUsersRead:  "Read user accounts",
+	models.ScopeUsersWrite: "Edit and delete user accounts",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Authorize {{.Client}}</title></head>
+<body>
+<h1>{{.Client}} wants to access your account</h1>
+<p>{{.Client}} will be able to:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Fields}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+type OAuthViews struct {
+	service  *services.OAuthService
+	loginURL string
+}
+
+// NewOAuthViews creates the OAuth endpoint views. Anonymous users reaching
+// the authorization endpoint are sent to OAUTH_LOGIN_URL, if set, with the
+// page to come back to in "return_to".
+func NewOAuthViews(service *services.OAuthService) *OAuthViews {
+	return &OAuthViews{
+		service:  service,
+		loginURL: initializers.GetEnv("OAUTH_LOGIN_URL", ""),
+	}
+}
+
+func newAuthorizationRequest(input schemas.AuthorizeInput) services.AuthorizationRequest {
+	return services.AuthorizationRequest{
+		ResponseType:        input.ResponseType,
+		ClientID:            input.ClientID,
+		RedirectURI:         input.RedirectURI,
+		Scope:               input.Scope,
+		State:               input.State,
+		CodeChallenge:       input.CodeChallenge,
+		CodeChallengeMethod: input.CodeChallengeMethod,
+		Nonce:               input.Nonce,
+	}
+}
+
+// @Summary Authorization endpoint
+// @Description Starts the authorization code flow with PKCE (S256). Shows the signed-in user a consent screen, or redirects straight back with a code if they already consented to these scopes.
+// @Tags oauth
+// @Produce html
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "A registered redirect URI"
+// @Param scope query string true "Space-separated scopes"
+// @Param state query string false "Opaque value echoed back to the client"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Param nonce query string false "Echoed in the ID token"
+// @Param prompt query string false "consent to always show the consent screen"
+// @Success 200 {string} string "Consent screen"
+// @Success 302 {string} string "Redirect to the client"
+// @Failure 400 {object} schemas.OAuthErrorResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Router /oauth/authorize [get]
+func (v *OAuthViews) Authorize(c *gin.Context) {
+	var input schemas.AuthorizeInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.OAuthErrorResponse{Error: services.OAuthInvalidRequest, ErrorDescription: err.Error()})
+		return
+	}
+
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		if v.loginURL != "" {
+			c.Redirect(http.StatusFound, withQuery(v.loginURL, url.Values{"return_to": {c.Request.URL.RequestURI()}}))
+			return
+		}
+		c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "Log in to authorize this application"))
+		return
+	}
+
+	prompt, err := v.service.PrepareAuthorization(c.Request.Context(), userID, newAuthorizationRequest(input))
+	if err != nil {
+		v.authorizeError(c, input, err)
+		return
+	}
+	if prompt.ConsentGiven && input.Prompt != "consent" {
+		v.issueCode(c, userID, input)
+		return
+	}
+
+	scopes := make([]string, 0, len(prompt.Scopes))
+	for _, scope := range prompt.Scopes {
+		scopes = append(scopes, scopeDescriptions[scope])
+	}
+	fields := map[string]string{
+		"response_type":         input.ResponseType,
+		"client_id":             input.ClientID,
+		"redirect_uri":          input.RedirectURI,
+		"scope":                 strings.Join(prompt.Scopes, " "),
+		"state":                 input.State,
+		"code_challenge":        input.CodeChallenge,
+		"code_challenge_method": input.CodeChallengeMethod,
+		"nonce":                 input.Nonce,
+		"csrf_token":            c.GetString(middleware.CSRFTokenKey),
+	}
+
+	// The consent screen must not be framed by another site
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	consentTemplate.Execute(c.Writer, map[string]interface{}{
+		"Client": prompt.Client.Name,
+		"Scopes": scopes,
+		"Fields": fields,
+	})
+}
+
+// @Summary Consent decision
+// @Description Submitted by the consent screen. Cookie sessions must include csrf_token.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param decision formData string true "allow or deny"
+// @Success 302 {string} string "Redirect to the client"
+// @Failure 400 {object} schemas.OAuthErrorResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Router /oauth/authorize [post]
+func (v *OAuthViews) Decide(c *gin.Context) {
+	var input schemas.AuthorizeInput
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.OAuthErrorResponse{Error: services.OAuthInvalidRequest, ErrorDescription: err.Error()})
+		return
+	}
+
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "Log in to authorize this application"))
+		return
+	}
+
+	if c.PostForm("decision") != "allow" {
+		// Only tell the client once the redirect URI is known to be its own
+		if _, err := v.service.PrepareAuthorization(c.Request.Context(), userID, newAuthorizationRequest(input)); err != nil {
+			v.authorizeError(c, input, err)
+			return
+		}
+		v.redirectToClient(c, input, url.Values{
+			"error":             {services.OAuthAccessDenied},
+			"error_description": {"the user denied the request"},
+		})
+		return
+	}
+
+	v.issueCode(c, userID, input)
+}
+
+func (v *OAuthViews) issueCode(c *gin.Context, userID uint, input schemas.AuthorizeInput) {
+	code, err := v.service.Authorize(c.Request.Context(), userID, newAuthorizationRequest(input))
+	if err != nil {
+		v.authorizeError(c, input, err)
+		return
+	}
+	v.redirectToClient(c, input, url.Values{"code": {code}})
+}
+
+// authorizeError reports an authorization request error to the client's
+// redirect URI when that is safe, and to the user otherwise
+func (v *OAuthViews) authorizeError(c *gin.Context, input schemas.AuthorizeInput, err error) {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to authorize: %v", err)))
+		return
+	}
+	if !oauthErr.Redirectable {
+		c.JSON(http.StatusBadRequest, schemas.OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+		return
+	}
+	v.redirectToClient(c, input, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	})
+}
+
+// redirectToClient sends the browser back to the client with params, the
+// state and the issuer (RFC 9207)
+func (v *OAuthViews) redirectToClient(c *gin.Context, input schemas.AuthorizeInput, params url.Values) {
+	if input.State != "" {
+		params.Set("state", input.State)
+	}
+	params.Set("iss", v.service.Issuer())
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, withQuery(input.RedirectURI, params))
+}
+
+// @Summary Token endpoint
+// @Description Exchanges an authorization code (with its PKCE code_verifier) or a refresh token for tokens. Confidential clients authenticate with HTTP Basic or client_secret in the form.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param grant_type formData string true "authorization_code or refresh_token"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used in the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Success 200 {object} schemas.OAuthTokenResponse
+// @Failure 400 {object} schemas.OAuthErrorResponse
+// @Failure 401 {object} schemas.OAuthErrorResponse
+// @Router /oauth/token [post]
+func (v *OAuthViews) Token(c *gin.Context) {
+	var input schemas.TokenInput
+	if err := c.ShouldBind(&input); err != nil {
+		oauthErrorResponse(c, &services.OAuthError{Code: services.OAuthInvalidRequest, Description: err.Error()})
+		return
+	}
+	creds, err := clientCredentials(c, input.ClientID, input.ClientSecret)
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	var tokens *services.OAuthTokens
+	switch input.GrantType {
+	case "authorization_code":
+		tokens, err = v.service.ExchangeCode(c.Request.Context(), creds, input.Code, input.RedirectURI, input.CodeVerifier)
+	case "refresh_token":
+		tokens, err = v.service.Refresh(c.Request.Context(), creds, input.RefreshToken, input.Scope)
+	default:
+		err = &services.OAuthError{Code: services.OAuthUnsupportedGrantType, Description: "grant_type must be authorization_code or refresh_token"}
+	}
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, schemas.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        strings.Join(tokens.Scopes, " "),
+		IDToken:      tokens.IDToken,
+	})
+}
+
+// @Summary Token introspection
+// @Description RFC 7662. Clients can only introspect their own tokens; anything else is reported inactive.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Access or refresh token"
+// @Success 200 {object} schemas.IntrospectionResponse
+// @Failure 401 {object} schemas.OAuthErrorResponse
+// @Router /oauth/introspect [post]
+func (v *OAuthViews) Introspect(c *gin.Context) {
+	creds, err := clientCredentials(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	token, err := v.service.Introspect(c.Request.Context(), creds, c.PostForm("token"))
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if token == nil {
+		c.JSON(http.StatusOK, schemas.IntrospectionResponse{Active: false})
+		return
+	}
+	c.JSON(http.StatusOK, schemas.IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(token.Scopes, " "),
+		ClientID:  token.ClientID,
+		Subject:   strconv.FormatUint(uint64(token.UserID), 10),
+		TokenType: token.Kind,
+		ExpiresAt: token.ExpiresAt.Unix(),
+		IssuedAt:  token.CreatedAt.Unix(),
+	})
+}
+
+// @Summary Token revocation
+// @Description RFC 7009. Revoking a refresh token also revokes the access tokens issued with it. Unknown tokens are ignored.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Access or refresh token"
+// @Success 200
+// @Failure 401 {object} schemas.OAuthErrorResponse
+// @Router /oauth/revoke [post]
+func (v *OAuthViews) Revoke(c *gin.Context) {
+	creds, err := clientCredentials(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	if err := v.service.Revoke(c.Request.Context(), creds, c.PostForm("token")); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// @Summary OpenID Connect UserInfo
+// @Description Claims about the user, limited to the scopes of an OAuth access token.
+// @Tags oauth
+// @Security BearerAuth
+// @Success 200 {object} schemas.UserInfoResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Router /oauth/userinfo [get]
+func (v *OAuthViews) UserInfo(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	user, err := v.service.User(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch user: %v", err)))
+		return
+	}
+
+	// Users acting for themselves see every claim
+	allowed := func(string) bool { return true }
+	if value, exists := c.Get(middleware.ScopesKey); exists {
+		scopes, _ := value.([]string)
+		allowed = func(scope string) bool { return slices.Contains(scopes, scope) }
+	}
+
+	response := schemas.UserInfoResponse{Subject: strconv.FormatUint(uint64(user.ID), 10)}
+	if allowed(models.ScopeProfile) {
+		response.Name = user.Name
+	}
+	if allowed(models.ScopeEmail) {
+		verified := user.IsEmailVerified()
+		response.Email = user.Email
+		response.EmailVerified = &verified
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary OpenID Connect discovery document
+// @Tags oauth
+// @Success 200 {object} schemas.OpenIDConfiguration
+// @Router /.well-known/openid-configuration [get]
+func (v *OAuthViews) Discovery(c *gin.Context) {
+	issuer := v.service.Issuer()
+	c.JSON(http.StatusOK, schemas.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/oauth/jwks",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		ScopesSupported:                   models.OAuthScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"ES256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "email", "email_verified"},
+	})
+}
+
+// @Summary JSON Web Key Set
+// @Description Public keys that verify ID tokens.
+// @Tags oauth
+// @Success 200 {object} services.JSONWebKeySet
+// @Router /oauth/jwks [get]
+func (v *OAuthViews) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, v.service.JWKS())
+}
+
+// clientCredentials reads client authentication from HTTP Basic or, failing
+// that, the form. Using both at once is an error (RFC 6749 2.3).
+func clientCredentials(c *gin.Context, formID, formSecret string) (services.ClientCredentials, error) {
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return services.ClientCredentials{ClientID: formID, ClientSecret: formSecret}, nil
+	}
+	if formSecret != "" {
+		return services.ClientCredentials{}, &services.OAuthError{Code: services.OAuthInvalidRequest, Description: "use only one client authentication method"}
+	}
+	// Basic credentials are form-encoded before being joined
+	id, idErr := url.QueryUnescape(id)
+	secret, secretErr := url.QueryUnescape(secret)
+	if idErr != nil || secretErr != nil || (formID != "" && formID != id) {
+		return services.ClientCredentials{}, &services.OAuthError{Code: services.OAuthInvalidClient, Description: "malformed client credentials"}
+	}
+	return services.ClientCredentials{ClientID: id, ClientSecret: secret}, nil
+}
+
+// oauthErrorResponse writes err in the RFC 6749 error format
+func oauthErrorResponse(c *gin.Context, err error) {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		c.JSON(http.StatusInternalServerError, schemas.OAuthErrorResponse{Error: "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == services.OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="go-crud"`)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, schemas.OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+}
+
+// withQuery adds params to the query string of link
+func withQuery(link string, params url.Values) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// RegisterRoutes registers the OAuth and OpenID Connect endpoints
+func (v *OAuthViews) RegisterRoutes(router *gin.Engine) {
+	oauth := router.Group("/oauth")
+	{
+		oauth.GET("/authorize", v.Authorize)
+		oauth.POST("/authorize", v.Decide)
+		oauth.POST("/token", v.Token)
+		oauth.POST("/introspect", v.Introspect)
+		oauth.POST("/revoke", v.Revoke)
+		oauth.GET("/userinfo", middleware.RequireAuth(), v.UserInfo)
+		oauth.GET("/jwks", v.JWKS)
+	}
+	router.GET("/.well-known/openid-configuration", v.Discovery)
+}
@@ -2,21 +2,23 @@ package views
 
 import (
 	"fmt"
+	"go-crud/middleware"
 	"go-crud/schemas"
 	"go-crud/services"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type PostViews struct {
 	service *services.PostService
 }
 
-func NewPostViews() *PostViews {
+func NewPostViews(db *gorm.DB) *PostViews {
 	return &PostViews{
-		service: services.NewPostService(),
+		service: services.NewPostService(db),
 	}
 }
 
@@ -28,24 +30,22 @@ func NewPostViews() *PostViews {
 func (v *PostViews) CreatePost(c *gin.Context) {
 	var input schemas.CreatePostRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Invalid request data: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
 		return
 	}
 
 	if err := input.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Validation failed: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
 		return
 	}
 
-	result, err := v.service.Create(input.ToModel())
+	post := input.ToModel()
+	if userID, ok := middleware.CurrentUserID(c); ok {
+		post.UserID = &userID
+	}
+	result, err := v.service.Create(c.Request.Context(), post)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Failed to create post: %v", err),
-		})
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to create post: %v", err)))
 		return
 	}
 
@@ -75,11 +75,9 @@ func (v *PostViews) ListPosts(c *gin.Context) {
 		query.Limit = 10
 	}
 
-	results, total, err := v.service.GetWithPagination(query)
+	results, total, err := v.service.GetWithPagination(c.Request.Context(), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Failed to fetch posts: %v", err),
-		})
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch posts: %v", err)))
 		return
 	}
 
@@ -100,17 +98,13 @@ func (v *PostViews) ListPosts(c *gin.Context) {
 func (v *PostViews) GetPost(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: "Invalid ID format",
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid ID format"))
 		return
 	}
 
-	result, err := v.service.GetByID(uint(id))
+	result, err := v.service.GetByID(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Post not found: %v", err),
-		})
+		c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Post not found: %v", err)))
 		return
 	}
 
@@ -129,32 +123,24 @@ func (v *PostViews) GetPost(c *gin.Context) {
 func (v *PostViews) UpdatePost(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: "Invalid ID format",
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid ID format"))
 		return
 	}
 
 	var input schemas.UpdatePostRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Invalid request data: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
 		return
 	}
 
 	if err := input.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Validation failed: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
 		return
 	}
 
-	result, err := v.service.Update(uint(id), input.ToModel())
+	result, err := v.service.Update(c.Request.Context(), uint(id), input.ToModel())
 	if err != nil {
-		c.JSON(http.StatusNotFound, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Failed to update post: %v", err),
-		})
+		c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to update post: %v", err)))
 		return
 	}
 
@@ -174,35 +160,27 @@ func (v *PostViews) UpdatePost(c *gin.Context) {
 func (v *PostViews) PartialUpdatePost(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: "Invalid ID format",
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid ID format"))
 		return
 	}
 
 	var input schemas.PatchPostRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Invalid request data: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
 		return
 	}
 
 	if input.IsEmpty() {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: "No data provided for update",
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "No data provided for update"))
 		return
 	}
 
 	if err := input.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Validation failed: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
 		return
 	}
 
-	result, err := v.service.PartialUpdate(uint(id), input.ToMap())
+	result, err := v.service.PartialUpdate(c.Request.Context(), uint(id), input.ToMap())
 	if err != nil {
 		statusCode := http.StatusInternalServerError
 		if err.Error() == "post not found" {
@@ -211,9 +189,7 @@ func (v *PostViews) PartialUpdatePost(c *gin.Context) {
 			statusCode = http.StatusBadRequest
 		}
 
-		c.JSON(statusCode, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Failed to update post: %v", err),
-		})
+		c.JSON(statusCode, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to update post: %v", err)))
 		return
 	}
 
@@ -232,17 +208,13 @@ func (v *PostViews) PartialUpdatePost(c *gin.Context) {
 func (v *PostViews) DeletePost(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: "Invalid ID format",
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid ID format"))
 		return
 	}
 
-	err = v.service.Delete(uint(id))
+	err = v.service.Delete(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Failed to delete post: %v", err),
-		})
+		c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to delete post: %v", err)))
 		return
 	}
 
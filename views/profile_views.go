@@ -0,0 +1,180 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/avatar"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead allows for the multipart headers and boundaries around
+// an uploaded avatar
+const multipartOverhead = 64 << 10
+
+type ProfileViews struct {
+	profiles *services.ProfileService
+}
+
+func NewProfileViews(profiles *services.ProfileService) *ProfileViews {
+	return &ProfileViews{
+		profiles: profiles,
+	}
+}
+
+// @Summary Get a user's public profile
+// @Description The email is only included for the user themselves and admins. Deactivated and suspended users are not found, except by themselves and admins.
+// @Tags users
+// @Param id path int true "User ID"
+// @Success 200 {object} schemas.ProfileResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /users/{id}/profile [get]
+func (v *ProfileViews) GetProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
+		return
+	}
+
+	viewerID, _ := middleware.CurrentUserID(c)
+	profile, err := v.profiles.Get(c.Request.Context(), uint(id), viewerID, c.GetString(middleware.RoleKey) == models.RoleAdmin)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "User not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch profile: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.ProfileResponse{Data: *profile})
+}
+
+// @Summary Get a user's avatar
+// @Description Returns the smallest square thumbnail at least size pixels wide, or the largest there is.
+// @Tags users
+// @Produce image/png
+// @Param id path int true "User ID"
+// @Param size query int false "Edge length in pixels" default(128)
+// @Success 200 {file} file "PNG thumbnail"
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /users/{id}/avatar [get]
+func (v *ProfileViews) GetAvatar(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
+		return
+	}
+	size, err := strconv.Atoi(c.DefaultQuery("size", "128"))
+	if err != nil || size < 1 {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid avatar size"))
+		return
+	}
+
+	thumbnail, err := v.profiles.Avatar(c.Request.Context(), uint(id), size)
+	if err != nil {
+		if errors.Is(err, services.ErrAvatarNotFound) {
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "Avatar not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch avatar: %v", err)))
+		return
+	}
+
+	// Profile links carry the upload time, so a new avatar gets a new URL
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, thumbnail.ContentType, thumbnail.Data)
+}
+
+// @Summary Upload my avatar
+// @Description Accepts a JPEG, PNG or GIF as the multipart field "avatar". The picture is cropped to a centred square and stored as PNG thumbnails in several sizes; EXIF and other metadata are discarded.
+// @Tags users
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Param avatar formData file true "Picture"
+// @Success 200 {object} schemas.ProfileResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 413 {object} schemas.ErrorResponse
+// @Failure 415 {object} schemas.ErrorResponse
+// @Router /users/me/avatar [put]
+func (v *ProfileViews) UploadAvatar(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, v.profiles.MaxAvatarBytes()+multipartOverhead)
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Avatar must be at most %d bytes", v.profiles.MaxAvatarBytes())))
+			return
+		}
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+	defer file.Close()
+
+	userID, _ := middleware.CurrentUserID(c)
+	user, err := v.profiles.UploadAvatar(c.Request.Context(), userID, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAvatarTooLarge), errors.Is(err, avatar.ErrTooManyPixels):
+			c.JSON(http.StatusRequestEntityTooLarge, schemas.NewErrorResponse(c.Request.Context(), err.Error()))
+		case errors.Is(err, avatar.ErrUnsupportedType):
+			c.JSON(http.StatusUnsupportedMediaType, schemas.NewErrorResponse(c.Request.Context(), err.Error()))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to upload avatar: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.ProfileResponse{
+		Data:    schemas.NewProfile(*user, true),
+		Message: "Avatar updated",
+	})
+}
+
+// @Summary Delete my avatar
+// @Tags users
+// @Security BearerAuth
+// @Success 200 {object} schemas.ProfileResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Router /users/me/avatar [delete]
+func (v *ProfileViews) DeleteAvatar(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	user, err := v.profiles.DeleteAvatar(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to delete avatar: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.ProfileResponse{
+		Data:    schemas.NewProfile(*user, true),
+		Message: "Avatar deleted",
+	})
+}
+
+// RegisterRoutes registers public profile and avatar routes
+func (v *ProfileViews) RegisterRoutes(router *gin.Engine) {
+	users := router.Group("/users")
+	{
+		users.GET("/:id/profile", v.GetProfile)
+		users.GET("/:id/avatar", v.GetAvatar)
+	}
+
+	me := router.Group("/users/me", middleware.RequireAuth())
+	{
+		me.PUT("/avatar", v.UploadAvatar)
+		me.DELETE("/avatar", v.DeleteAvatar)
+	}
+}
@@ -0,0 +1,260 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/initializers"
+	"go-crud/middleware"
+	"go-crud/models"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionViews struct {
+	auth         *services.AuthService
+	sessions     *services.SessionService
+	secureCookie bool
+}
+
+// NewSessionViews creates the cookie session views. SESSION_COOKIE_SECURE
+// can be turned off for local development over plain HTTP.
+func NewSessionViews(auth *services.AuthService, sessions *services.SessionService) *SessionViews {
+	return &SessionViews{
+		auth:         auth,
+		sessions:     sessions,
+		secureCookie: initializers.GetEnvBool("SESSION_COOKIE_SECURE", true),
+	}
+}
+
+// @Summary Log in with a session cookie
+// @Description For browser clients. Sets an HttpOnly session cookie and returns the CSRF token to send as X-CSRF-Token on unsafe requests. Answers 202 with a challenge token when the account has two-factor enabled; finish with /auth/session/2fa.
+// @Tags sessions
+// @Param credentials body schemas.LoginInput true "Credentials"
+// @Success 200 {object} schemas.SessionResponse
+// @Success 202 {object} schemas.TwoFactorChallengeResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 423 {object} schemas.ErrorResponse
+// @Failure 429 {object} schemas.ErrorResponse
+// @Router /auth/session [post]
+func (v *SessionViews) Login(c *gin.Context) {
+	var input schemas.LoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	user, _, err := v.auth.Login(c.Request.Context(), input.Email, input.Password, c.ClientIP())
+	if err != nil {
+		var required *services.TwoFactorRequiredError
+		if errors.As(err, &required) {
+			c.JSON(http.StatusAccepted, newTwoFactorChallengeResponse(required))
+			return
+		}
+		loginErrorResponse(c, err)
+		return
+	}
+
+	v.startSession(c, user)
+}
+
+// @Summary Complete a two-factor session login
+// @Tags sessions
+// @Param verification body schemas.VerifyTwoFactorInput true "Challenge token from /auth/session and a TOTP or recovery code"
+// @Success 200 {object} schemas.SessionResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 423 {object} schemas.ErrorResponse
+// @Failure 429 {object} schemas.ErrorResponse
+// @Router /auth/session/2fa [post]
+func (v *SessionViews) VerifyTwoFactor(c *gin.Context) {
+	var input schemas.VerifyTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	user, _, err := v.auth.VerifyTwoFactor(c.Request.Context(), input.ChallengeToken, input.Code, c.ClientIP())
+	if err != nil {
+		twoFactorErrorResponse(c, err)
+		return
+	}
+
+	v.startSession(c, user)
+}
+
+// @Summary Current session
+// @Description Returns the cookie session and its CSRF token, e.g. for a page that was reloaded.
+// @Tags sessions
+// @Success 200 {object} schemas.SessionResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Router /auth/session [get]
+func (v *SessionViews) Current(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	sessions, err := v.sessions.List(c.Request.Context(), userID, c.GetString(middleware.SessionIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch session: %v", err)))
+		return
+	}
+
+	for _, current := range sessions {
+		if current.Current {
+			c.Header("Cache-Control", "no-store")
+			c.JSON(http.StatusOK, schemas.SessionResponse{
+				Data:      current,
+				CSRFToken: c.GetString(middleware.CSRFTokenKey),
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "Session has ended"))
+}
+
+// @Summary Log out of the session
+// @Tags sessions
+// @Param X-CSRF-Token header string true "CSRF token of the session"
+// @Success 200 {object} schemas.MessageResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Router /auth/session [delete]
+func (v *SessionViews) Logout(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	err := v.sessions.Revoke(c.Request.Context(), userID, c.GetString(middleware.SessionIDKey))
+	if err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to log out: %v", err)))
+		return
+	}
+
+	v.setCookie(c, "", -1)
+	c.JSON(http.StatusOK, schemas.MessageResponse{Message: "Logged out"})
+}
+
+// @Summary List own sessions
+// @Tags sessions
+// @Security BearerAuth
+// @Success 200 {object} schemas.ListSessionsResponse
+// @Router /users/me/sessions [get]
+func (v *SessionViews) ListSessions(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	sessions, err := v.sessions.List(c.Request.Context(), userID, c.GetString(middleware.SessionIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch sessions: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.ListSessionsResponse{Data: sessions})
+}
+
+// @Summary Revoke every other session
+// @Description Ends all of the user's sessions except the one making the request.
+// @Tags sessions
+// @Security BearerAuth
+// @Success 200 {object} schemas.MessageResponse
+// @Router /users/me/sessions [delete]
+func (v *SessionViews) RevokeOtherSessions(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	revoked, err := v.sessions.RevokeOthers(c.Request.Context(), userID, c.GetString(middleware.SessionIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to revoke sessions: %v", err)))
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.MessageResponse{Message: fmt.Sprintf("%d sessions revoked", revoked)})
+}
+
+// @Summary Revoke a session
+// @Tags sessions
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} schemas.MessageResponse
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /users/me/sessions/{id} [delete]
+func (v *SessionViews) RevokeSession(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	id := c.Param("id")
+	if err := v.sessions.Revoke(c.Request.Context(), userID, id); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "Session not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to revoke session: %v", err)))
+		return
+	}
+
+	if id == c.GetString(middleware.SessionIDKey) {
+		v.setCookie(c, "", -1)
+	}
+	c.JSON(http.StatusOK, schemas.MessageResponse{Message: "Session revoked"})
+}
+
+func (v *SessionViews) startSession(c *gin.Context, user *models.User) {
+	started, token, err := v.sessions.Start(c.Request.Context(), user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to start session: %v", err)))
+		return
+	}
+
+	v.setCookie(c, token, int(v.sessions.AbsoluteTimeout().Seconds()))
+	c.Header("Cache-Control", "no-store")
+	started.Current = true
+	c.JSON(http.StatusOK, schemas.SessionResponse{
+		Data:      *started,
+		CSRFToken: started.CSRFToken,
+		Message:   "Logged in",
+	})
+}
+
+// setCookie writes the session cookie; a negative maxAge deletes it
+func (v *SessionViews) setCookie(c *gin.Context, token string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   v.secureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RegisterRoutes registers session login and management routes
+func (v *SessionViews) RegisterRoutes(router *gin.Engine) {
+	auth := router.Group("/auth/session")
+	{
+		auth.POST("", v.Login)
+		auth.POST("/2fa", v.VerifyTwoFactor)
+		auth.GET("", requireSession(), v.Current)
+		auth.DELETE("", requireSession(), v.Logout)
+	}
+
+	sessions := router.Group("/users/me/sessions", middleware.RequireAuth())
+	{
+		sessions.GET("", v.ListSessions)
+		sessions.DELETE("", v.RevokeOtherSessions)
+		sessions.DELETE("/:id", v.RevokeSession)
+	}
+}
+
+// requireSession rejects requests not authenticated by a session cookie
+func requireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(middleware.SessionIDKey) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, schemas.NewErrorResponse(c.Request.Context(), "No active session"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,122 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"go-crud/middleware"
+	"go-crud/schemas"
+	"go-crud/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TwoFactorViews struct {
+	service *services.TwoFactorService
+}
+
+func NewTwoFactorViews(service *services.TwoFactorService) *TwoFactorViews {
+	return &TwoFactorViews{
+		service: service,
+	}
+}
+
+// @Summary Start two-factor enrollment
+// @Description Returns a new TOTP secret as an otpauth URI and QR code. It is not enforced until confirmed.
+// @Tags two-factor
+// @Security BearerAuth
+// @Success 200 {object} schemas.TwoFactorEnrollmentResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /users/me/2fa/enroll [post]
+func (v *TwoFactorViews) Enroll(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	enrollment, err := v.service.BeginEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		v.respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schemas.TwoFactorEnrollmentResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURI: enrollment.URI,
+		QRCodePNG:  enrollment.QRCode,
+	})
+}
+
+// @Summary QR code for the pending enrollment
+// @Tags two-factor
+// @Security BearerAuth
+// @Produce png
+// @Success 200 {file} binary
+// @Failure 404 {object} schemas.ErrorResponse
+// @Router /users/me/2fa/qr.png [get]
+func (v *TwoFactorViews) QRCode(c *gin.Context) {
+	userID, _ := middleware.CurrentUserID(c)
+	enrollment, err := v.service.PendingEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		v.respondError(c, err)
+		return
+	}
+
+	// The image encodes the secret, so keep it out of shared caches
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", enrollment.QRCode)
+}
+
+// @Summary Confirm two-factor enrollment
+// @Description Enables two-factor authentication with a first code from the authenticator, and returns one-time recovery codes that are never shown again.
+// @Tags two-factor
+// @Security BearerAuth
+// @Param code body schemas.TwoFactorCodeInput true "Current TOTP code"
+// @Success 200 {object} schemas.RecoveryCodesResponse
+// @Failure 400 {object} schemas.ErrorResponse
+// @Failure 409 {object} schemas.ErrorResponse
+// @Router /users/me/2fa/confirm [post]
+func (v *TwoFactorViews) Confirm(c *gin.Context) {
+	var input schemas.TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	userID, _ := middleware.CurrentUserID(c)
+	codes, err := v.service.ConfirmEnrollment(c.Request.Context(), userID, input.Code)
+	if err != nil {
+		v.respondError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, schemas.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Message:       "Two-factor authentication enabled",
+	})
+}
+
+func (v *TwoFactorViews) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		c.JSON(http.StatusConflict, schemas.NewErrorResponse(c.Request.Context(), "Two-factor authentication is already enabled"))
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled):
+		c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "Start two-factor enrollment first"))
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid two-factor code"))
+	default:
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Two-factor operation failed: %v", err)))
+	}
+}
+
+// RegisterRoutes registers two-factor enrollment routes
+func (v *TwoFactorViews) RegisterRoutes(router *gin.Engine) {
+	twoFactor := router.Group("/users/me/2fa", middleware.RequireAuth())
+	{
+		twoFactor.POST("/enroll", v.Enroll)
+		twoFactor.GET("/qr.png", v.QRCode)
+		twoFactor.POST("/confirm", v.Confirm)
+	}
+}
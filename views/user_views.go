@@ -1,7 +1,10 @@
 package views
 
 import (
+	"errors"
 	"fmt"
+	"go-crud/mail"
+	"go-crud/middleware"
 	"go-crud/models"
 	"go-crud/schemas"
 	"go-crud/services"
@@ -10,17 +13,20 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
 )
 
 
 type UserViews struct {
 	service   *services.UserService
+	profiles  *services.ProfileService
 	validator *validator.Validate
 }
 
-func NewUserViews() *UserViews {
+func NewUserViews(db *gorm.DB, mailer mail.Mailer) *UserViews {
 	return &UserViews{
-		service:   services.NewUserService(),
+		service:   services.NewUserService(db, mailer),
+		profiles:  services.NewProfileService(db),
 		validator: validator.New(),
 	}
 }
@@ -34,28 +40,26 @@ func NewUserViews() *UserViews {
 func (v *UserViews) CreateUser(c *gin.Context) {
 	var input schemas.CreateUserInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Invalid request data: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
 		return
 	}
 
 	if err := v.validator.Struct(input); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Validation failed: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
 		return
 	}
 
-	result, err := v.service.Create(models.User{
+	result, err := v.service.Create(c.Request.Context(), models.User{
 		Name:         input.Name,
 		Email:        input.Email,
 		HashedPassword: input.Password,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Failed to create user: %v", err),
-		})
+		if response, ok := passwordPolicyResponse(c, err); ok {
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to create user: %v", err)))
 		return
 	}
 
@@ -67,29 +71,32 @@ func (v *UserViews) CreateUser(c *gin.Context) {
 }
 
 // @Summary Get user by ID
+// @Description Returns the user's public profile, like GET /users/{id}/profile. The email is only included for the user themselves and admins.
 // @Tags users
 // @Param id path int true "User ID"
-// @Success 200 {object} schemas.UserResponse
+// @Success 200 {object} schemas.ProfileResponse
+// @Failure 404 {object} schemas.ErrorResponse
 // @Router /users/{id} [get]
 func (v *UserViews) GetUserByID(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: "Invalid user ID",
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
 		return
 	}
 
-	result, err := v.service.GetByID(uint(id))
+	viewerID, _ := middleware.CurrentUserID(c)
+	result, err := v.profiles.Get(c.Request.Context(), uint(id), viewerID, c.GetString(middleware.RoleKey) == models.RoleAdmin)
 	if err != nil {
-		c.JSON(http.StatusNotFound, schemas.ErrorResponse{
-			Error: fmt.Sprintf("User not found: %v", err),
-		})
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("User not found: %v", err)))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to fetch user: %v", err)))
 		return
 	}
 
-	response := schemas.UserResponse{
+	response := schemas.ProfileResponse{
 		Data:    *result,
 		Message: "User retrieved successfully",
 	}
@@ -98,47 +105,46 @@ func (v *UserViews) GetUserByID(c *gin.Context) {
 }
 
 // @Summary Partially update user
+// @Description Only the user themselves and admins can update a user.
 // @Tags users
+// @Security BearerAuth
 // @Param id path int true "User ID"
 // @Param user body schemas.PartialUpdateUserInput true "User data"
 // @Success 200 {object} schemas.UserResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
 // @Router /users/{id} [patch]
 func (v *UserViews) PartialUpdateUser(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: "Invalid user ID",
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
+		return
+	}
+	if !isOwnerOrAdmin(c, uint(id)) {
+		c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "Insufficient permissions"))
 		return
 	}
 
 	var input schemas.PartialUpdateUserInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Invalid request data: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
 		return
 	}
 
-	if err := v.validator.StructPartial(input, "Name", "Email", "Password"); err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Validation failed: %v", err),
-		})
+	if err := v.validator.StructPartial(input, "Name", "DisplayName", "Bio", "Website", "Location"); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
 		return
 	}
 
-	result, err := v.service.PartialUpdate(uint(id), input)
+	result, err := v.service.PartialUpdate(c.Request.Context(), uint(id), input)
 	if err != nil {
 		if err.Error() == "user not found" {
-			c.JSON(http.StatusNotFound, schemas.ErrorResponse{
-				Error: "User not found",
-			})
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "User not found"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Failed to update user: %v", err),
-		})
+		c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to update user: %v", err)))
 		return
 	}
 
@@ -150,30 +156,40 @@ func (v *UserViews) PartialUpdateUser(c *gin.Context) {
 }
 
 // @Summary Delete user
+// @Description Admins erase the user right away. Users deleting their own account must send their password and get the same grace period as DELETE /users/me.
 // @Tags users
+// @Security BearerAuth
 // @Param id path int true "User ID"
+// @Param input body schemas.DeleteAccountInput false "Current password, when deleting your own account"
 // @Success 200 {object} schemas.MessageResponse
+// @Success 202 {object} schemas.UserResponse
+// @Failure 401 {object} schemas.ErrorResponse
+// @Failure 403 {object} schemas.ErrorResponse
+// @Failure 404 {object} schemas.ErrorResponse
 // @Router /users/{id} [delete]
 func (v *UserViews) DeleteUser(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, schemas.ErrorResponse{
-			Error: "Invalid user ID",
-		})
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), "Invalid user ID"))
 		return
 	}
 
-	if err := v.service.Delete(uint(id)); err != nil {
+	if callerID, _ := middleware.CurrentUserID(c); callerID == uint(id) {
+		v.scheduleOwnDeletion(c, callerID)
+		return
+	}
+	if !isOwnerOrAdmin(c, uint(id)) {
+		c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "Insufficient permissions"))
+		return
+	}
+
+	if err := v.service.Delete(c.Request.Context(), uint(id)); err != nil {
 		if err.Error() == "user not found" {
-			c.JSON(http.StatusNotFound, schemas.ErrorResponse{
-				Error: "User not found",
-			})
+			c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), "User not found"))
 			return
 		}
-		c.JSON(http.StatusNotFound, schemas.ErrorResponse{
-			Error: fmt.Sprintf("Failed to delete user: %v", err),
-		})
+		c.JSON(http.StatusNotFound, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to delete user: %v", err)))
 		return
 	}
 
@@ -182,13 +198,74 @@ func (v *UserViews) DeleteUser(c *gin.Context) {
 	})
 }
 
+// scheduleOwnDeletion handles users deleting themselves through
+// DELETE /users/:id like DELETE /users/me, so the password check and grace
+// period cannot be skipped
+func (v *UserViews) scheduleOwnDeletion(c *gin.Context, userID uint) {
+	var input schemas.DeleteAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Invalid request data: %v", err)))
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Validation failed: %v", err)))
+		return
+	}
+
+	user, err := v.service.ScheduleDeletion(c.Request.Context(), userID, input.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword):
+			c.JSON(http.StatusForbidden, schemas.NewErrorResponse(c.Request.Context(), "Current password is incorrect"))
+		default:
+			c.JSON(http.StatusInternalServerError, schemas.NewErrorResponse(c.Request.Context(), fmt.Sprintf("Failed to schedule account deletion: %v", err)))
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, schemas.UserResponse{
+		Data:    *user,
+		Message: "Account scheduled for deletion",
+	})
+}
+
+// isOwnerOrAdmin reports whether the authenticated caller is the user with
+// the given ID or an admin
+func isOwnerOrAdmin(c *gin.Context, userID uint) bool {
+	callerID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		return false
+	}
+	return callerID == userID || c.GetString(middleware.RoleKey) == models.RoleAdmin
+}
+
+// passwordPolicyResponse describes a password policy failure with one
+// detail per violated rule
+func passwordPolicyResponse(c *gin.Context, err error) (schemas.ErrorResponse, bool) {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return schemas.ErrorResponse{}, false
+	}
+
+	response := schemas.NewErrorResponse(c.Request.Context(), "Password does not meet the password policy")
+	response.Code = "password_policy"
+	for _, violation := range policyErr.Violations {
+		response.Details = append(response.Details, schemas.ErrorDetail{
+			Code:    violation.Code,
+			Message: violation.Message,
+		})
+	}
+	return response, true
+}
+
 // RegisterRoutes registers user-related routes
 func (v *UserViews) RegisterRoutes(router *gin.Engine) {
 	users := router.Group("/users")
 	{
 		users.POST("", v.CreateUser)
 		users.GET("/:id", v.GetUserByID)
-		users.PATCH("/:id", v.PartialUpdateUser)
-		users.DELETE("/:id", v.DeleteUser)
+		users.PATCH("/:id", middleware.RequireAuth(), v.PartialUpdateUser)
+		users.DELETE("/:id", middleware.RequireAuth(), v.DeleteUser)
 	}
 }
\ No newline at end of file